@@ -0,0 +1,284 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/totp"
+	"Discord-Bot-2FA-Key-Gen/vault"
+)
+
+type entryResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	Type      string    `json:"type"`
+	Digits    int       `json:"digits"`
+	Period    int       `json:"period,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newEntryResponse(entry vault.Entry) entryResponse {
+	return entryResponse{
+		ID:        entry.ID,
+		Name:      entry.Name,
+		Owner:     entry.Owner,
+		Issuer:    entry.Issuer,
+		Account:   entry.Account,
+		Type:      entry.Type,
+		Digits:    entry.Digits,
+		Period:    entry.Period,
+		CreatedAt: entry.CreatedAt,
+	}
+}
+
+func (s *Server) handleListEntries(w http.ResponseWriter, r *http.Request, key *Key) {
+	if !s.requireVault(w) {
+		return
+	}
+
+	entries := []entryResponse{}
+	for _, entry := range s.vault.List(key.CanAccess) {
+		entries = append(entries, newEntryResponse(entry))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries})
+}
+
+func (s *Server) handleCreateEntry(w http.ResponseWriter, r *http.Request, key *Key) {
+	if !s.requireVault(w) {
+		return
+	}
+
+	var body struct {
+		Name    string `json:"name"`
+		Secret  string `json:"secret"`
+		URI     string `json:"uri"`
+		Issuer  string `json:"issuer"`
+		Account string `json:"account"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+
+	var otpKey *totp.Key
+	switch {
+	case body.URI != "" && body.Secret != "":
+		writeError(w, http.StatusBadRequest, "set either secret or uri, not both")
+		return
+	case body.URI != "":
+		parsed, err := totp.ParseURI(body.URI)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		otpKey = parsed
+	default:
+		if err := s.totp.ValidateSecret(body.Secret); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		otpKey = totp.NewKey(body.Issuer, body.Account, totp.NormalizeSecret(body.Secret))
+	}
+
+	entry, err := s.vault.Add(vault.Entry{
+		Name:      body.Name,
+		Owner:     vault.APIOwner(key.Name),
+		CreatedBy: vault.APIOwner(key.Name),
+	}, otpKey)
+	if errors.Is(err, vault.ErrDuplicate) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to store vault entry", "api_key_name", key.Name, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.recordAudit(key, "entries.create", audit.Event{
+		Action:  audit.ActionSave,
+		Entry:   entry.ID,
+		Outcome: "success",
+		Details: map[string]string{"name": entry.Name},
+	})
+	writeJSON(w, http.StatusCreated, newEntryResponse(entry))
+}
+
+func (s *Server) handleDeleteEntry(w http.ResponseWriter, r *http.Request, key *Key) {
+	entry, ok := s.accessibleEntry(w, r, key, "entries.delete")
+	if !ok {
+		return
+	}
+	if entry.Owner != vault.APIOwner(key.Name) {
+		writeError(w, http.StatusForbidden, "only entries created by this API key can be deleted")
+		return
+	}
+
+	if err := s.vault.Delete(entry.ID); err != nil {
+		logger.Error("Failed to delete vault entry", "api_key_name", key.Name, "entry_id", entry.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete entry")
+		return
+	}
+
+	s.recordAudit(key, "entries.delete", audit.Event{
+		Action:  audit.ActionDelete,
+		Entry:   entry.ID,
+		Outcome: "success",
+		Details: map[string]string{"name": entry.Name},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleEntryCode(w http.ResponseWriter, r *http.Request, key *Key) {
+	entry, ok := s.accessibleEntry(w, r, key, "entries.code")
+	if !ok {
+		return
+	}
+	otpKey, ok := s.entryKey(w, entry)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	code, err := otpKey.Code(now)
+	if err != nil {
+		logger.Error("Failed to generate code for vault entry", "entry_id", entry.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to generate code")
+		return
+	}
+	remaining := otpKey.Remaining(now)
+
+	s.recordAudit(key, "entries.code", audit.Event{
+		Action:  audit.ActionView,
+		Entry:   entry.ID,
+		Outcome: "success",
+		Details: map[string]string{"name": entry.Name},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"code":              code,
+		"remaining_seconds": int(remaining.Seconds()),
+		"valid_until":       now.Add(remaining).UTC().Truncate(time.Second),
+	})
+}
+
+func (s *Server) handleEntryVerify(w http.ResponseWriter, r *http.Request, key *Key) {
+	entry, ok := s.accessibleEntry(w, r, key, "entries.verify")
+	if !ok {
+		return
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	otpKey, ok := s.entryKey(w, entry)
+	if !ok {
+		return
+	}
+
+	valid, err := otpKey.Verify(body.Code, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to verify code")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"valid": valid})
+}
+
+func (s *Server) handleGenerateSecret(w http.ResponseWriter, r *http.Request, key *Key) {
+	var body struct {
+		Issuer  string `json:"issuer"`
+		Account string `json:"account"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+
+	result, err := s.totp.GenerateSecret(body.Issuer, body.Account, totp.DefaultQROptions())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.recordAudit(key, "secrets.generate", audit.Event{
+		Action:  audit.ActionGenerate,
+		Entry:   audit.Fingerprint(result.Secret),
+		Outcome: "success",
+	})
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret": result.Secret,
+		"uri":    result.URI,
+	})
+}
+
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request, key *Key) {
+	var body struct {
+		Secret string `json:"secret"`
+		Code   string `json:"code"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+
+	valid, err := s.totp.Verify(body.Secret, body.Code)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"valid": valid})
+}
+
+func (s *Server) requireVault(w http.ResponseWriter) bool {
+	if s.vault == nil {
+		writeError(w, http.StatusServiceUnavailable, "the vault is not configured (set ENTRY_VAULT_KEY)")
+		return false
+	}
+	return true
+}
+
+func (s *Server) accessibleEntry(w http.ResponseWriter, r *http.Request, key *Key, route string) (vault.Entry, bool) {
+	if !s.requireVault(w) {
+		return vault.Entry{}, false
+	}
+
+	entry, err := s.vault.Get(strings.TrimSpace(r.PathValue("id")))
+	if err != nil || !key.CanAccess(entry) {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return vault.Entry{}, false
+	}
+
+	// The API can neither ask a second person for approval nor post the
+	// retrieval notice, so entries that rely on either stay Discord-only.
+	if entry.RequiresApproval || entry.AnnounceChannelID != "" {
+		reason := "requires_approval"
+		if !entry.RequiresApproval {
+			reason = "announced"
+		}
+		logger.Warn("API key refused a Discord-only entry", "api_key_name", key.Name, "entry_id", entry.ID, "reason", reason)
+		s.recordAudit(key, route, audit.Event{
+			Action:  audit.ActionDenied,
+			Entry:   entry.ID,
+			Outcome: "denied",
+			Details: map[string]string{"name": entry.Name, "reason": reason},
+		})
+		writeError(w, http.StatusForbidden, "this entry requires approval or announces retrievals in Discord and cannot be used through the API")
+		return vault.Entry{}, false
+	}
+	return entry, true
+}
+
+func (s *Server) entryKey(w http.ResponseWriter, entry vault.Entry) (*totp.Key, bool) {
+	otpKey, err := s.vault.Key(entry)
+	if err != nil {
+		logger.Error("Failed to open vault entry", "entry_id", entry.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to open entry")
+		return nil, false
+	}
+	return otpKey, true
+}
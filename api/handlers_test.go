@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
+	"Discord-Bot-2FA-Key-Gen/config"
+	"Discord-Bot-2FA-Key-Gen/totp"
+	"Discord-Bot-2FA-Key-Gen/vault"
+)
+
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+type testServer struct {
+	server    *Server
+	vault     *vault.Vault
+	auditPath string
+	token     string
+	dir       string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+
+	keyBytes := make([]byte, 32)
+	keyring, err := vault.NewKeyring(1, map[int][]byte{1: keyBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := vault.Open(filepath.Join(dir, "vault.json"), keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditPath := filepath.Join(dir, "audit.log")
+	auditLog, err := audit.Open(auditPath, make([]byte, audit.MinKeyLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+
+	ts := &testServer{vault: v, auditPath: auditPath, dir: dir}
+	ts.token, err = NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keysPath := filepath.Join(dir, "api-keys.json")
+	key := &Key{
+		Name:        "ci",
+		TokenSHA256: HashToken(ts.token),
+		Scopes:      []Scope{ScopeCodesRead, ScopeCodesVerify, ScopeEntriesRead, ScopeEntriesWrite},
+	}
+	if err := AppendKey(keysPath, key); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.server, err = New(&config.Config{APIKeysPath: keysPath}, totp.New(), v, auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func (ts *testServer) reloadKey(t *testing.T, entries ...string) {
+	t.Helper()
+
+	keysPath := filepath.Join(ts.dir, "api-keys.json")
+	if err := os.Remove(keysPath); err != nil {
+		t.Fatal(err)
+	}
+	key := &Key{
+		Name:        "ci",
+		TokenSHA256: HashToken(ts.token),
+		Scopes:      []Scope{ScopeCodesRead, ScopeCodesVerify, ScopeEntriesRead, ScopeEntriesWrite},
+		Entries:     entries,
+	}
+	if err := AppendKey(keysPath, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.server.ReloadKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (ts *testServer) do(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	recorder := httptest.NewRecorder()
+	ts.server.httpServer.Handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func (ts *testServer) auditEvents(t *testing.T) []audit.Event {
+	t.Helper()
+
+	file, err := os.Open(ts.auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var events []audit.Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, record.Event)
+	}
+	return events
+}
+
+func (ts *testServer) addEntry(t *testing.T, owner, name string, change func(*vault.Entry)) vault.Entry {
+	t.Helper()
+
+	entry, err := ts.vault.Add(vault.Entry{Name: name, Owner: owner}, totp.NewKey("Acme", "ops", testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change != nil {
+		entry, err = ts.vault.Update(entry.ID, "u1", func(entry *vault.Entry) error {
+			change(entry)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return entry
+}
+
+func TestEntryCodeRefusesDiscordOnlyEntries(t *testing.T) {
+	tests := []struct {
+		name       string
+		change     func(*vault.Entry)
+		wantStatus int
+		wantReason string
+	}{
+		{"plain entry", nil, http.StatusOK, ""},
+		{"approval required", func(e *vault.Entry) { e.RequiresApproval = true; e.ApproverRoles = []string{"r1"} }, http.StatusForbidden, "requires_approval"},
+		{"announced", func(e *vault.Entry) { e.AnnounceChannelID = "c1" }, http.StatusForbidden, "announced"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			entry := ts.addEntry(t, vault.APIOwner("ci"), "registrar", tt.change)
+
+			for _, route := range []struct{ method, path, body string }{
+				{"GET", "/v1/entries/" + entry.ID + "/code", ""},
+				{"POST", "/v1/entries/" + entry.ID + "/verify", `{"code":"000000"}`},
+			} {
+				recorder := ts.do(t, route.method, route.path, route.body)
+				if recorder.Code != tt.wantStatus {
+					t.Fatalf("%s %s = %d, want %d: %s", route.method, route.path, recorder.Code, tt.wantStatus, recorder.Body)
+				}
+				if tt.wantStatus != http.StatusOK && strings.Contains(recorder.Body.String(), `"code"`) {
+					t.Errorf("refused response leaks a code: %s", recorder.Body)
+				}
+			}
+
+			if tt.wantReason == "" {
+				return
+			}
+			var denied int
+			for _, event := range ts.auditEvents(t) {
+				if event.Action == audit.ActionDenied && event.Entry == entry.ID && event.Details["reason"] == tt.wantReason {
+					denied++
+				}
+			}
+			if denied != 2 {
+				t.Errorf("%d denied audit records with reason %s, want 2", denied, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestKeyEntriesOnlyGrantAPIEntries(t *testing.T) {
+	ts := newTestServer(t)
+	shared := ts.addEntry(t, vault.GuildOwner("g1"), "registrar", nil)
+	personal := ts.addEntry(t, vault.UserOwner("u1"), "bank", nil)
+	other := ts.addEntry(t, vault.APIOwner("deploy"), "cloud", nil)
+	ts.reloadKey(t, shared.ID, personal.ID, other.ID)
+
+	tests := []struct {
+		name       string
+		entry      vault.Entry
+		wantStatus int
+	}{
+		{"server entry", shared, http.StatusNotFound},
+		{"user entry", personal, http.StatusNotFound},
+		{"other API key's entry", other, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := ts.do(t, "GET", "/v1/entries/"+tt.entry.ID+"/code", "")
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+		})
+	}
+
+	recorder := ts.do(t, "GET", "/v1/entries", "")
+	var body struct {
+		Entries []entryResponse `json:"entries"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Entries) != 1 || body.Entries[0].ID != other.ID {
+		t.Errorf("listed entries = %+v, want only %s", body.Entries, other.ID)
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"Discord-Bot-2FA-Key-Gen/config"
+	"Discord-Bot-2FA-Key-Gen/ratelimit"
+	"Discord-Bot-2FA-Key-Gen/vault"
+)
+
+type Scope string
+
+const (
+	ScopeCodesRead       Scope = "codes:read"
+	ScopeCodesVerify     Scope = "codes:verify"
+	ScopeSecretsGenerate Scope = "secrets:generate"
+	ScopeEntriesRead     Scope = "entries:read"
+	ScopeEntriesWrite    Scope = "entries:write"
+)
+
+var Scopes = []Scope{ScopeCodesRead, ScopeCodesVerify, ScopeSecretsGenerate, ScopeEntriesRead, ScopeEntriesWrite}
+
+type Key struct {
+	Name        string   `json:"name"`
+	TokenSHA256 string   `json:"token_sha256,omitempty"`
+	ClientCN    string   `json:"client_cn,omitempty"`
+	Scopes      []Scope  `json:"scopes"`
+	Entries     []string `json:"entries,omitempty"`
+	RateLimit   string   `json:"rate_limit,omitempty"`
+
+	limit ratelimit.Limit
+}
+
+func (k *Key) HasScope(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Keys can be given other API keys' entries, never a user's or a server's:
+// those are guarded by Discord roles and approvals that the API can't check.
+func (k *Key) CanAccess(entry vault.Entry) bool {
+	if entry.Owner == vault.APIOwner(k.Name) {
+		return true
+	}
+	return vault.IsAPIOwner(entry.Owner) && slices.Contains(k.Entries, entry.ID)
+}
+
+func (k *Key) matchesToken(token string) bool {
+	if k.TokenSHA256 == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(k.TokenSHA256)) == 1
+}
+
+func NewToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "2fa_" + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func LoadKeys(path string) ([]*Key, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	var keys []*Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys %s: %w", path, err)
+	}
+
+	names := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if err := key.validate(); err != nil {
+			return nil, fmt.Errorf("%s: key %q: %w", path, key.Name, err)
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("%s: duplicate key name %q", path, key.Name)
+		}
+		names[key.Name] = true
+	}
+	return keys, nil
+}
+
+func AppendKey(path string, key *Key) error {
+	if err := key.validate(); err != nil {
+		return err
+	}
+
+	keys, err := LoadKeys(path)
+	if err != nil {
+		return err
+	}
+	for _, existing := range keys {
+		if existing.Name == key.Name {
+			return fmt.Errorf("a key named %q already exists in %s", key.Name, path)
+		}
+	}
+	keys = append(keys, key)
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write API keys: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace API keys: %w", err)
+	}
+	return nil
+}
+
+func (k *Key) validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if k.TokenSHA256 == "" && k.ClientCN == "" {
+		return fmt.Errorf("token_sha256 or client_cn is required")
+	}
+	if k.TokenSHA256 != "" {
+		if raw, err := hex.DecodeString(k.TokenSHA256); err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("token_sha256 must be a hex SHA-256 digest")
+		}
+	}
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range k.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if k.RateLimit != "" {
+		limit, err := config.ParseRateLimit(k.RateLimit)
+		if err != nil {
+			return fmt.Errorf("rate_limit: %w", err)
+		}
+		k.limit = ratelimit.Limit(limit)
+	}
+	return nil
+}
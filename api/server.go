@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
+	"Discord-Bot-2FA-Key-Gen/config"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+	"Discord-Bot-2FA-Key-Gen/ratelimit"
+	"Discord-Bot-2FA-Key-Gen/totp"
+	"Discord-Bot-2FA-Key-Gen/vault"
+)
+
+type Server struct {
+	httpServer *http.Server
+	certPath   string
+	keyPath    string
+	keysPath   string
+	totp       *totp.Generator
+	vault      *vault.Vault
+	auditLog   *audit.Logger
+	limiter    *ratelimit.Limiter
+	keys       []*Key
+	mutex      sync.RWMutex
+}
+
+func New(cfg *config.Config, totpGen *totp.Generator, entries *vault.Vault, auditLog *audit.Logger) (*Server, error) {
+	s := &Server{
+		certPath: cfg.APITLSCertPath,
+		keyPath:  cfg.APITLSKeyPath,
+		keysPath: cfg.APIKeysPath,
+		totp:     totpGen,
+		vault:    entries,
+		auditLog: auditLog,
+		limiter:  ratelimit.New(ratelimit.Policy{User: ratelimit.Limit(cfg.APIRateLimit)}, ratelimit.LockoutPolicy{}, nil),
+	}
+	if err := s.ReloadKeys(); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/entries", s.authorize(ScopeEntriesRead, "entries.list", s.handleListEntries))
+	mux.HandleFunc("POST /v1/entries", s.authorize(ScopeEntriesWrite, "entries.create", s.handleCreateEntry))
+	mux.HandleFunc("DELETE /v1/entries/{id}", s.authorize(ScopeEntriesWrite, "entries.delete", s.handleDeleteEntry))
+	mux.HandleFunc("GET /v1/entries/{id}/code", s.authorize(ScopeCodesRead, "entries.code", s.handleEntryCode))
+	mux.HandleFunc("POST /v1/entries/{id}/verify", s.authorize(ScopeCodesVerify, "entries.verify", s.handleEntryVerify))
+	mux.HandleFunc("POST /v1/secrets", s.authorize(ScopeSecretsGenerate, "secrets.generate", s.handleGenerateSecret))
+	mux.HandleFunc("POST /v1/verify", s.authorize(ScopeCodesVerify, "verify", s.handleVerify))
+
+	s.httpServer = &http.Server{
+		Addr:              cfg.APIAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	if cfg.APIClientCAPath != "" {
+		pem, err := os.ReadFile(cfg.APIClientCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.APIClientCAPath)
+		}
+		s.httpServer.TLSConfig = &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return s, nil
+}
+
+func (s *Server) ReloadKeys() error {
+	keys, err := s.ReadKeys()
+	if err != nil {
+		return err
+	}
+	s.SetKeys(keys)
+	return nil
+}
+
+// ReadKeys parses the keys file without applying it.
+func (s *Server) ReadKeys() ([]*Key, error) {
+	return LoadKeys(s.keysPath)
+}
+
+func (s *Server) SetKeys(keys []*Key) {
+	s.mutex.Lock()
+	s.keys = keys
+	s.mutex.Unlock()
+
+	logger.Info("Loaded API keys", "path", s.keysPath, "count", len(keys))
+}
+
+func (s *Server) SetRateLimit(limit config.RateLimit) {
+	s.limiter.SetPolicy(ratelimit.Policy{User: ratelimit.Limit(limit)})
+}
+
+func (s *Server) Start() {
+	go func() {
+		var err error
+		if s.certPath != "" {
+			logger.Info("API server listening", "addr", s.httpServer.Addr, "tls", true, "client_certs", s.httpServer.TLSConfig != nil)
+			err = s.httpServer.ListenAndServeTLS(s.certPath, s.keyPath)
+		} else {
+			logger.Info("API server listening", "addr", s.httpServer.Addr, "tls", false)
+			err = s.httpServer.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("API server failed", "addr", s.httpServer.Addr, "error", err)
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+	return s.limiter.Close()
+}
+
+func (s *Server) authenticate(r *http.Request) *Key {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, key := range s.keys {
+			if key.ClientCN != "" && key.ClientCN == cn {
+				return key
+			}
+		}
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil
+	}
+	for _, key := range s.keys {
+		if key.matchesToken(token) {
+			return key
+		}
+	}
+	return nil
+}
+
+func (s *Server) authorize(scope Scope, route string, next func(w http.ResponseWriter, r *http.Request, key *Key)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		keyName := "-"
+		defer func() {
+			metrics.APIRequests.Inc(keyName, route, strconv.Itoa(recorder.status))
+		}()
+
+		key := s.authenticate(r)
+		if key == nil {
+			logger.Warn("Unauthorized API request", "route", route, "remote_addr", r.RemoteAddr)
+			writeError(recorder, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		keyName = key.Name
+
+		if !key.HasScope(scope) {
+			logger.Warn("API key is missing scope", "api_key_name", key.Name, "route", route, "scope", scope)
+			s.recordAudit(key, route, audit.Event{Action: audit.ActionDenied, Outcome: "missing_scope", Details: map[string]string{"scope": string(scope)}})
+			writeError(recorder, http.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", scope))
+			return
+		}
+
+		decision := s.limiter.Allow(ratelimit.Request{UserID: "api:" + key.Name, UserLimit: key.limit})
+		if !decision.Allowed {
+			recorder.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+			writeError(recorder, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		next(recorder, r, key)
+	}
+}
+
+func (s *Server) recordAudit(key *Key, route string, event audit.Event) {
+	event.ActorID = vault.APIOwner(key.Name)
+	event.Command = "api:" + route
+	if err := s.auditLog.Record(event); err != nil {
+		logger.Error("Failed to write audit record", "action", event.Action, "error", err)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, body any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("Failed to write HTTP response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,325 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionGenerate    Action = "generate"
+	ActionView        Action = "view"
+	ActionSave        Action = "save"
+	ActionShare       Action = "share"
+	ActionDelete      Action = "delete"
+	ActionDenied      Action = "denied"
+	ActionLockout     Action = "lockout"
+	ActionAdminGrant  Action = "admin_grant"
+	ActionAdminRevoke Action = "admin_revoke"
+	ActionAdminAction Action = "admin_action"
+	ActionGuildConfig Action = "guild_config"
+	ActionRotate      Action = "rotate"
+	ActionApproval    Action = "approval"
+	ActionBackupCodes Action = "backup_codes"
+)
+
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// MinKeyLength is the shortest HMAC key accepted for the chain.
+const MinKeyLength = 32
+
+var errShortKey = fmt.Errorf("audit HMAC key must be at least %d bytes", MinKeyLength)
+
+type Event struct {
+	Action    Action            `json:"action"`
+	ActorID   string            `json:"actor_id"`
+	ActorName string            `json:"actor_name,omitempty"`
+	GuildID   string            `json:"guild_id,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Entry     string            `json:"entry,omitempty"`
+	TargetID  string            `json:"target_id,omitempty"`
+	Outcome   string            `json:"outcome,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+type Record struct {
+	Seq      uint64    `json:"seq"`
+	Time     time.Time `json:"time"`
+	Event    Event     `json:"event"`
+	PrevHash string    `json:"prev_hash"`
+	Hash     string    `json:"hash"`
+}
+
+type head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+	MAC  string `json:"mac"`
+}
+
+type Logger struct {
+	path         string
+	key          []byte
+	file         *os.File
+	seq          uint64
+	lastHash     string
+	headRepaired bool
+	mutex        sync.Mutex
+}
+
+// Open verifies the log with key and appends to it. Every record hash and the
+// head are HMACs, so someone who can write the files but doesn't hold the key
+// can't rewrite the chain.
+func Open(path string, key []byte) (*Logger, error) {
+	if len(key) < MinKeyLength {
+		return nil, errShortKey
+	}
+	result, err := Verify(path, key)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("audit log failed verification: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	l := &Logger{
+		path:     path,
+		key:      key,
+		file:     file,
+		lastHash: genesisHash,
+	}
+	if result != nil {
+		l.seq = result.Records
+		l.lastHash = result.LastHash
+	}
+	if result != nil && result.HeadBehind {
+		if err := l.writeHead(); err != nil {
+			file.Close()
+			return nil, err
+		}
+		l.headRepaired = true
+	}
+	return l, nil
+}
+
+// HeadRepaired reports whether Open moved a head that was one record behind
+// the log, which happens when the bot stops between writing a record and
+// updating the head.
+func (l *Logger) HeadRepaired() bool {
+	return l != nil && l.headRepaired
+}
+
+func (l *Logger) Record(event Event) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+
+	record := Record{
+		Seq:      l.seq + 1,
+		Time:     time.Now().UTC(),
+		Event:    event,
+		PrevHash: l.lastHash,
+	}
+
+	hash, err := hashRecord(l.key, record)
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+
+	l.seq = record.Seq
+	l.lastHash = record.Hash
+	return l.writeHead()
+}
+
+func (l *Logger) writeHead() error {
+	h := head{Seq: l.seq, Hash: l.lastHash}
+	h.MAC = headMAC(l.key, h)
+	return writeHead(l.path, h)
+}
+
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func Fingerprint(secret string) string {
+	normalized := strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "_", "").Replace(secret))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:6])
+}
+
+type VerifyResult struct {
+	Records  uint64
+	LastHash string
+	// HeadBehind is set when the head points at the record before the last
+	// one; Open moves it forward.
+	HeadBehind bool
+}
+
+func Verify(path string, key []byte) (*VerifyResult, error) {
+	if len(key) < MinKeyLength {
+		return nil, errShortKey
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// Without a log, a head that has seen records means the log was deleted.
+		h, headErr := readHead(path)
+		switch {
+		case headErr == nil && h.Seq > 0:
+			return nil, fmt.Errorf("audit log is missing but head expects record %d, log has been deleted", h.Seq)
+		case headErr != nil && !os.IsNotExist(headErr):
+			return nil, fmt.Errorf("audit log is missing and its head can't be read: %v", headErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := &VerifyResult{LastHash: genesisHash}
+	prevHash := genesisHash
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return result, fmt.Errorf("record %d is not valid JSON: %w", result.Records+1, err)
+		}
+
+		if record.Seq != result.Records+1 {
+			return result, fmt.Errorf("record %d has sequence %d, records are missing or reordered", result.Records+1, record.Seq)
+		}
+		if record.PrevHash != result.LastHash {
+			return result, fmt.Errorf("record %d does not chain to the previous record", record.Seq)
+		}
+
+		expected, err := hashRecord(key, record)
+		if err != nil {
+			return result, err
+		}
+		if !hmac.Equal([]byte(record.Hash), []byte(expected)) {
+			return result, fmt.Errorf("record %d has been modified or was written with a different key", record.Seq)
+		}
+
+		prevHash = result.LastHash
+		result.Records = record.Seq
+		result.LastHash = record.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	h, err := readHead(path)
+	switch {
+	case os.IsNotExist(err):
+		// A missing head is only fine before the first record is complete.
+		h = head{Hash: genesisHash}
+		h.MAC = headMAC(key, h)
+	case err != nil:
+		return result, fmt.Errorf("failed to read audit head: %w", err)
+	}
+	if !hmac.Equal([]byte(h.MAC), []byte(headMAC(key, h))) {
+		return result, fmt.Errorf("audit head has been modified or was written with a different key")
+	}
+
+	switch {
+	case h.Seq == result.Records && h.Hash == result.LastHash:
+	case result.Records > 0 && h.Seq == result.Records-1 && h.Hash == prevHash:
+		result.HeadBehind = true
+	default:
+		return result, fmt.Errorf("audit log ends at record %d but head expects record %d, log has been truncated or rolled back", result.Records, h.Seq)
+	}
+
+	return result, nil
+}
+
+func hashRecord(key []byte, record Record) (string, error) {
+	record.Hash = ""
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func headMAC(key []byte, h head) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("head:" + strconv.FormatUint(h.Seq, 10) + ":" + h.Hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func headPath(path string) string {
+	return path + ".head"
+}
+
+func readHead(path string) (head, error) {
+	var h head
+	data, err := os.ReadFile(headPath(path))
+	if err != nil {
+		return h, err
+	}
+	err = json.Unmarshal(data, &h)
+	return h, err
+}
+
+func writeHead(path string, h head) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	tmp := headPath(path) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write audit head: %w", err)
+	}
+	if err := os.Rename(tmp, headPath(path)); err != nil {
+		return fmt.Errorf("failed to write audit head: %w", err)
+	}
+	return nil
+}
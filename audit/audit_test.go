@@ -0,0 +1,294 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{7}, MinKeyLength)
+
+func writeTestLog(t *testing.T, records int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx := range records {
+		if err := l.Record(Event{Action: ActionView, ActorID: "u1", Entry: string(rune('a' + idx))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rehash recomputes the hash of record idx with a guessed key, the way
+// someone without the real key would try to cover up an edit.
+func rehash(t *testing.T, lines []string, idx int, change func(*Record)) {
+	t.Helper()
+
+	var record Record
+	if err := json.Unmarshal([]byte(lines[idx]), &record); err != nil {
+		t.Fatal(err)
+	}
+	change(&record)
+	hash, err := hashRecord([]byte("attacker guess without the real key"), record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Hash = hash
+	line, _ := json.Marshal(record)
+	lines[idx] = string(line)
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name        string
+		tamper      func(t *testing.T, path string)
+		key         []byte
+		wantErr     string
+		wantRecords uint64
+		wantBehind  bool
+	}{
+		{
+			name:        "untouched log",
+			tamper:      func(t *testing.T, path string) {},
+			wantRecords: 3,
+		},
+		{
+			name: "edited record",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				lines[1] = strings.Replace(lines[1], `"actor_id":"u1"`, `"actor_id":"u2"`, 1)
+				writeLines(t, path, lines)
+			},
+			wantErr: "record 2 has been modified",
+		},
+		{
+			name: "edited record with a recomputed hash",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				rehash(t, lines, 2, func(r *Record) { r.Event.ActorID = "u2" })
+				writeLines(t, path, lines)
+			},
+			wantErr: "record 3 has been modified",
+		},
+		{
+			name: "removed record",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				writeLines(t, path, append(lines[:1], lines[2:]...))
+			},
+			wantErr: "records are missing or reordered",
+		},
+		{
+			name: "truncated log",
+			tamper: func(t *testing.T, path string) {
+				writeLines(t, path, readLines(t, path)[:1])
+			},
+			wantErr: "truncated or rolled back",
+		},
+		{
+			name: "truncated log with a rolled back head",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				writeLines(t, path, lines[:2])
+				var record Record
+				json.Unmarshal([]byte(lines[1]), &record)
+				h := head{Seq: record.Seq, Hash: record.Hash}
+				h.MAC = headMAC([]byte("attacker guess without the real key"), h)
+				if err := writeHead(path, h); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "audit head has been modified",
+		},
+		{
+			name: "head one record behind",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				var record Record
+				json.Unmarshal([]byte(lines[1]), &record)
+				h := head{Seq: record.Seq, Hash: record.Hash}
+				h.MAC = headMAC(testKey, h)
+				if err := writeHead(path, h); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantRecords: 3,
+			wantBehind:  true,
+		},
+		{
+			name: "head two records behind",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				var record Record
+				json.Unmarshal([]byte(lines[0]), &record)
+				h := head{Seq: record.Seq, Hash: record.Hash}
+				h.MAC = headMAC(testKey, h)
+				if err := writeHead(path, h); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "truncated or rolled back",
+		},
+		{
+			name: "missing head",
+			tamper: func(t *testing.T, path string) {
+				os.Remove(headPath(path))
+			},
+			wantErr: "truncated or rolled back",
+		},
+		{
+			name:    "different key",
+			tamper:  func(t *testing.T, path string) {},
+			key:     bytes.Repeat([]byte{8}, MinKeyLength),
+			wantErr: "record 1 has been modified or was written with a different key",
+		},
+		{
+			name:    "short key",
+			tamper:  func(t *testing.T, path string) {},
+			key:     []byte("short"),
+			wantErr: "at least 32 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestLog(t, 3)
+			tt.tamper(t, path)
+			key := testKey
+			if tt.key != nil {
+				key = tt.key
+			}
+
+			result, err := Verify(path, key)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify err = %v", err)
+			}
+			if result.Records != tt.wantRecords || result.HeadBehind != tt.wantBehind {
+				t.Errorf("Verify = %+v, want %d records, head behind %v", result, tt.wantRecords, tt.wantBehind)
+			}
+		})
+	}
+}
+
+func TestOpenRepairsHeadOneRecordBehind(t *testing.T) {
+	path := writeTestLog(t, 2)
+	lines := readLines(t, path)
+	var first Record
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	h := head{Seq: first.Seq, Hash: first.Hash}
+	h.MAC = headMAC(testKey, h)
+	if err := writeHead(path, h); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("Open with a head one record behind = %v", err)
+	}
+	if !l.HeadRepaired() {
+		t.Error("HeadRepaired = false, want true")
+	}
+	if err := l.Record(Event{Action: ActionView, ActorID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	result, err := Verify(path, testKey)
+	if err != nil || result.Records != 3 || result.HeadBehind {
+		t.Fatalf("Verify after repair = %+v, %v; want 3 records and an up to date head", result, err)
+	}
+}
+
+func TestOpenHeadMissingAfterFirstRecord(t *testing.T) {
+	path := writeTestLog(t, 1)
+	if err := os.Remove(headPath(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("Open = %v", err)
+	}
+	defer l.Close()
+	if !l.HeadRepaired() {
+		t.Error("HeadRepaired = false, want true")
+	}
+}
+
+func TestOpenRejectsShortKey(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "audit.log"), []byte("short")); err == nil {
+		t.Error("Open accepted a short key")
+	}
+}
+
+func TestOpenDetectsDeletedLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		records int
+		wantErr string
+	}{
+		{name: "fresh log"},
+		{name: "deleted log with its head", records: 2, wantErr: "head expects record 2, log has been deleted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestLog(t, tt.records)
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+
+			l, err := Open(path, testKey)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Open err = %v, want %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Error("Open recreated the deleted log")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open = %v", err)
+			}
+			l.Close()
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+type adminGrant struct {
+	UserID    string    `json:"user_id"`
+	GrantedBy string    `json:"granted_by"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+func loadAdminGrants(path string) (map[string]adminGrant, error) {
+	grants := make(map[string]adminGrant)
+	if path == "" {
+		return grants, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return grants, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin grants: %w", err)
+	}
+
+	var list []adminGrant
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse admin grants %s: %w", path, err)
+	}
+	for _, grant := range list {
+		grants[grant.UserID] = grant
+	}
+	return grants, nil
+}
+
+func saveAdminGrants(path string, grants map[string]adminGrant) error {
+	if path == "" {
+		return nil
+	}
+
+	list := make([]adminGrant, 0, len(grants))
+	for _, grant := range grants {
+		list = append(list, grant)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].UserID < list[b].UserID
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write admin grants: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace admin grants: %w", err)
+	}
+	return nil
+}
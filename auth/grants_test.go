@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Discord-Bot-2FA-Key-Gen/config"
+)
+
+func newTestChecker(t *testing.T, path string) *PermissionChecker {
+	t.Helper()
+
+	p, err := NewPermissionChecker(&config.Config{AdminGrantsPath: path, AdminUserIDs: []string{"owner"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAdminGrantsSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admins.json")
+	p := newTestChecker(t, path)
+
+	if err := p.GrantAdmin("owner", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.GrantAdmin("owner", "u2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RevokeAdmin("owner", "u2"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newTestChecker(t, path)
+	if !restarted.IsAdminUser("u1") {
+		t.Error("granted admin was lost on restart")
+	}
+	if restarted.IsAdminUser("u2") {
+		t.Error("revoked admin came back on restart")
+	}
+	if _, granted := restarted.ListAdmins(); len(granted) != 1 || granted[0] != "u1" {
+		t.Errorf("granted admins after restart = %v, want [u1]", granted)
+	}
+	if grant := restarted.grantedAdmins["u1"]; grant.GrantedBy != "owner" || grant.GrantedAt.IsZero() {
+		t.Errorf("grant after restart = %+v, want who and when", grant)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestAdminGrants(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     func(p *PermissionChecker) error
+		wantErr bool
+		wantIDs []string
+	}{
+		{"grant", func(p *PermissionChecker) error { return p.GrantAdmin("owner", "u1") }, false, []string{"u1"}},
+		{"grant twice", func(p *PermissionChecker) error {
+			p.GrantAdmin("owner", "u1")
+			return p.GrantAdmin("owner", "u1")
+		}, true, []string{"u1"}},
+		{"grant a configured admin", func(p *PermissionChecker) error { return p.GrantAdmin("owner", "owner") }, true, nil},
+		{"revoke without a grant", func(p *PermissionChecker) error { return p.RevokeAdmin("owner", "u1") }, true, nil},
+		{"revoke a configured admin", func(p *PermissionChecker) error { return p.RevokeAdmin("u1", "owner") }, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestChecker(t, filepath.Join(t.TempDir(), "admins.json"))
+			if err := tt.run(p); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, granted := p.ListAdmins(); len(granted) != len(tt.wantIDs) || (len(granted) > 0 && granted[0] != tt.wantIDs[0]) {
+				t.Errorf("granted = %v, want %v", granted, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestAdminGrantRolledBackWhenSaveFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "admins.json")
+	p := newTestChecker(t, path)
+
+	if err := p.GrantAdmin("owner", "u1"); err == nil {
+		t.Fatal("GrantAdmin succeeded without a writable file")
+	}
+	if p.IsAdminUser("u1") {
+		t.Error("failed grant still took effect")
+	}
+}
+
+func TestAdminGrantsRejectCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admins.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPermissionChecker(&config.Config{AdminGrantsPath: path}, nil, nil); err == nil {
+		t.Error("NewPermissionChecker accepted a corrupt grants file")
+	}
+}
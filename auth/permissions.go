@@ -1,20 +1,42 @@
 package auth
 
 import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
 	"Discord-Bot-2FA-Key-Gen/config"
+	"Discord-Bot-2FA-Key-Gen/guild"
 	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+	"Discord-Bot-2FA-Key-Gen/vault"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 type PermissionChecker struct {
-	config *config.Config
+	config        *config.Config
+	auditLog      *audit.Logger
+	guilds        *guild.Store
+	grantsPath    string
+	grantedAdmins map[string]adminGrant
+	mutex         sync.RWMutex
 }
 
-func NewPermissionChecker(cfg *config.Config) *PermissionChecker {
-	return &PermissionChecker{
-		config: cfg,
+func NewPermissionChecker(cfg *config.Config, auditLog *audit.Logger, guilds *guild.Store) (*PermissionChecker, error) {
+	grants, err := loadAdminGrants(cfg.AdminGrantsPath)
+	if err != nil {
+		return nil, err
 	}
+	return &PermissionChecker{
+		config:        cfg,
+		auditLog:      auditLog,
+		guilds:        guilds,
+		grantsPath:    cfg.AdminGrantsPath,
+		grantedAdmins: grants,
+	}, nil
 }
 
 func (p *PermissionChecker) HasPermission(_ *discordgo.Session, i *discordgo.InteractionCreate) bool {
@@ -25,43 +47,265 @@ func (p *PermissionChecker) HasPermission(_ *discordgo.Session, i *discordgo.Int
 
 	userID := i.Member.User.ID
 
-	if userID == p.config.DevUserID {
-		logger.Debug("Dev user access granted:", userID)
+	if p.IsAdmin(i) {
+		logger.Debug("Admin access granted", "user_id", userID)
 		return true
 	}
 
-	if len(p.config.AllowedRoles) == 0 {
+	allowedRoles := p.GuildSettings(i.GuildID).AllowedRoles
+	if len(allowedRoles) == 0 {
+		allowedRoles = p.currentConfig().AllowedRoles
+	}
+
+	if len(allowedRoles) == 0 {
 		logger.Debug("No role restrictions configured, allowing access")
 		return true
 	}
 
 	if i.Member.Roles == nil {
-		logger.Debug("User has no roles:", userID)
+		logger.Debug("User has no roles", "user_id", userID)
 		return false
 	}
 
-	userRoles := make(map[string]bool)
-	for _, roleID := range i.Member.Roles {
-		if roleID != "" {
-			userRoles[roleID] = true
-		}
+	if role, ok := hasAnyRole(i.Member.Roles, allowedRoles); ok {
+		logger.Debug("User has allowed role", "user_id", userID, "role_id", role)
+		return true
 	}
 
-	for _, allowedRole := range p.config.AllowedRoles {
-		if allowedRole != "" && userRoles[allowedRole] {
-			logger.Debug("User has allowed role:", userID, allowedRole)
-			return true
-		}
+	logger.Warn("Access denied, missing required roles", "user_id", userID, "guild_id", i.GuildID)
+	return false
+}
+
+func (p *PermissionChecker) IsAdmin(i *discordgo.InteractionCreate) bool {
+	if i.Member == nil || i.Member.User == nil {
+		return false
 	}
 
-	logger.Warn("Access denied for user:", userID, "- missing required roles")
-	return false
+	if p.IsAdminUser(i.Member.User.ID) {
+		return true
+	}
+
+	_, ok := hasAnyRole(i.Member.Roles, p.currentConfig().AdminRoles)
+	return ok
+}
+
+func (p *PermissionChecker) IsGuildManager(i *discordgo.InteractionCreate) bool {
+	if p.IsAdmin(i) {
+		return true
+	}
+	if i.GuildID == "" || i.Member == nil {
+		return false
+	}
+	return i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0
+}
+
+func (p *PermissionChecker) CanUseSharedEntry(i *discordgo.InteractionCreate, entry vault.Entry) bool {
+	if entry.Owner != vault.GuildOwner(i.GuildID) {
+		return false
+	}
+	if p.CanManageSharedEntry(i, entry) {
+		return true
+	}
+	_, ok := hasAnyRole(i.Member.Roles, entry.AccessRoles)
+	return ok
+}
+
+func (p *PermissionChecker) CanManageSharedEntry(i *discordgo.InteractionCreate, entry vault.Entry) bool {
+	if entry.Owner != vault.GuildOwner(i.GuildID) {
+		return false
+	}
+	if p.IsGuildManager(i) {
+		return true
+	}
+	_, ok := hasAnyRole(i.Member.Roles, entry.ManagerRoles)
+	return ok
+}
+
+func (p *PermissionChecker) CanApproveSharedEntry(i *discordgo.InteractionCreate, entry vault.Entry) bool {
+	if entry.Owner != vault.GuildOwner(i.GuildID) || i.Member == nil {
+		return false
+	}
+	_, ok := hasAnyRole(i.Member.Roles, entry.ApproverRoles)
+	return ok
+}
+
+func (p *PermissionChecker) GuildSettings(guildID string) guild.Settings {
+	return p.guilds.Get(guildID)
+}
+
+func (p *PermissionChecker) UpdateGuildSettings(guildID, actorID string, change func(*guild.Settings) error) (guild.Settings, error) {
+	return p.guilds.Update(guildID, actorID, change)
+}
+
+func (p *PermissionChecker) ResetGuildSettings(guildID string) error {
+	return p.guilds.Reset(guildID)
+}
+
+func (p *PermissionChecker) CheckGuildPolicy(i *discordgo.InteractionCreate, command string) string {
+	if i.GuildID == "" {
+		return ""
+	}
+
+	settings := p.GuildSettings(i.GuildID)
+	if !settings.CommandEnabled(command) {
+		return fmt.Sprintf("`/%s` is disabled on this server.", command)
+	}
+	if !settings.ChannelAllowed(i.ChannelID) {
+		return "This command can't be used in this channel."
+	}
+	return ""
+}
+
+func (p *PermissionChecker) IsAdminUser(userID string) bool {
+	if p.isConfiguredAdmin(userID) {
+		return true
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	_, ok := p.grantedAdmins[userID]
+	return ok
+}
+
+// GrantsPersisted reports whether runtime grants survive a restart.
+func (p *PermissionChecker) GrantsPersisted() bool {
+	return p.grantsPath != ""
+}
+
+func (p *PermissionChecker) GrantAdmin(actorID, userID string) error {
+	if p.isConfiguredAdmin(userID) {
+		return fmt.Errorf("user is already a configured administrator")
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.grantedAdmins[userID]; ok {
+		return fmt.Errorf("user is already an administrator")
+	}
+	p.grantedAdmins[userID] = adminGrant{UserID: userID, GrantedBy: actorID, GrantedAt: time.Now().UTC()}
+	if err := saveAdminGrants(p.grantsPath, p.grantedAdmins); err != nil {
+		delete(p.grantedAdmins, userID)
+		return err
+	}
+
+	p.LogAdminChange(actorID, userID, "grant")
+	return nil
+}
+
+func (p *PermissionChecker) RevokeAdmin(actorID, userID string) error {
+	if p.isConfiguredAdmin(userID) {
+		return fmt.Errorf("configured administrators can only be removed from the configuration")
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	grant, ok := p.grantedAdmins[userID]
+	if !ok {
+		return fmt.Errorf("user is not an administrator")
+	}
+	delete(p.grantedAdmins, userID)
+	if err := saveAdminGrants(p.grantsPath, p.grantedAdmins); err != nil {
+		p.grantedAdmins[userID] = grant
+		return err
+	}
+
+	p.LogAdminChange(actorID, userID, "revoke")
+	return nil
+}
+
+func (p *PermissionChecker) ListAdmins() (configured, granted []string) {
+	configured = append(configured, p.currentConfig().AdminUserIDs...)
+
+	p.mutex.RLock()
+	for userID := range p.grantedAdmins {
+		granted = append(granted, userID)
+	}
+	p.mutex.RUnlock()
+
+	sort.Strings(granted)
+	return configured, granted
+}
+
+func (p *PermissionChecker) UpdateConfig(cfg *config.Config) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.config = cfg
+}
+
+func (p *PermissionChecker) currentConfig() *config.Config {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.config
 }
 
 func (p *PermissionChecker) LogUnauthorizedAccess(userID, username, command string) {
-	logger.Warn("Unauthorized access attempt:",
-		"UserID:", userID,
-		"Username:", username,
-		"Command:", command,
+	logger.Warn("Unauthorized access attempt",
+		"user_id", userID,
+		"username", username,
+		"command", command,
+	)
+
+	metrics.PermissionDenials.Inc(command)
+	p.recordAudit(audit.Event{
+		Action:    audit.ActionDenied,
+		ActorID:   userID,
+		ActorName: username,
+		Command:   command,
+		Outcome:   "denied",
+	})
+}
+
+func (p *PermissionChecker) LogAdminChange(actorID, targetID, action string) {
+	logger.Info("Admin change",
+		"action", action,
+		"actor_id", actorID,
+		"target_id", targetID,
 	)
+
+	auditAction := audit.ActionAdminGrant
+	if action == "revoke" {
+		auditAction = audit.ActionAdminRevoke
+	}
+	p.recordAudit(audit.Event{
+		Action:   auditAction,
+		ActorID:  actorID,
+		TargetID: targetID,
+		Command:  "2fa-admin",
+		Outcome:  "success",
+	})
+}
+
+func (p *PermissionChecker) recordAudit(event audit.Event) {
+	if err := p.auditLog.Record(event); err != nil {
+		logger.Error("Failed to write audit record", "action", event.Action, "error", err)
+	}
+}
+
+func (p *PermissionChecker) isConfiguredAdmin(userID string) bool {
+	for _, adminID := range p.currentConfig().AdminUserIDs {
+		if adminID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyRole(memberRoles, wanted []string) (string, bool) {
+	userRoles := make(map[string]bool)
+	for _, roleID := range memberRoles {
+		if roleID != "" {
+			userRoles[roleID] = true
+		}
+	}
+
+	for _, role := range wanted {
+		if role != "" && userRoles[role] {
+			return role, true
+		}
+	}
+	return "", false
 }
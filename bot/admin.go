@@ -0,0 +1,204 @@
+package bot
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func (h *CommandHandler) Handle2FAAdmin(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in 2FA admin handler", "panic", r)
+			h.respondWithError(s, i, "An unexpected error occurred. Please try again later.")
+		}
+	}()
+
+	if !h.validateInteraction(s, i) {
+		return
+	}
+
+	userID := i.Member.User.ID
+
+	if !h.permChecker.IsAdmin(i) {
+		h.denyAccess(s, i, "2fa-admin")
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		h.respondWithError(s, i, "Please choose an admin action.")
+		return
+	}
+
+	subcommand := options[0]
+	var message string
+
+	switch subcommand.Name {
+	case "grant":
+		targetID := userOptionID(subcommand.Options, "user")
+		if targetID == "" {
+			h.respondWithError(s, i, "Please provide a user.")
+			return
+		}
+		if err := h.permChecker.GrantAdmin(userID, targetID); err != nil {
+			metrics.CommandsTotal.Inc("2fa-admin", "error")
+			h.respondWithError(s, i, fmt.Sprintf("Could not grant admin: %s.", err))
+			return
+		}
+		message = fmt.Sprintf("Granted administrator access to <@%s>.", targetID)
+		if !h.permChecker.GrantsPersisted() {
+			message += " The grant lasts until the bot restarts because `ADMIN_GRANTS_PATH` is empty."
+		}
+	case "revoke":
+		targetID := userOptionID(subcommand.Options, "user")
+		if targetID == "" {
+			h.respondWithError(s, i, "Please provide a user.")
+			return
+		}
+		if err := h.permChecker.RevokeAdmin(userID, targetID); err != nil {
+			metrics.CommandsTotal.Inc("2fa-admin", "error")
+			h.respondWithError(s, i, fmt.Sprintf("Could not revoke admin: %s.", err))
+			return
+		}
+		message = fmt.Sprintf("Revoked administrator access from <@%s>.", targetID)
+	case "list":
+		configured, granted := h.permChecker.ListAdmins()
+		message = fmt.Sprintf("**Configured administrators:** %s\n**Granted administrators:** %s",
+			formatUserMentions(configured), formatUserMentions(granted))
+	case "reset-cooldown":
+		targetID := userOptionID(subcommand.Options, "user")
+		if targetID == "" {
+			h.respondWithError(s, i, "Please provide a user.")
+			return
+		}
+		h.rateLimiter.Reset(targetID)
+		logger.Info("Cooldown reset by admin", "actor_id", userID, "target_id", targetID)
+		h.recordAudit(audit.Event{
+			Action:   audit.ActionAdminAction,
+			ActorID:  userID,
+			GuildID:  i.GuildID,
+			Command:  "2fa-admin",
+			TargetID: targetID,
+			Outcome:  "success",
+			Details:  map[string]string{"action": "reset-cooldown"},
+		})
+		message = fmt.Sprintf("Cleared the rate limits for <@%s>.", targetID)
+	case "clear-lockout":
+		targetID := userOptionID(subcommand.Options, "user")
+		if targetID == "" {
+			h.respondWithError(s, i, "Please provide a user.")
+			return
+		}
+		wasLocked := h.rateLimiter.ClearLockout(targetID)
+		logger.Info("Lockout cleared by admin", "actor_id", userID, "target_id", targetID, "was_locked", wasLocked)
+		h.recordAudit(audit.Event{
+			Action:   audit.ActionAdminAction,
+			ActorID:  userID,
+			GuildID:  i.GuildID,
+			Command:  "2fa-admin",
+			TargetID: targetID,
+			Outcome:  "success",
+			Details:  map[string]string{"action": "clear-lockout"},
+		})
+		if wasLocked {
+			message = fmt.Sprintf("Lifted the lockout for <@%s>.", targetID)
+		} else {
+			message = fmt.Sprintf("<@%s> was not locked out; their failure history has been cleared.", targetID)
+		}
+	case "vault-status":
+		if h.vault == nil {
+			h.respondWithError(s, i, "Shared entries are not enabled on this bot.")
+			return
+		}
+		message = formatVaultKeys(h.vault.ActiveKeyVersion(), h.vault.KeyVersions())
+	case "vault-rewrap":
+		if h.vault == nil {
+			h.respondWithError(s, i, "Shared entries are not enabled on this bot.")
+			return
+		}
+		rewrapped, err := h.vault.Rewrap()
+		if err != nil {
+			logger.Error("Failed to re-wrap vault data keys", "actor_id", userID, "error", err)
+			metrics.CommandsTotal.Inc("2fa-admin", "error")
+			h.respondWithError(s, i, "Failed to re-wrap the vault data keys; nothing was changed.")
+			return
+		}
+		logger.Info("Vault data keys re-wrapped by admin", "actor_id", userID, "rewrapped", rewrapped)
+		h.recordAudit(audit.Event{
+			Action:  audit.ActionAdminAction,
+			ActorID: userID,
+			GuildID: i.GuildID,
+			Command: "2fa-admin",
+			Outcome: "success",
+			Details: map[string]string{
+				"action":      "vault-rewrap",
+				"rewrapped":   strconv.Itoa(rewrapped),
+				"key_version": strconv.Itoa(h.vault.ActiveKeyVersion()),
+			},
+		})
+		message = fmt.Sprintf("Re-wrapped %d data key(s).\n%s", rewrapped,
+			formatVaultKeys(h.vault.ActiveKeyVersion(), h.vault.KeyVersions()))
+	default:
+		h.respondWithError(s, i, "Unknown admin action.")
+		return
+	}
+
+	metrics.CommandsTotal.Inc("2fa-admin", "success")
+	h.respondWithMessage(s, i, message)
+}
+
+func userOptionID(options []*discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	for _, option := range options {
+		if option.Name == name {
+			return option.UserValue(nil).ID
+		}
+	}
+	return ""
+}
+
+func (h *CommandHandler) respondWithMessage(s *discordgo.Session, i *discordgo.InteractionCreate, message string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: message,
+			Flags:   discordgo.MessageFlagsEphemeral,
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Parse: []discordgo.AllowedMentionType{},
+			},
+		},
+	})
+
+	if err != nil {
+		logger.Error("Failed to send response", "interaction_id", i.ID, "error", err)
+	}
+}
+
+func formatUserMentions(userIDs []string) string {
+	return formatMentions(userIDs, "<@%s>", "none")
+}
+
+func formatVaultKeys(active int, entries map[int]int) string {
+	versions := slices.Sorted(maps.Keys(entries))
+	parts := make([]string, 0, len(versions))
+	for _, version := range slices.Backward(versions) {
+		parts = append(parts, fmt.Sprintf("v%d: %d", version, entries[version]))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "no entries")
+	}
+
+	message := fmt.Sprintf("**Active key version:** %d\n**Entries by key version:** %s", active, strings.Join(parts, ", "))
+	if len(versions) > 1 || (len(versions) == 1 && versions[0] != active) {
+		message += "\nSome data keys are still wrapped by an older key. Run `/2fa-admin vault-rewrap` before removing it from `ENTRY_VAULT_OLD_KEYS`."
+	}
+	return message
+}
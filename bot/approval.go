@@ -0,0 +1,438 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+	"Discord-Bot-2FA-Key-Gen/vault"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	approvalPrefix = "2fa-approval:"
+
+	interactionTokenLifetime = 14 * time.Minute
+)
+
+type approvalRequest struct {
+	id            string
+	entryID       string
+	entryName     string
+	guildID       string
+	requesterID   string
+	requesterName string
+	interaction   *discordgo.Interaction
+	dm            bool
+	channelID     string
+	messageID     string
+	created       time.Time
+	timer         *time.Timer
+}
+
+type approvalQueue struct {
+	timeout  time.Duration
+	pending  map[string]*approvalRequest
+	closed   bool
+	expiring sync.WaitGroup
+	mutex    sync.Mutex
+}
+
+func newApprovalQueue(timeout time.Duration) *approvalQueue {
+	return &approvalQueue{
+		timeout: timeout,
+		pending: make(map[string]*approvalRequest),
+	}
+}
+
+func (q *approvalQueue) add(req *approvalRequest, expire func()) (time.Time, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return time.Time{}, false
+	}
+	q.pending[req.id] = req
+	// Every timer counts as running until it is stopped or its callback
+	// returns, so close can wait for expiries that already started.
+	q.expiring.Add(1)
+	req.timer = time.AfterFunc(q.timeout, func() {
+		defer q.expiring.Done()
+		expire()
+	})
+	return req.created.Add(q.timeout), true
+}
+
+func (q *approvalQueue) get(id string) *approvalRequest {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.pending[id]
+}
+
+func (q *approvalQueue) take(id string) *approvalRequest {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	req, ok := q.pending[id]
+	if !ok {
+		return nil
+	}
+	delete(q.pending, id)
+	q.stop(req)
+	return req
+}
+
+func (q *approvalQueue) stop(req *approvalRequest) {
+	if req.timer.Stop() {
+		q.expiring.Done()
+	}
+}
+
+// close stops the timers of every pending request and returns them; no
+// request can be added afterwards.
+func (q *approvalQueue) close() []*approvalRequest {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	reqs := make([]*approvalRequest, 0, len(q.pending))
+	for id, req := range q.pending {
+		delete(q.pending, id)
+		q.stop(req)
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+func (q *approvalQueue) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		q.expiring.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *CommandHandler) SetApprovalTimeout(timeout time.Duration) {
+	h.approvals.mutex.Lock()
+	defer h.approvals.mutex.Unlock()
+
+	h.approvals.timeout = timeout
+}
+
+func (h *CommandHandler) requestApproval(s *discordgo.Session, i *discordgo.InteractionCreate, entry vault.Entry, dm bool) {
+	if entry.ApprovalChannelID == "" || len(entry.ApproverRoles) == 0 {
+		metrics.CommandsTotal.Inc("2fa-shared", "error")
+		h.respondWithError(s, i, "This entry requires approval, but no approvers channel or role is configured. Ask an entry manager to run `/2fa-shared approval`.")
+		return
+	}
+
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		h.respondWithError(s, i, "Failed to create the approval request.")
+		return
+	}
+	req := &approvalRequest{
+		id:            hex.EncodeToString(raw),
+		entryID:       entry.ID,
+		entryName:     entry.Name,
+		guildID:       i.GuildID,
+		requesterID:   i.Member.User.ID,
+		requesterName: i.Member.User.Username,
+		interaction:   i.Interaction,
+		dm:            dm,
+		channelID:     entry.ApprovalChannelID,
+		created:       time.Now(),
+	}
+
+	message, err := s.ChannelMessageSendComplex(entry.ApprovalChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("%s: <@%s> is requesting a code for the shared entry **%s** from <#%s>.",
+			formatMentions(entry.ApproverRoles, "<@&%s>", ""), req.requesterID, entry.Name, i.ChannelID),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse: []discordgo.AllowedMentionType{},
+			Roles: entry.ApproverRoles,
+		},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Approve", Style: discordgo.SuccessButton, CustomID: approvalPrefix + "approve:" + req.id},
+				discordgo.Button{Label: "Deny", Style: discordgo.DangerButton, CustomID: approvalPrefix + "deny:" + req.id},
+			}},
+		},
+	})
+	if err != nil {
+		logger.Error("Failed to post approval request", "channel_id", entry.ApprovalChannelID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-shared", "error")
+		h.respondWithError(s, i, "Failed to post the approval request.")
+		return
+	}
+	req.messageID = message.ID
+
+	expires, ok := h.approvals.add(req, func() {
+		h.expireApproval(s, req.id)
+	})
+	if !ok {
+		h.editApprovalMessage(s, req, fmt.Sprintf("<@%s>'s request for **%s** was cancelled because the bot is restarting.", req.requesterID, entry.Name))
+		h.respondWithError(s, i, "The bot is restarting. Please try again in a moment.")
+		return
+	}
+
+	delivery := "here"
+	if dm {
+		delivery = "by direct message"
+	}
+	h.respondWithMessage(s, i, fmt.Sprintf("**%s** requires approval. Your request was sent to the approvers and expires <t:%d:R>; the code will be delivered %s once it is approved.",
+		entry.Name, expires.Unix(), delivery))
+
+	h.recordApproval(req, req.requesterID, req.requesterName, "requested")
+	metrics.CommandsTotal.Inc("2fa-shared", "pending")
+	logger.Info("Shared code approval requested", "user_id", req.requesterID, "guild_id", req.guildID, "entry_id", entry.ID, "request_id", req.id)
+}
+
+func (h *CommandHandler) HandleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in component handler", "panic", r)
+			h.respondWithError(s, i, "An unexpected error occurred. Please try again later.")
+		}
+	}()
+
+	customID := i.MessageComponentData().CustomID
+	rest, ok := strings.CutPrefix(customID, approvalPrefix)
+	if !ok {
+		logger.Warn("Unknown component interaction", "custom_id", customID)
+		h.respondWithError(s, i, "This button is no longer supported.")
+		return
+	}
+	if !h.validateInteraction(s, i) {
+		return
+	}
+
+	decision, id, _ := strings.Cut(rest, ":")
+	req := h.approvals.get(id)
+	if req == nil || h.vault == nil {
+		h.respondWithError(s, i, "This approval request has expired or was already handled.")
+		return
+	}
+
+	entry, err := h.vault.Get(req.entryID)
+	if err != nil {
+		h.approvals.take(id)
+		h.closeApprovalMessage(s, i, req, "The shared entry was deleted before the request was handled.")
+		h.deliverToRequester(s, req, fmt.Sprintf("Your request for **%s** was cancelled because the entry was deleted.", req.entryName))
+		return
+	}
+
+	approverID := i.Member.User.ID
+	if approverID == req.requesterID {
+		h.respondWithError(s, i, "You can't approve or deny your own request.")
+		return
+	}
+	if !h.permChecker.CanApproveSharedEntry(i, entry) {
+		h.denyAccess(s, i, "2fa-shared")
+		return
+	}
+
+	if h.approvals.take(id) == nil {
+		h.respondWithError(s, i, "This approval request has expired or was already handled.")
+		return
+	}
+
+	if decision != "approve" {
+		h.closeApprovalMessage(s, i, req, fmt.Sprintf("Denied by <@%s>.", approverID))
+		h.deliverToRequester(s, req, fmt.Sprintf("Your request for a **%s** code was denied by <@%s>.", entry.Name, approverID))
+		h.recordApproval(req, approverID, i.Member.User.Username, "denied")
+		logger.Info("Shared code approval denied", "approver_id", approverID, "request_id", req.id, "entry_id", entry.ID)
+		return
+	}
+
+	// Roles can change while a request waits, so the requester's access is
+	// checked again against their current membership before the code leaves.
+	requester, err := requesterInteraction(s, req)
+	if err != nil || !h.permChecker.CanUseSharedEntry(requester, entry) {
+		if err != nil {
+			logger.Warn("Failed to look up requester for approved request", "request_id", req.id, "user_id", req.requesterID, "error", err)
+		}
+		h.closeApprovalMessage(s, i, req, fmt.Sprintf("Approved by <@%s>, but <@%s> no longer has access to this entry.", approverID, req.requesterID))
+		h.deliverToRequester(s, req, fmt.Sprintf("Your request for **%s** was approved, but you no longer have access to this entry.", entry.Name))
+		h.recordApproval(req, approverID, i.Member.User.Username, "refused")
+		logger.Warn("Shared code approval refused, requester lost access", "approver_id", approverID, "request_id", req.id, "entry_id", entry.ID, "user_id", req.requesterID)
+		return
+	}
+
+	key, err := h.vault.Key(entry)
+	var code string
+	if err == nil {
+		code, err = key.Code(time.Now())
+	}
+	if err != nil {
+		logger.Error("Failed to generate code for approved request", "entry_id", entry.ID, "error", err)
+		h.closeApprovalMessage(s, i, req, fmt.Sprintf("Approved by <@%s>, but the code could not be generated.", approverID))
+		h.deliverToRequester(s, req, fmt.Sprintf("Your request for **%s** was approved, but the code could not be generated. Please try again.", entry.Name))
+		return
+	}
+	expires := time.Now().Add(key.Remaining(time.Now()))
+
+	h.closeApprovalMessage(s, i, req, fmt.Sprintf("Approved by <@%s>.", approverID))
+	h.deliverToRequester(s, req, fmt.Sprintf("Your request was approved by <@%s>.\n**%s**\nCode: `%s %s`\nExpires <t:%d:R>",
+		approverID, entry.Name, code[:len(code)/2], code[len(code)/2:], expires.Unix()))
+
+	h.recordApproval(req, approverID, i.Member.User.Username, "approved")
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionView,
+		ActorID:   req.requesterID,
+		ActorName: req.requesterName,
+		GuildID:   req.guildID,
+		Command:   "2fa-shared",
+		Entry:     entry.ID,
+		Outcome:   "success",
+		Details:   map[string]string{"name": entry.Name, "approved_by": approverID},
+	})
+	h.announceSharedCode(s, &discordgo.InteractionCreate{Interaction: req.interaction}, entry)
+	logger.Info("Shared code approval granted", "approver_id", approverID, "request_id", req.id, "entry_id", entry.ID)
+}
+
+// requesterInteraction rebuilds the requester's side of a request from
+// their current guild membership. Fetched members carry no permissions, so
+// those are derived from the guild's roles as Discord would.
+func requesterInteraction(s *discordgo.Session, req *approvalRequest) (*discordgo.InteractionCreate, error) {
+	member, err := s.GuildMember(req.guildID, req.requesterID)
+	if err != nil {
+		return nil, err
+	}
+	g, err := s.State.Guild(req.guildID)
+	if err != nil {
+		if g, err = s.Guild(req.guildID); err != nil {
+			return nil, err
+		}
+	}
+	member.Permissions = memberPermissions(g, member)
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{GuildID: req.guildID, Member: member}}, nil
+}
+
+func memberPermissions(g *discordgo.Guild, member *discordgo.Member) int64 {
+	if member.User != nil && member.User.ID == g.OwnerID {
+		return discordgo.PermissionAll
+	}
+	var permissions int64
+	for _, role := range g.Roles {
+		if role.ID == g.ID || slices.Contains(member.Roles, role.ID) {
+			permissions |= role.Permissions
+		}
+	}
+	if permissions&discordgo.PermissionAdministrator != 0 {
+		return discordgo.PermissionAll
+	}
+	return permissions
+}
+
+func (h *CommandHandler) expireApproval(s *discordgo.Session, id string) {
+	req := h.approvals.take(id)
+	if req == nil {
+		return
+	}
+
+	h.editApprovalMessage(s, req, fmt.Sprintf("<@%s>'s request for **%s** expired without a decision.", req.requesterID, req.entryName))
+	h.deliverToRequester(s, req, fmt.Sprintf("Your request for a **%s** code expired without approval.", req.entryName))
+	h.recordApproval(req, req.requesterID, req.requesterName, "expired")
+	logger.Info("Shared code approval expired", "request_id", req.id, "entry_id", req.entryID)
+}
+
+// CloseApprovals cancels the requests still waiting for a decision, so no
+// expiry fires once the audit log and the gateway are closed, and waits for
+// expiries that were already running.
+func (h *CommandHandler) CloseApprovals(ctx context.Context, s *discordgo.Session) error {
+	for _, req := range h.approvals.close() {
+		h.editApprovalMessage(s, req, fmt.Sprintf("<@%s>'s request for **%s** was cancelled because the bot restarted.", req.requesterID, req.entryName))
+		h.deliverToRequester(s, req, fmt.Sprintf("Your request for a **%s** code was cancelled because the bot restarted. Please request it again.", req.entryName))
+		h.recordApproval(req, req.requesterID, req.requesterName, "cancelled")
+		logger.Info("Shared code approval cancelled by shutdown", "request_id", req.id, "entry_id", req.entryID)
+	}
+	return h.approvals.wait(ctx)
+}
+
+func (h *CommandHandler) editApprovalMessage(s *discordgo.Session, req *approvalRequest, content string) {
+	components := []discordgo.MessageComponent{}
+	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         req.messageID,
+		Channel:    req.channelID,
+		Content:    &content,
+		Components: &components,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse: []discordgo.AllowedMentionType{},
+		},
+	})
+	if err != nil {
+		logger.Error("Failed to close approval request", "request_id", req.id, "error", err)
+	}
+}
+
+func (h *CommandHandler) closeApprovalMessage(s *discordgo.Session, i *discordgo.InteractionCreate, req *approvalRequest, outcome string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    fmt.Sprintf("<@%s>'s request for **%s**: %s", req.requesterID, req.entryName, outcome),
+			Components: []discordgo.MessageComponent{},
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Parse: []discordgo.AllowedMentionType{},
+			},
+		},
+	})
+	if err != nil {
+		logger.Error("Failed to update approval request", "request_id", req.id, "error", err)
+	}
+}
+
+func (h *CommandHandler) deliverToRequester(s *discordgo.Session, req *approvalRequest, content string) {
+	if !req.dm && time.Since(req.created) < interactionTokenLifetime {
+		_, err := s.FollowupMessageCreate(req.interaction, false, &discordgo.WebhookParams{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Parse: []discordgo.AllowedMentionType{},
+			},
+		})
+		if err == nil {
+			return
+		}
+		logger.Warn("Failed to deliver approval result in the original interaction, falling back to DM", "request_id", req.id, "error", err)
+	}
+
+	channel, err := s.UserChannelCreate(req.requesterID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(channel.ID, content)
+	}
+	if err != nil {
+		logger.Error("Failed to deliver approval result", "request_id", req.id, "user_id", req.requesterID, "error", err)
+	}
+}
+
+func (h *CommandHandler) recordApproval(req *approvalRequest, actorID, actorName, outcome string) {
+	metrics.Approvals.Inc(outcome)
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionApproval,
+		ActorID:   actorID,
+		ActorName: actorName,
+		GuildID:   req.guildID,
+		Command:   "2fa-shared",
+		Entry:     req.entryID,
+		TargetID:  req.requesterID,
+		Outcome:   outcome,
+		Details:   map[string]string{"name": req.entryName, "request_id": req.id},
+	})
+}
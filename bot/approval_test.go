@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestApprovalQueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		run         func(q *approvalQueue)
+		wantExpired int32
+	}{
+		{
+			name:        "expires without a decision",
+			run:         func(q *approvalQueue) { time.Sleep(50 * time.Millisecond) },
+			wantExpired: 1,
+		},
+		{
+			name:        "taken requests never expire",
+			run:         func(q *approvalQueue) { q.take("r1") },
+			wantExpired: 0,
+		},
+		{
+			name: "close stops pending timers",
+			run: func(q *approvalQueue) {
+				if reqs := q.close(); len(reqs) != 1 || reqs[0].id != "r1" {
+					t.Errorf("close returned %d requests, want r1", len(reqs))
+				}
+			},
+			wantExpired: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newApprovalQueue(10 * time.Millisecond)
+			var expired atomic.Int32
+			if _, ok := q.add(&approvalRequest{id: "r1", created: time.Now()}, func() {
+				if q.take("r1") != nil {
+					expired.Add(1)
+				}
+			}); !ok {
+				t.Fatal("add refused a request on an open queue")
+			}
+
+			tt.run(q)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := q.wait(ctx); err != nil {
+				t.Fatalf("wait = %v", err)
+			}
+			time.Sleep(30 * time.Millisecond)
+			if got := expired.Load(); got != tt.wantExpired {
+				t.Errorf("expired %d times, want %d", got, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestApprovalQueueWaitsForRunningExpiry(t *testing.T) {
+	q := newApprovalQueue(time.Millisecond)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q.add(&approvalRequest{id: "r1", created: time.Now()}, func() {
+		close(started)
+		<-release
+		q.take("r1")
+	})
+	<-started
+
+	// The expiry hasn't taken the request yet, so close claims it and the
+	// expiry finds nothing to do.
+	if reqs := q.close(); len(reqs) != 1 {
+		t.Errorf("close returned %d requests, want 1", len(reqs))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	if err := q.wait(ctx); err == nil {
+		t.Error("wait returned before the running expiry finished")
+	}
+	cancel()
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.wait(ctx); err != nil {
+		t.Fatalf("wait after the expiry finished = %v", err)
+	}
+	if _, ok := q.add(&approvalRequest{id: "r2", created: time.Now()}, func() {}); ok {
+		t.Error("add accepted a request after close")
+	}
+}
+
+func TestMemberPermissions(t *testing.T) {
+	g := &discordgo.Guild{
+		ID:      "g1",
+		OwnerID: "owner",
+		Roles: []*discordgo.Role{
+			{ID: "g1", Permissions: discordgo.PermissionViewChannel},
+			{ID: "managers", Permissions: discordgo.PermissionManageGuild},
+			{ID: "admins", Permissions: discordgo.PermissionAdministrator},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		member *discordgo.Member
+		want   int64
+	}{
+		{"everyone role only", &discordgo.Member{User: &discordgo.User{ID: "u1"}}, discordgo.PermissionViewChannel},
+		{"role permissions add up", &discordgo.Member{User: &discordgo.User{ID: "u1"}, Roles: []string{"managers"}}, discordgo.PermissionViewChannel | discordgo.PermissionManageGuild},
+		{"administrator grants everything", &discordgo.Member{User: &discordgo.User{ID: "u1"}, Roles: []string{"admins"}}, discordgo.PermissionAll},
+		{"owner has every permission", &discordgo.Member{User: &discordgo.User{ID: "owner"}}, discordgo.PermissionAll},
+		{"unknown roles are ignored", &discordgo.Member{User: &discordgo.User{ID: "u1"}, Roles: []string{"gone"}}, discordgo.PermissionViewChannel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := memberPermissions(g, tt.member); got != tt.want {
+				t.Errorf("memberPermissions = %b, want %b", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+	"Discord-Bot-2FA-Key-Gen/totp"
+	"Discord-Bot-2FA-Key-Gen/vault"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func (h *CommandHandler) Handle2FABackupCodes(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in 2FA backup codes handler", "panic", r)
+			h.respondWithError(s, i, "An unexpected error occurred. Please try again later.")
+		}
+	}()
+
+	if !h.validateInteraction(s, i) {
+		return
+	}
+
+	if !h.checkGuildPolicy(s, i, "2fa-backup-codes") {
+		return
+	}
+
+	if !h.allowRequest(s, i, "2fa-backup-codes") {
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		h.respondWithError(s, i, "Please choose a backup code action.")
+		return
+	}
+
+	subcommand := options[0]
+	name := optionString(subcommand.Options, "entry")
+	if subcommand.Name == "generate" && name == "" {
+		h.generateBackupCodes(s, i, subcommand, nil)
+		return
+	}
+
+	if i.GuildID == "" {
+		h.respondWithError(s, i, "Backup codes are stored against a shared entry, which belongs to a server. Use this command from within one.")
+		return
+	}
+	if h.vault == nil {
+		metrics.CommandsTotal.Inc("2fa-backup-codes", "disabled")
+		h.respondWithError(s, i, "Shared entries are not enabled on this bot.")
+		return
+	}
+
+	entry, ok := h.findSharedEntry(s, i, "2fa-backup-codes", name)
+	if !ok {
+		return
+	}
+
+	switch subcommand.Name {
+	case "generate", "store", "show":
+		if !h.permChecker.CanManageSharedEntry(i, entry) {
+			h.denyAccess(s, i, "2fa-backup-codes")
+			return
+		}
+	default:
+		if !h.permChecker.CanUseSharedEntry(i, entry) {
+			h.denyAccess(s, i, "2fa-backup-codes")
+			return
+		}
+	}
+
+	switch subcommand.Name {
+	case "generate":
+		h.generateBackupCodes(s, i, subcommand, &entry)
+	case "store":
+		codes := splitBackupCodes(optionString(subcommand.Options, "codes"))
+		if len(codes) == 0 {
+			metrics.CommandsTotal.Inc("2fa-backup-codes", "invalid")
+			h.respondWithError(s, i, "Paste at least one code, separated by spaces, commas or new lines.")
+			return
+		}
+		h.storeBackupCodes(s, i, entry, codes, "store")
+	case "status":
+		h.backupCodeStatus(s, i, entry, false)
+	case "show":
+		h.backupCodeStatus(s, i, entry, true)
+	case "use":
+		h.useBackupCode(s, i, entry, optionString(subcommand.Options, "code"))
+	default:
+		h.respondWithError(s, i, "Unknown backup code action.")
+	}
+}
+
+func (h *CommandHandler) generateBackupCodes(s *discordgo.Session, i *discordgo.InteractionCreate, subcommand *discordgo.ApplicationCommandInteractionDataOption, target *vault.Entry) {
+	if target == nil && !h.permChecker.HasPermission(s, i) {
+		h.denyAccess(s, i, "2fa-backup-codes")
+		return
+	}
+
+	defaults := totp.DefaultBackupFormat()
+	format := totp.BackupFormat{
+		Count:       optionInt(subcommand.Options, "count", defaults.Count),
+		Groups:      optionInt(subcommand.Options, "groups", defaults.Groups),
+		GroupLength: optionInt(subcommand.Options, "length", defaults.GroupLength),
+		Alphabet:    defaults.Alphabet,
+	}
+	if alphabet := optionString(subcommand.Options, "alphabet"); alphabet != "" {
+		format.Alphabet = alphabet
+	}
+
+	codes, err := totp.GenerateBackupCodes(format)
+	if err != nil {
+		metrics.CommandsTotal.Inc("2fa-backup-codes", "invalid")
+		h.respondWithError(s, i, fmt.Sprintf("Invalid format: %s", err))
+		return
+	}
+
+	if target != nil {
+		h.storeBackupCodes(s, i, *target, codes, "generate")
+		return
+	}
+
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionGenerate,
+		ActorID:   i.Member.User.ID,
+		ActorName: i.Member.User.Username,
+		GuildID:   i.GuildID,
+		Command:   "2fa-backup-codes",
+		Outcome:   "success",
+		Details:   map[string]string{"count": strconv.Itoa(len(codes)), "alphabet": format.Alphabet},
+	})
+	metrics.CommandsTotal.Inc("2fa-backup-codes", "success")
+	h.respondWithMessage(s, i, fmt.Sprintf("**%d backup codes generated**\n%s\nThese codes are not stored. Save them somewhere safe; each one should only be accepted once.",
+		len(codes), formatBackupCodeList(codes)))
+}
+
+func (h *CommandHandler) storeBackupCodes(s *discordgo.Session, i *discordgo.InteractionCreate, entry vault.Entry, codes []string, change string) {
+	updated, err := h.vault.SetBackupCodes(entry.ID, i.Member.User.ID, codes)
+	if err != nil {
+		logger.Error("Failed to store backup codes", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-backup-codes", "error")
+		h.respondWithError(s, i, "Failed to store the backup codes.")
+		return
+	}
+
+	h.recordBackupCodes(i, updated, change, map[string]string{"count": strconv.Itoa(len(codes))})
+	metrics.CommandsTotal.Inc("2fa-backup-codes", "success")
+
+	message := fmt.Sprintf("Stored %d backup codes for **%s**, replacing any previous set.", len(codes), entry.Name)
+	if change == "generate" {
+		message += "\n" + formatBackupCodeList(codes) + "\nEnter these with the service before relying on them."
+	}
+	h.respondWithMessage(s, i, message)
+}
+
+func (h *CommandHandler) backupCodeStatus(s *discordgo.Session, i *discordgo.InteractionCreate, entry vault.Entry, reveal bool) {
+	codes, err := h.vault.BackupCodes(entry)
+	if errors.Is(err, vault.ErrNoBackupCodes) {
+		metrics.CommandsTotal.Inc("2fa-backup-codes", "success")
+		h.respondWithMessage(s, i, fmt.Sprintf("**%s** has no stored backup codes.", entry.Name))
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to open backup codes", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-backup-codes", "error")
+		h.respondWithError(s, i, "Failed to read the backup codes.")
+		return
+	}
+
+	remaining := vault.RemainingBackupCodes(codes)
+	message := fmt.Sprintf("**%s**: %d of %d backup codes remaining.", entry.Name, remaining, len(codes))
+	if remaining == 0 {
+		message += "\nEvery code has been used. Generate a new set with the service and store it."
+	}
+	if reveal {
+		lines := make([]string, len(codes))
+		for idx, code := range codes {
+			if code.UsedAt == nil {
+				lines[idx] = fmt.Sprintf("`%s`", code.Code)
+				continue
+			}
+			lines[idx] = fmt.Sprintf("~~`%s`~~ used <t:%d:R> by <@%s>", code.Code, code.UsedAt.Unix(), code.UsedBy)
+		}
+		message += "\n" + strings.Join(lines, "\n")
+		h.recordBackupCodes(i, entry, "show", nil)
+	}
+
+	metrics.CommandsTotal.Inc("2fa-backup-codes", "success")
+	h.respondWithMessage(s, i, message)
+}
+
+func (h *CommandHandler) useBackupCode(s *discordgo.Session, i *discordgo.InteractionCreate, entry vault.Entry, code string) {
+	remaining, err := h.vault.UseBackupCode(entry.ID, i.Member.User.ID, code)
+	switch {
+	case errors.Is(err, vault.ErrNoBackupCodes):
+		metrics.CommandsTotal.Inc("2fa-backup-codes", "invalid")
+		h.respondWithError(s, i, fmt.Sprintf("**%s** has no stored backup codes.", entry.Name))
+		return
+	case errors.Is(err, vault.ErrBackupCodeNotFound):
+		metrics.CommandsTotal.Inc("2fa-backup-codes", "invalid")
+		h.respondWithFailure(s, i, "2fa-backup-codes", "invalid_backup_code", fmt.Sprintf("That code is not one of the stored backup codes for **%s**.", entry.Name))
+		return
+	case errors.Is(err, vault.ErrBackupCodeUsed):
+		metrics.CommandsTotal.Inc("2fa-backup-codes", "invalid")
+		h.respondWithError(s, i, fmt.Sprintf("That code was already marked as used. %d codes remain for **%s**.", remaining, entry.Name))
+		return
+	case err != nil:
+		logger.Error("Failed to mark backup code used", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-backup-codes", "error")
+		h.respondWithError(s, i, "Failed to update the backup codes.")
+		return
+	}
+
+	h.recordBackupCodes(i, entry, "use", map[string]string{"remaining": strconv.Itoa(remaining)})
+	metrics.CommandsTotal.Inc("2fa-backup-codes", "success")
+	message := fmt.Sprintf("Backup code marked as used. %d codes remain for **%s**.", remaining, entry.Name)
+	if remaining <= 2 {
+		message += "\nRunning low: generate a new set with the service and store it."
+	}
+	h.respondWithMessage(s, i, message)
+}
+
+func (h *CommandHandler) recordBackupCodes(i *discordgo.InteractionCreate, entry vault.Entry, change string, details map[string]string) {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["name"] = entry.Name
+	details["action"] = change
+
+	logger.Info("Backup codes changed", "actor_id", i.Member.User.ID, "guild_id", i.GuildID, "entry_id", entry.ID, "action", change)
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionBackupCodes,
+		ActorID:   i.Member.User.ID,
+		ActorName: i.Member.User.Username,
+		GuildID:   i.GuildID,
+		Command:   "2fa-backup-codes",
+		Entry:     entry.ID,
+		Outcome:   "success",
+		Details:   details,
+	})
+}
+
+func splitBackupCodes(input string) []string {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\t'
+	})
+	var codes []string
+	for _, field := range fields {
+		if code := strings.TrimSpace(field); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+func formatBackupCodeList(codes []string) string {
+	var b strings.Builder
+	b.WriteString("```\n")
+	for idx, code := range codes {
+		fmt.Fprintf(&b, "%2d. %s\n", idx+1, code)
+	}
+	b.WriteString("```")
+	return b.String()
+}
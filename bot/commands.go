@@ -0,0 +1,670 @@
+package bot
+
+import (
+	"Discord-Bot-2FA-Key-Gen/guild"
+	"Discord-Bot-2FA-Key-Gen/totp"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func Commands() []*discordgo.ApplicationCommand {
+	manageGuild := int64(discordgo.PermissionManageGuild)
+	dmPermission := false
+	zero := 0.0
+	one := 1.0
+	two := 2.0
+	minQRSize := float64(totp.MinQRSize)
+
+	return []*discordgo.ApplicationCommand{
+		{
+			Name:        "2fa-code",
+			Description: "Generate a 2FA verification code from your secret key",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "secret",
+					Description: "Your 2FA secret key (Base32 format)",
+					Required:    true,
+				},
+				displayProfileOption("display", "What to show besides the code (default code only)", false),
+			},
+		},
+		{
+			Name:        "2fa-generate",
+			Description: "Generate a new 2FA secret key with QR code",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "issuer",
+					Description: "Service name (optional, defaults to 'Discord 2FA Bot')",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "account",
+					Description: "Account name (optional, defaults to your username)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "size",
+					Description: "QR code size in pixels (default 256)",
+					Required:    false,
+					MinValue:    &minQRSize,
+					MaxValue:    totp.MaxQRSize,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "recovery",
+					Description: "Error correction level (default medium, high is forced with a logo)",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Low (7%)", Value: "low"},
+						{Name: "Medium (15%)", Value: "medium"},
+						{Name: "High (25%)", Value: "high"},
+						{Name: "Highest (30%)", Value: "highest"},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "foreground",
+					Description: "Module colour as #RRGGBB (default #000000)",
+					Required:    false,
+					MaxLength:   7,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "background",
+					Description: "Background colour as #RRGGBB (default #FFFFFF)",
+					Required:    false,
+					MaxLength:   7,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionAttachment,
+					Name:        "logo",
+					Description: "PNG, JPEG or GIF image to place in the centre (max 2 MiB)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "format",
+					Description: "Image format (default png)",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "PNG", Value: "png"},
+						{Name: "SVG", Value: "svg"},
+					},
+				},
+			},
+		},
+		{
+			Name:        "2fa-verify",
+			Description: "Check whether a 2FA code is valid for a secret key",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "secret",
+					Description: "Your 2FA secret key (Base32 format)",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "code",
+					Description: "The 6-digit code to check",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "2fa-admin",
+			Description: "Administrative commands for the 2FA bot",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "grant",
+					Description: "Grant administrator access to a user",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Name:        "user",
+							Description: "User to grant administrator access",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "revoke",
+					Description: "Revoke administrator access from a user",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Name:        "user",
+							Description: "User to revoke administrator access from",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "List configured and granted administrators",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reset-cooldown",
+					Description: "Clear the rate limits for a user",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Name:        "user",
+							Description: "User whose rate limits should be cleared",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "clear-lockout",
+					Description: "Lift a lockout caused by repeated failed attempts",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Name:        "user",
+							Description: "User whose lockout should be lifted",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "vault-status",
+					Description: "Show which vault key version wraps the shared entries",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "vault-rewrap",
+					Description: "Re-wrap every shared entry's data key with the active vault key",
+				},
+			},
+		},
+		{
+			Name:         "2fa-shared",
+			Description:  "Use and manage 2FA entries shared by this server",
+			DMPermission: &dmPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "List the shared entries you can use",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "code",
+					Description: "Get the current code for a shared entry",
+					Options: []*discordgo.ApplicationCommandOption{
+						sharedNameOption(),
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "dm",
+							Description: "Deliver an approved code by direct message instead of here",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "sheet",
+					Description: "Download a printable recovery sheet as PNG and PDF (entry managers only)",
+					Options:     []*discordgo.ApplicationCommandOption{sharedNameOption()},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Store a new shared entry (server managers only)",
+					Options: []*discordgo.ApplicationCommandOption{
+						sharedNameOption(),
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "secret",
+							Description: "Base32 secret or otpauth:// URI",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Name:        "role",
+							Description: "Role that may retrieve codes",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "issuer",
+							Description: "Service name",
+							Required:    false,
+							MaxLength:   64,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "account",
+							Description: "Account name",
+							Required:    false,
+							MaxLength:   64,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "grant",
+					Description: "Give a role access to a shared entry",
+					Options: []*discordgo.ApplicationCommandOption{
+						sharedNameOption(),
+						{
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Name:        "role",
+							Description: "Role to grant",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "manage",
+							Description: "Let the role rotate, delete and change access to the entry",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "revoke",
+					Description: "Remove a role's access to a shared entry",
+					Options: []*discordgo.ApplicationCommandOption{
+						sharedNameOption(),
+						{
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Name:        "role",
+							Description: "Role to revoke",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "announce",
+					Description: "Announce every code retrieval in a channel",
+					Options: []*discordgo.ApplicationCommandOption{
+						sharedNameOption(),
+						{
+							Type:        discordgo.ApplicationCommandOptionChannel,
+							Name:        "channel",
+							Description: "Owners channel (leave empty to stop announcing)",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "approval",
+					Description: "Require an approver to sign off before a code is handed out",
+					Options: []*discordgo.ApplicationCommandOption{
+						sharedNameOption(),
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "required",
+							Description: "Whether codes for this entry need approval",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionChannel,
+							Name:        "channel",
+							Description: "Channel where approval requests are posted",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Name:        "role",
+							Description: "Role allowed to approve requests",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "rotate",
+					Description: "Start replacing the secret of a shared entry; confirm with /2fa-rotate confirm",
+					Options: []*discordgo.ApplicationCommandOption{
+						sharedNameOption(),
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "secret",
+							Description: "New Base32 secret or otpauth:// URI",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "delete",
+					Description: "Delete a shared entry",
+					Options:     []*discordgo.ApplicationCommandOption{sharedNameOption()},
+				},
+			},
+		},
+		{
+			Name:        "2fa-backup-codes",
+			Description: "Generate and track recovery codes",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "generate",
+					Description: "Generate random recovery codes, optionally storing them against a shared entry",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "count",
+							Description: "Number of codes (default 10)",
+							Required:    false,
+							MinValue:    &one,
+							MaxValue:    50,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "groups",
+							Description: "Groups per code, separated by dashes (default 2)",
+							Required:    false,
+							MinValue:    &one,
+							MaxValue:    8,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "length",
+							Description: "Characters per group (default 5)",
+							Required:    false,
+							MinValue:    &two,
+							MaxValue:    12,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "alphabet",
+							Description: "Characters to use (default alphanumeric)",
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Alphanumeric (no look-alikes)", Value: "alphanumeric"},
+								{Name: "Numeric", Value: "numeric"},
+								{Name: "Hex", Value: "hex"},
+							},
+						},
+						backupEntryOption(false),
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "store",
+					Description: "Store recovery codes issued by a service against a shared entry",
+					Options: []*discordgo.ApplicationCommandOption{
+						backupEntryOption(true),
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "codes",
+							Description: "Codes separated by spaces, commas or new lines",
+							Required:    true,
+							MaxLength:   2000,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "status",
+					Description: "Show how many recovery codes are left for a shared entry",
+					Options:     []*discordgo.ApplicationCommandOption{backupEntryOption(true)},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "use",
+					Description: "Mark a recovery code as used",
+					Options: []*discordgo.ApplicationCommandOption{
+						backupEntryOption(true),
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "code",
+							Description: "The code you used",
+							Required:    true,
+							MaxLength:   128,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "Reveal the stored recovery codes for a shared entry (entry managers only)",
+					Options:     []*discordgo.ApplicationCommandOption{backupEntryOption(true)},
+				},
+			},
+		},
+		{
+			Name:         "2fa-rotate",
+			Description:  "Replace the secret of a shared entry after confirming the new one works",
+			DMPermission: &dmPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "start",
+					Description: "Create a new secret; the old one stays active until you confirm",
+					Options: []*discordgo.ApplicationCommandOption{
+						sharedNameOption(),
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "secret",
+							Description: "Secret or otpauth:// URI issued by the service (generated when empty)",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "confirm",
+					Description: "Retire the old secret once a code from the new one checks out",
+					Options: []*discordgo.ApplicationCommandOption{
+						sharedNameOption(),
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "code",
+							Description: "A current code from the new secret",
+							Required:    true,
+							MaxLength:   10,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "cancel",
+					Description: "Discard the pending secret and keep the old one",
+					Options:     []*discordgo.ApplicationCommandOption{sharedNameOption()},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "status",
+					Description: "Show any pending rotation and the rotation history",
+					Options:     []*discordgo.ApplicationCommandOption{sharedNameOption()},
+				},
+			},
+		},
+		{
+			Name:                     "2fa-config",
+			Description:              "View and change the 2FA bot settings for this server",
+			DefaultMemberPermissions: &manageGuild,
+			DMPermission:             &dmPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "Show the current settings for this server",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "allow-role",
+					Description: "Allow a role to use the bot (replaces ALLOWED_ROLES for this server)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Name:        "role",
+							Description: "Role to allow",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove-role",
+					Description: "Remove a role from the allowed roles",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Name:        "role",
+							Description: "Role to remove",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "allow-channel",
+					Description: "Restrict the bot to a channel; once any are set, only listed channels work",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionChannel,
+							Name:        "channel",
+							Description: "Channel to allow",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove-channel",
+					Description: "Remove a channel from the allowed channels",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionChannel,
+							Name:        "channel",
+							Description: "Channel to remove",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "cooldown",
+					Description: "Set the per-user cooldown for this server",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "seconds",
+							Description: "Seconds between commands (0 uses the bot default)",
+							Required:    true,
+							MinValue:    &zero,
+							MaxValue:    3600,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "issuer",
+					Description: "Set the default issuer for /2fa-generate",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "name",
+							Description: "Issuer name (leave empty to use the bot default)",
+							Required:    false,
+							MaxLength:   64,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "display",
+					Description: "Limit how much of a secret a command may show",
+					Options: []*discordgo.ApplicationCommandOption{
+						displayCommandOption(),
+						displayProfileOption("limit", "Most detailed response members may choose", true),
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "enable",
+					Description: "Enable a command on this server",
+					Options:     []*discordgo.ApplicationCommandOption{guildCommandOption()},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "disable",
+					Description: "Disable a command on this server",
+					Options:     []*discordgo.ApplicationCommandOption{guildCommandOption()},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reset",
+					Description: "Reset all settings for this server to the bot defaults",
+				},
+			},
+		},
+	}
+}
+
+func sharedNameOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "name",
+		Description: "Name of the shared entry",
+		Required:    true,
+		MaxLength:   64,
+	}
+}
+
+func backupEntryOption(required bool) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "entry",
+		Description: "Name of the shared entry the codes belong to",
+		Required:    required,
+		MaxLength:   64,
+	}
+}
+
+func guildCommandOption() *discordgo.ApplicationCommandOption {
+	option := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "command",
+		Description: "Command to change",
+		Required:    true,
+	}
+	for _, command := range guild.Commands {
+		option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: command, Value: command})
+	}
+	return option
+}
+
+func displayCommandOption() *discordgo.ApplicationCommandOption {
+	option := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "command",
+		Description: "Command to change",
+		Required:    true,
+	}
+	for _, command := range guild.DisplayCommands {
+		option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: command, Value: command})
+	}
+	return option
+}
+
+func displayProfileOption(name, description string, required bool) *discordgo.ApplicationCommandOption {
+	option := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        name,
+		Description: description,
+		Required:    required,
+	}
+	for _, profile := range guild.DisplayProfiles {
+		option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: displayProfileNames[profile], Value: profile})
+	}
+	return option
+}
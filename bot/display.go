@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/totp"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var displayProfileNames = map[string]string{
+	"code":   "Code only",
+	"masked": "Code and masked secret",
+	"full":   "Full setup details",
+}
+
+type codeDisplay struct {
+	profile string
+	result  *totp.Result
+	issuer  string
+	account string
+}
+
+func (d codeDisplay) compose() (*discordgo.InteractionResponseData, error) {
+	embed := &discordgo.MessageEmbed{
+		Title: "2FA Verification Code",
+		Color: 0x32AE4D,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Current Code",
+				Value:  fmt.Sprintf("**`%s`**", d.result.Code),
+				Inline: true,
+			},
+			{
+				Name:   "Remaining Time",
+				Value:  fmt.Sprintf("%d seconds", d.result.RemainingTime),
+				Inline: true,
+			},
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Code refreshes every 30 seconds",
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	data := &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Flags:  discordgo.MessageFlagsEphemeral,
+	}
+
+	switch d.profile {
+	case "masked":
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Secret Key",
+			Value: fmt.Sprintf("`%s`", maskSecret(d.result.Secret)),
+		})
+	case "full":
+		uri := totp.KeyURI(d.issuer, d.account, d.result.Secret)
+		qrCode, err := totp.RenderQR(uri, totp.DefaultQROptions())
+		if err != nil {
+			return nil, err
+		}
+		embed.Fields = append(embed.Fields,
+			&discordgo.MessageEmbedField{Name: "Secret Key", Value: fmt.Sprintf("||%s||", d.result.Secret)},
+			&discordgo.MessageEmbedField{Name: "Issuer", Value: d.issuer, Inline: true},
+			&discordgo.MessageEmbedField{Name: "Account", Value: d.account, Inline: true},
+			&discordgo.MessageEmbedField{Name: "Setup URI", Value: fmt.Sprintf("||`%s`||", uri)},
+		)
+		embed.Image = &discordgo.MessageEmbedImage{URL: "attachment://qrcode.png"}
+		data.Files = []*discordgo.File{
+			{
+				Name:        "qrcode.png",
+				ContentType: "image/png",
+				Reader:      bytes.NewReader(qrCode),
+			},
+		}
+	}
+
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+		Name:  "Security Notice",
+		Value: "This code is valid for 30 seconds. Do not share it with anyone.",
+	})
+	return data, nil
+}
+
+// Only the last four characters are shown: enough to tell secrets apart without
+// giving away a meaningful share of the key.
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("•", len(secret))
+	}
+	return strings.Repeat("•", len(secret)-4) + secret[len(secret)-4:]
+}
@@ -0,0 +1,256 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
+	"Discord-Bot-2FA-Key-Gen/guild"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func (h *CommandHandler) Handle2FAConfig(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in 2FA config handler", "panic", r)
+			h.respondWithError(s, i, "An unexpected error occurred. Please try again later.")
+		}
+	}()
+
+	if !h.validateInteraction(s, i) {
+		return
+	}
+
+	if i.GuildID == "" {
+		h.respondWithError(s, i, "Server settings can only be changed from within a server.")
+		return
+	}
+
+	if !h.permChecker.IsGuildManager(i) {
+		h.denyAccess(s, i, "2fa-config")
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		h.respondWithError(s, i, "Please choose a settings action.")
+		return
+	}
+
+	subcommand := options[0]
+	userID := i.Member.User.ID
+
+	if subcommand.Name == "show" {
+		metrics.CommandsTotal.Inc("2fa-config", "success")
+		h.respondWithMessage(s, i, formatGuildSettings(h.permChecker.GuildSettings(i.GuildID)))
+		return
+	}
+
+	if subcommand.Name == "reset" {
+		if err := h.permChecker.ResetGuildSettings(i.GuildID); err != nil {
+			logger.Error("Failed to reset guild settings", "guild_id", i.GuildID, "error", err)
+			metrics.CommandsTotal.Inc("2fa-config", "error")
+			h.respondWithError(s, i, "Failed to save server settings.")
+			return
+		}
+		h.recordGuildConfig(i, "reset", "")
+		metrics.CommandsTotal.Inc("2fa-config", "success")
+		h.respondWithMessage(s, i, "Server settings have been reset to the bot defaults.")
+		return
+	}
+
+	change, value, err := guildSettingsChange(subcommand)
+	if err != nil {
+		metrics.CommandsTotal.Inc("2fa-config", "invalid")
+		h.respondWithError(s, i, err.Error())
+		return
+	}
+
+	settings, err := h.permChecker.UpdateGuildSettings(i.GuildID, userID, change)
+	if err != nil {
+		var invalid invalidSettingError
+		if errors.As(err, &invalid) {
+			metrics.CommandsTotal.Inc("2fa-config", "invalid")
+			h.respondWithError(s, i, err.Error())
+			return
+		}
+		logger.Error("Failed to update guild settings", "guild_id", i.GuildID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-config", "error")
+		h.respondWithError(s, i, "Failed to save server settings.")
+		return
+	}
+
+	h.recordGuildConfig(i, subcommand.Name, value)
+	metrics.CommandsTotal.Inc("2fa-config", "success")
+	h.respondWithMessage(s, i, "Server settings updated.\n\n"+formatGuildSettings(settings))
+}
+
+type invalidSettingError string
+
+func (e invalidSettingError) Error() string {
+	return string(e)
+}
+
+func guildSettingsChange(subcommand *discordgo.ApplicationCommandInteractionDataOption) (func(*guild.Settings) error, string, error) {
+	option := func(name string) *discordgo.ApplicationCommandInteractionDataOption {
+		for _, opt := range subcommand.Options {
+			if opt.Name == name {
+				return opt
+			}
+		}
+		return nil
+	}
+
+	switch subcommand.Name {
+	case "allow-role", "remove-role":
+		opt := option("role")
+		if opt == nil {
+			return nil, "", invalidSettingError("Please provide a role.")
+		}
+		roleID := opt.RoleValue(nil, "").ID
+		add := subcommand.Name == "allow-role"
+		return func(settings *guild.Settings) error {
+			return toggleID(&settings.AllowedRoles, roleID, add, "role")
+		}, roleID, nil
+	case "allow-channel", "remove-channel":
+		opt := option("channel")
+		if opt == nil {
+			return nil, "", invalidSettingError("Please provide a channel.")
+		}
+		channelID := opt.ChannelValue(nil).ID
+		add := subcommand.Name == "allow-channel"
+		return func(settings *guild.Settings) error {
+			return toggleID(&settings.AllowedChannels, channelID, add, "channel")
+		}, channelID, nil
+	case "cooldown":
+		opt := option("seconds")
+		if opt == nil {
+			return nil, "", invalidSettingError("Please provide a cooldown in seconds.")
+		}
+		seconds := int(opt.IntValue())
+		if seconds < 0 || seconds > 3600 {
+			return nil, "", invalidSettingError("The cooldown must be between 0 and 3600 seconds.")
+		}
+		return func(settings *guild.Settings) error {
+			settings.CooldownSeconds = seconds
+			return nil
+		}, fmt.Sprint(seconds), nil
+	case "issuer":
+		issuer := ""
+		if opt := option("name"); opt != nil {
+			issuer = strings.TrimSpace(opt.StringValue())
+		}
+		if len(issuer) > 64 {
+			return nil, "", invalidSettingError("The issuer must be 64 characters or fewer.")
+		}
+		return func(settings *guild.Settings) error {
+			settings.Issuer = issuer
+			return nil
+		}, issuer, nil
+	case "display":
+		command, limit := option("command"), option("limit")
+		if command == nil || limit == nil {
+			return nil, "", invalidSettingError("Please provide a command and a limit.")
+		}
+		if !slices.Contains(guild.DisplayCommands, command.StringValue()) || !slices.Contains(guild.DisplayProfiles, limit.StringValue()) {
+			return nil, "", invalidSettingError("Unknown command or display profile.")
+		}
+		return func(settings *guild.Settings) error {
+			if settings.DisplayLimits == nil {
+				settings.DisplayLimits = map[string]string{}
+			}
+			settings.DisplayLimits[command.StringValue()] = limit.StringValue()
+			return nil
+		}, command.StringValue() + "=" + limit.StringValue(), nil
+	case "enable", "disable":
+		opt := option("command")
+		if opt == nil {
+			return nil, "", invalidSettingError("Please provide a command.")
+		}
+		command := opt.StringValue()
+		if !slices.Contains(guild.Commands, command) {
+			return nil, "", invalidSettingError(fmt.Sprintf("`%s` can't be enabled or disabled.", command))
+		}
+		disable := subcommand.Name == "disable"
+		return func(settings *guild.Settings) error {
+			return toggleID(&settings.DisabledCommands, command, disable, "command")
+		}, command, nil
+	default:
+		return nil, "", invalidSettingError("Unknown settings action.")
+	}
+}
+
+func toggleID(ids *[]string, id string, add bool, kind string) error {
+	idx := slices.Index(*ids, id)
+	switch {
+	case add && idx >= 0:
+		return invalidSettingError(fmt.Sprintf("That %s is already in the list.", kind))
+	case add:
+		*ids = append(*ids, id)
+	case idx < 0:
+		return invalidSettingError(fmt.Sprintf("That %s is not in the list.", kind))
+	default:
+		*ids = slices.Delete(*ids, idx, idx+1)
+	}
+	return nil
+}
+
+func (h *CommandHandler) recordGuildConfig(i *discordgo.InteractionCreate, action, value string) {
+	logger.Info("Guild settings changed", "actor_id", i.Member.User.ID, "guild_id", i.GuildID, "action", action, "value", value)
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionGuildConfig,
+		ActorID:   i.Member.User.ID,
+		ActorName: i.Member.User.Username,
+		GuildID:   i.GuildID,
+		Command:   "2fa-config",
+		Outcome:   "success",
+		Details:   map[string]string{"action": action, "value": value},
+	})
+}
+
+func formatGuildSettings(settings guild.Settings) string {
+	cooldown := "bot default"
+	if settings.CooldownSeconds > 0 {
+		cooldown = fmt.Sprintf("%d seconds", settings.CooldownSeconds)
+	}
+	issuer := "Discord 2FA Bot"
+	if settings.Issuer != "" {
+		issuer = settings.Issuer
+	}
+
+	var commands []string
+	for _, command := range guild.Commands {
+		state := "enabled"
+		if !settings.CommandEnabled(command) {
+			state = "disabled"
+		}
+		commands = append(commands, fmt.Sprintf("`/%s` %s", command, state))
+	}
+
+	var limits []string
+	for _, command := range guild.DisplayCommands {
+		limits = append(limits, fmt.Sprintf("`/%s` %s", command, strings.ToLower(displayProfileNames[settings.DisplayLimit(command)])))
+	}
+
+	return fmt.Sprintf("**Allowed roles:** %s\n**Allowed channels:** %s\n**Cooldown:** %s\n**Default issuer:** %s\n**Commands:** %s\n**Display limits:** %s",
+		formatMentions(settings.AllowedRoles, "<@&%s>", "bot default"),
+		formatMentions(settings.AllowedChannels, "<#%s>", "all channels"),
+		cooldown, issuer, strings.Join(commands, ", "), strings.Join(limits, ", "))
+}
+
+func formatMentions(ids []string, format, empty string) string {
+	if len(ids) == 0 {
+		return empty
+	}
+
+	mentions := make([]string, len(ids))
+	for idx, id := range ids {
+		mentions[idx] = fmt.Sprintf(format, id)
+	}
+	return strings.Join(mentions, ", ")
+}
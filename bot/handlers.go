@@ -2,35 +2,48 @@ package bot
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
+	"Discord-Bot-2FA-Key-Gen/audit"
 	"Discord-Bot-2FA-Key-Gen/auth"
 	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+	"Discord-Bot-2FA-Key-Gen/ratelimit"
 	"Discord-Bot-2FA-Key-Gen/totp"
+	"Discord-Bot-2FA-Key-Gen/vault"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 type CommandHandler struct {
-	totpGen         *totp.Generator
-	permChecker     *auth.PermissionChecker
-	cooldownManager *CooldownManager
+	totpGen        *totp.Generator
+	permChecker    *auth.PermissionChecker
+	auditLog       *audit.Logger
+	rateLimiter    *ratelimit.Limiter
+	vault          *vault.Vault
+	approvals      *approvalQueue
+	alertChannelID string
 }
 
-func NewCommandHandler(totpGen *totp.Generator, permChecker *auth.PermissionChecker, cooldownDuration time.Duration) *CommandHandler {
+func NewCommandHandler(totpGen *totp.Generator, permChecker *auth.PermissionChecker, auditLog *audit.Logger, rateLimiter *ratelimit.Limiter, entries *vault.Vault, alertChannelID string) *CommandHandler {
 	return &CommandHandler{
-		totpGen:         totpGen,
-		permChecker:     permChecker,
-		cooldownManager: NewCooldownManager(cooldownDuration),
+		totpGen:        totpGen,
+		permChecker:    permChecker,
+		auditLog:       auditLog,
+		rateLimiter:    rateLimiter,
+		vault:          entries,
+		approvals:      newApprovalQueue(10 * time.Minute),
+		alertChannelID: alertChannelID,
 	}
 }
 
 func (h *CommandHandler) Handle2FACode(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Error("Panic in 2FA code handler:", r)
+			logger.Error("Panic in 2FA code handler", "panic", r)
 			h.respondWithError(s, i, "An unexpected error occurred. Please try again later.")
 		}
 	}()
@@ -42,110 +55,109 @@ func (h *CommandHandler) Handle2FACode(s *discordgo.Session, i *discordgo.Intera
 	userID := i.Member.User.ID
 	username := i.Member.User.Username
 
-	if !h.permChecker.HasPermission(s, i) {
-		h.permChecker.LogUnauthorizedAccess(userID, username, "2fa-code")
-		h.respondWithError(s, i, "You don't have permission to use this command.")
+	if !h.checkGuildPolicy(s, i, "2fa-code") {
 		return
 	}
 
-	if h.cooldownManager.IsOnCooldown(userID) {
-		remaining := h.cooldownManager.GetRemainingCooldown(userID)
-		h.respondWithError(s, i, fmt.Sprintf("Please wait %d seconds before using this command again.", int(remaining.Seconds())))
+	if !h.allowRequest(s, i, "2fa-code") {
+		return
+	}
+
+	if !h.permChecker.HasPermission(s, i) {
+		h.denyAccess(s, i, "2fa-code")
 		return
 	}
 
 	options := i.ApplicationCommandData().Options
 	if len(options) == 0 {
+		metrics.ValidationFailures.Inc("missing")
+		metrics.CommandsTotal.Inc("2fa-code", "invalid")
 		h.respondWithError(s, i, "Please provide a 2FA secret key.")
 		return
 	}
 
-	secret := strings.TrimSpace(options[0].StringValue())
+	secret := optionString(options, "secret")
 	if secret == "" {
-		h.respondWithError(s, i, "Secret key cannot be empty.")
+		metrics.ValidationFailures.Inc("empty")
+		metrics.CommandsTotal.Inc("2fa-code", "invalid")
+		h.respondWithFailure(s, i, "2fa-code", "invalid_secret", "Secret key cannot be empty.")
 		return
 	}
 
 	if len(secret) > 256 {
-		h.respondWithError(s, i, "Secret key is too long.")
+		metrics.ValidationFailures.Inc("too_long")
+		metrics.CommandsTotal.Inc("2fa-code", "invalid")
+		h.respondWithFailure(s, i, "2fa-code", "invalid_secret", "Secret key is too long.")
 		return
 	}
 
 	result, err := h.totpGen.GenerateCode(secret)
 	if err != nil {
-		logger.Warn("TOTP code generation failed for user:", userID, "Error:", err)
+		logger.Warn("TOTP code generation failed", "user_id", userID, "error", err)
+		if reason := totp.ValidationReason(err); reason != "" {
+			metrics.ValidationFailures.Inc(reason)
+			metrics.CommandsTotal.Inc("2fa-code", "invalid")
+			h.respondWithFailure(s, i, "2fa-code", "invalid_secret", err.Error())
+			return
+		}
+		metrics.CommandsTotal.Inc("2fa-code", "error")
 		h.respondWithError(s, i, err.Error())
 		return
 	}
 
-	h.cooldownManager.SetCooldown(userID)
-
-	embed := &discordgo.MessageEmbed{
-		Title: "2FA Verification Code",
-		Color: 0x32AE4D,
-		Fields: []*discordgo.MessageEmbedField{
-			{
-				Name:   "Secret Key",
-				Value:  fmt.Sprintf("||%s||", result.Secret),
-				Inline: false,
-			},
-			{
-				Name:   "Current Code",
-				Value:  fmt.Sprintf("**`%s`**", result.Code),
-				Inline: true,
-			},
-			{
-				Name:   "Remaining Time",
-				Value:  fmt.Sprintf("%d seconds", result.RemainingTime),
-				Inline: true,
-			},
-			{
-				Name:   "Security Notice",
-				Value:  "This code is valid for 30 seconds. Do not share it with anyone.",
-				Inline: false,
-			},
-		},
-		Footer: &discordgo.MessageEmbedFooter{
-			Text: "Code refreshes every 30 seconds",
-		},
-		Timestamp: time.Now().Format(time.RFC3339),
+	display := codeDisplay{profile: "code", result: result, issuer: "Discord 2FA Bot", account: username}
+	if profile := optionString(options, "display"); profile != "" {
+		display.profile = profile
+	}
+	settings := h.permChecker.GuildSettings(i.GuildID)
+	if !settings.DisplayAllowed("2fa-code", display.profile) {
+		metrics.CommandsTotal.Inc("2fa-code", "denied")
+		h.respondWithError(s, i, fmt.Sprintf("This server limits `/2fa-code` responses to: %s. A server manager can raise the limit with `/2fa-config display`.", strings.ToLower(displayProfileNames[settings.DisplayLimit("2fa-code")])))
+		return
+	}
+	if settings.Issuer != "" {
+		display.issuer = settings.Issuer
 	}
 
+	data, err := display.compose()
+	if err != nil {
+		logger.Error("Failed to compose code response", "user_id", userID, "display", display.profile, "error", err)
+		metrics.CommandsTotal.Inc("2fa-code", "error")
+		h.respondWithError(s, i, "Failed to build the response.")
+		return
+	}
 	response := &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Embeds: []*discordgo.MessageEmbed{embed},
-			Flags:  discordgo.MessageFlagsEphemeral,
-		},
-	}
-
-	if result.QRCode != nil {
-		response.Data.Files = []*discordgo.File{
-			{
-				Name:        "qrcode.png",
-				ContentType: "image/png",
-				Reader:      bytes.NewReader(result.QRCode),
-			},
-		}
-		embed.Image = &discordgo.MessageEmbedImage{
-			URL: "attachment://qrcode.png",
-		}
+		Data: data,
 	}
 
 	err = s.InteractionRespond(i.Interaction, response)
 	if err != nil {
-		logger.Error("Failed to respond to interaction:", err)
+		logger.Error("Failed to respond to interaction", "interaction_id", i.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-code", "error")
 		h.respondWithError(s, i, "Failed to send response.")
 		return
 	}
 
-	logger.Info("2FA code generated for user:", username, "(", userID, ")")
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionView,
+		ActorID:   userID,
+		ActorName: username,
+		GuildID:   i.GuildID,
+		Command:   "2fa-code",
+		Entry:     audit.Fingerprint(result.Secret),
+		Outcome:   "success",
+		Details:   map[string]string{"display": display.profile},
+	})
+
+	metrics.CommandsTotal.Inc("2fa-code", "success")
+	logger.Info("2FA code generated", "user_id", userID, "username", username, "guild_id", i.GuildID, "command", "2fa-code")
 }
 
 func (h *CommandHandler) Handle2FAGenerate(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Error("Panic in 2FA generate handler:", r)
+			logger.Error("Panic in 2FA generate handler", "panic", r)
 			h.respondWithError(s, i, "An unexpected error occurred. Please try again later.")
 		}
 	}()
@@ -157,20 +169,24 @@ func (h *CommandHandler) Handle2FAGenerate(s *discordgo.Session, i *discordgo.In
 	userID := i.Member.User.ID
 	username := i.Member.User.Username
 
-	if !h.permChecker.HasPermission(s, i) {
-		h.permChecker.LogUnauthorizedAccess(userID, username, "2fa-generate")
-		h.respondWithError(s, i, "You don't have permission to use this command.")
+	if !h.checkGuildPolicy(s, i, "2fa-generate") {
 		return
 	}
 
-	if h.cooldownManager.IsOnCooldown(userID) {
-		remaining := h.cooldownManager.GetRemainingCooldown(userID)
-		h.respondWithError(s, i, fmt.Sprintf("Please wait %d seconds before using this command again.", int(remaining.Seconds())))
+	if !h.allowRequest(s, i, "2fa-generate") {
+		return
+	}
+
+	if !h.permChecker.HasPermission(s, i) {
+		h.denyAccess(s, i, "2fa-generate")
 		return
 	}
 
 	options := i.ApplicationCommandData().Options
 	issuer := "Discord 2FA Bot"
+	if guildIssuer := h.permChecker.GuildSettings(i.GuildID).Issuer; guildIssuer != "" {
+		issuer = guildIssuer
+	}
 	accountName := username
 
 	for _, option := range options {
@@ -186,14 +202,20 @@ func (h *CommandHandler) Handle2FAGenerate(s *discordgo.Session, i *discordgo.In
 		}
 	}
 
-	result, err := h.totpGen.GenerateSecret(issuer, accountName)
+	qr, err := qrOptionsFromInteraction(s, i)
 	if err != nil {
-		logger.Error("Secret generation failed for user:", userID, "Error:", err)
-		h.respondWithError(s, i, "Failed to generate secret key.")
+		metrics.CommandsTotal.Inc("2fa-generate", "invalid")
+		h.respondWithError(s, i, fmt.Sprintf("Invalid QR options: %s", err))
 		return
 	}
 
-	h.cooldownManager.SetCooldown(userID)
+	result, err := h.totpGen.GenerateSecret(issuer, accountName, qr)
+	if err != nil {
+		logger.Error("Secret generation failed", "user_id", userID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-generate", "error")
+		h.respondWithError(s, i, "Failed to generate secret key.")
+		return
+	}
 
 	embed := &discordgo.MessageEmbed{
 		Title: "New 2FA Secret Generated",
@@ -223,11 +245,13 @@ func (h *CommandHandler) Handle2FAGenerate(s *discordgo.Session, i *discordgo.In
 		Footer: &discordgo.MessageEmbedFooter{
 			Text: "Keep your secret key safe and private",
 		},
-		Image: &discordgo.MessageEmbedImage{
-			URL: "attachment://qrcode.png",
-		},
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
+	// Discord only previews raster images inside embeds; SVGs are sent as a plain attachment.
+	filename := "qrcode" + qr.Extension()
+	if qr.Format == "png" {
+		embed.Image = &discordgo.MessageEmbedImage{URL: "attachment://" + filename}
+	}
 
 	response := &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -236,8 +260,8 @@ func (h *CommandHandler) Handle2FAGenerate(s *discordgo.Session, i *discordgo.In
 			Flags:  discordgo.MessageFlagsEphemeral,
 			Files: []*discordgo.File{
 				{
-					Name:        "qrcode.png",
-					ContentType: "image/png",
+					Name:        filename,
+					ContentType: qr.ContentType(),
 					Reader:      bytes.NewReader(result.QRCode),
 				},
 			},
@@ -246,12 +270,213 @@ func (h *CommandHandler) Handle2FAGenerate(s *discordgo.Session, i *discordgo.In
 
 	err = s.InteractionRespond(i.Interaction, response)
 	if err != nil {
-		logger.Error("Failed to respond to interaction:", err)
+		logger.Error("Failed to respond to interaction", "interaction_id", i.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-generate", "error")
 		h.respondWithError(s, i, "Failed to send response.")
 		return
 	}
 
-	logger.Info("2FA secret generated for user:", username, "(", userID, ")")
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionGenerate,
+		ActorID:   userID,
+		ActorName: username,
+		GuildID:   i.GuildID,
+		Command:   "2fa-generate",
+		Entry:     audit.Fingerprint(result.Secret),
+		Outcome:   "success",
+		Details: map[string]string{
+			"issuer":  issuer,
+			"account": accountName,
+			"format":  qr.Format,
+		},
+	})
+
+	metrics.CommandsTotal.Inc("2fa-generate", "success")
+	logger.Info("2FA secret generated", "user_id", userID, "username", username, "guild_id", i.GuildID, "command", "2fa-generate")
+}
+
+func (h *CommandHandler) Handle2FAVerify(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in 2FA verify handler", "panic", r)
+			h.respondWithError(s, i, "An unexpected error occurred. Please try again later.")
+		}
+	}()
+
+	if !h.validateInteraction(s, i) {
+		return
+	}
+
+	userID := i.Member.User.ID
+	username := i.Member.User.Username
+
+	if !h.checkGuildPolicy(s, i, "2fa-verify") {
+		return
+	}
+
+	if !h.allowRequest(s, i, "2fa-verify") {
+		return
+	}
+
+	if !h.permChecker.HasPermission(s, i) {
+		h.denyAccess(s, i, "2fa-verify")
+		return
+	}
+
+	var secret, code string
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "secret":
+			secret = strings.TrimSpace(option.StringValue())
+		case "code":
+			code = strings.TrimSpace(option.StringValue())
+		}
+	}
+
+	if len(secret) > 256 {
+		metrics.ValidationFailures.Inc("too_long")
+		metrics.CommandsTotal.Inc("2fa-verify", "invalid")
+		h.respondWithFailure(s, i, "2fa-verify", "invalid_secret", "Secret key is too long.")
+		return
+	}
+
+	valid, err := h.totpGen.Verify(secret, code)
+	if err != nil {
+		if reason := totp.ValidationReason(err); reason != "" {
+			metrics.ValidationFailures.Inc(reason)
+		}
+		metrics.CommandsTotal.Inc("2fa-verify", "invalid")
+		h.respondWithFailure(s, i, "2fa-verify", "invalid_secret", err.Error())
+		return
+	}
+
+	if !valid {
+		logger.Info("2FA code verification failed", "user_id", userID, "guild_id", i.GuildID, "command", "2fa-verify")
+		metrics.CommandsTotal.Inc("2fa-verify", "invalid")
+		h.respondWithFailure(s, i, "2fa-verify", "verify_failed", "The code is not valid for this secret key.")
+		return
+	}
+
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionView,
+		ActorID:   userID,
+		ActorName: username,
+		GuildID:   i.GuildID,
+		Command:   "2fa-verify",
+		Entry:     audit.Fingerprint(secret),
+		Outcome:   "verified",
+	})
+
+	metrics.CommandsTotal.Inc("2fa-verify", "success")
+	logger.Info("2FA code verified", "user_id", userID, "username", username, "guild_id", i.GuildID, "command", "2fa-verify")
+	h.respondWithMessage(s, i, "The code is valid for this secret key.")
+}
+
+func (h *CommandHandler) allowRequest(s *discordgo.Session, i *discordgo.InteractionCreate, command string) bool {
+	req := ratelimit.Request{
+		UserID:  i.Member.User.ID,
+		GuildID: i.GuildID,
+		Command: command,
+		Roles:   i.Member.Roles,
+	}
+	if cooldown := h.permChecker.GuildSettings(i.GuildID).CooldownSeconds; cooldown > 0 {
+		req.UserLimit = ratelimit.Limit{Count: 1, Period: time.Duration(cooldown) * time.Second}
+	}
+
+	decision := h.rateLimiter.Allow(req)
+	if decision.Allowed {
+		return true
+	}
+
+	logger.Debug("Rate limit exceeded",
+		"user_id", i.Member.User.ID,
+		"guild_id", i.GuildID,
+		"command", command,
+		"scope", decision.Scope,
+		"retry_after", decision.RetryAfter,
+	)
+	metrics.CooldownRejections.Inc(command)
+	metrics.CommandsTotal.Inc(command, "cooldown")
+	h.respondWithError(s, i, decision.Message())
+	return false
+}
+
+func (h *CommandHandler) checkGuildPolicy(s *discordgo.Session, i *discordgo.InteractionCreate, command string) bool {
+	reason := h.permChecker.CheckGuildPolicy(i, command)
+	if reason == "" {
+		return true
+	}
+
+	logger.Debug("Command blocked by guild policy", "user_id", i.Member.User.ID, "guild_id", i.GuildID, "channel_id", i.ChannelID, "command", command)
+	metrics.CommandsTotal.Inc(command, "disabled")
+	h.respondWithError(s, i, reason)
+	return false
+}
+
+func (h *CommandHandler) denyAccess(s *discordgo.Session, i *discordgo.InteractionCreate, command string) {
+	h.permChecker.LogUnauthorizedAccess(i.Member.User.ID, i.Member.User.Username, command)
+	metrics.CommandsTotal.Inc(command, "denied")
+	h.respondWithFailure(s, i, command, "permission_denied", "You don't have permission to use this command.")
+}
+
+func (h *CommandHandler) respondWithFailure(s *discordgo.Session, i *discordgo.InteractionCreate, command, reason, message string) {
+	if notice := h.recordFailure(s, i, command, reason); notice != "" {
+		message += "\n" + notice
+	}
+	h.respondWithError(s, i, message)
+}
+
+func (h *CommandHandler) recordFailure(s *discordgo.Session, i *discordgo.InteractionCreate, command, reason string) string {
+	userID := i.Member.User.ID
+	metrics.FailedAttempts.Inc(reason)
+
+	lockout := h.rateLimiter.RecordFailure(userID)
+	if !lockout.Triggered {
+		return ""
+	}
+
+	metrics.Lockouts.Inc(reason)
+	logger.Warn("User locked out after repeated failures",
+		"user_id", userID,
+		"guild_id", i.GuildID,
+		"command", command,
+		"reason", reason,
+		"level", lockout.Level,
+		"duration", lockout.Duration,
+	)
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionLockout,
+		ActorID:   userID,
+		ActorName: i.Member.User.Username,
+		GuildID:   i.GuildID,
+		Command:   command,
+		Outcome:   "locked",
+		Details: map[string]string{
+			"reason":   reason,
+			"level":    fmt.Sprint(lockout.Level),
+			"duration": lockout.Duration.String(),
+		},
+	})
+	h.notifyLockout(s, i, command, reason, lockout)
+
+	return lockout.Message()
+}
+
+func (h *CommandHandler) notifyLockout(s *discordgo.Session, i *discordgo.InteractionCreate, command, reason string, lockout ratelimit.Lockout) {
+	if h.alertChannelID == "" {
+		return
+	}
+
+	_, err := s.ChannelMessageSendComplex(h.alertChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("<@%s> has been locked out until <t:%d:f> (level %d) after %d failed attempts. Last failure: `%s` on `/%s`. Use `/2fa-admin clear-lockout` to lift it.",
+			i.Member.User.ID, lockout.Until.Unix(), lockout.Level, lockout.Failures, reason, command),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse: []discordgo.AllowedMentionType{},
+		},
+	})
+	if err != nil {
+		logger.Error("Failed to send lockout alert", "channel_id", h.alertChannelID, "error", err)
+	}
 }
 
 func (h *CommandHandler) validateInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
@@ -272,22 +497,34 @@ func (h *CommandHandler) respondWithError(s *discordgo.Session, i *discordgo.Int
 	})
 
 	if err != nil {
-		logger.Error("Failed to send error response:", err)
+		logger.Error("Failed to send error response", "interaction_id", i.ID, "error", err)
 	}
 }
 
-func (h *CommandHandler) StartCleanupRoutine() {
+func (h *CommandHandler) recordAudit(event audit.Event) {
+	if err := h.auditLog.Record(event); err != nil {
+		logger.Error("Failed to write audit record", "action", event.Action, "error", err)
+	}
+}
+
+func (h *CommandHandler) RunCleanupRoutine(ctx context.Context) {
 	ticker := time.NewTicker(5 * time.Minute)
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				logger.Error("Panic in cleanup routine:", r)
-			}
-		}()
+	defer ticker.Stop()
 
-		for range ticker.C {
-			h.cooldownManager.CleanupExpired()
-			logger.Debug("Cleaned up expired cooldowns")
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in cleanup routine", "panic", r)
 		}
 	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("Cleanup routine stopped")
+			return
+		case <-ticker.C:
+			h.rateLimiter.CleanupExpired()
+			logger.Debug("Cleaned up expired rate limit buckets")
+		}
+	}
 }
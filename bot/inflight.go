@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"context"
+	"sync"
+)
+
+type InFlight struct {
+	mutex   sync.Mutex
+	closed  bool
+	count   int
+	handles sync.WaitGroup
+}
+
+func NewInFlight() *InFlight {
+	return &InFlight{}
+}
+
+func (f *InFlight) Begin() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return false
+	}
+	f.count++
+	f.handles.Add(1)
+	return true
+}
+
+func (f *InFlight) End() {
+	f.mutex.Lock()
+	f.count--
+	f.mutex.Unlock()
+
+	f.handles.Done()
+}
+
+func (f *InFlight) Active() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.count
+}
+
+func (f *InFlight) Closed() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.closed
+}
+
+func (f *InFlight) Drain(ctx context.Context) error {
+	f.mutex.Lock()
+	f.closed = true
+	f.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		f.handles.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
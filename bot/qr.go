@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"net/http"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/totp"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord drops interactions that are not answered within three seconds, so the
+// logo download has to fit comfortably inside that window.
+const logoDownloadTimeout = 2 * time.Second
+
+func qrOptionsFromInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) (totp.QROptions, error) {
+	data := i.ApplicationCommandData()
+	opts := totp.DefaultQROptions()
+	opts.Size = optionInt(data.Options, "size", opts.Size)
+
+	if recovery := optionString(data.Options, "recovery"); recovery != "" {
+		opts.Recovery = recovery
+	}
+	if format := optionString(data.Options, "format"); format != "" {
+		opts.Format = format
+	}
+
+	var err error
+	if value := optionString(data.Options, "foreground"); value != "" {
+		if opts.Foreground, err = totp.ParseColor(value); err != nil {
+			return opts, err
+		}
+	}
+	if value := optionString(data.Options, "background"); value != "" {
+		if opts.Background, err = totp.ParseColor(value); err != nil {
+			return opts, err
+		}
+	}
+
+	if id := optionAttachmentID(data.Options, "logo"); id != "" {
+		if data.Resolved == nil || data.Resolved.Attachments[id] == nil {
+			return opts, fmt.Errorf("the logo attachment could not be read")
+		}
+		if opts.Logo, err = downloadLogo(s, data.Resolved.Attachments[id]); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, opts.Validate()
+}
+
+func downloadLogo(s *discordgo.Session, attachment *discordgo.MessageAttachment) (image.Image, error) {
+	if attachment.Size > totp.MaxLogoBytes {
+		return nil, totp.ErrLogoTooLarge
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), logoDownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, attachment.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("the logo attachment could not be read")
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("the logo attachment could not be downloaded")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the logo attachment could not be downloaded")
+	}
+	return totp.LoadLogo(resp.Body)
+}
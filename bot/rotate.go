@@ -0,0 +1,272 @@
+package bot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+	"Discord-Bot-2FA-Key-Gen/totp"
+	"Discord-Bot-2FA-Key-Gen/vault"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const rotationHistoryShown = 5
+
+func (h *CommandHandler) Handle2FARotate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in 2FA rotate handler", "panic", r)
+			h.respondWithError(s, i, "An unexpected error occurred. Please try again later.")
+		}
+	}()
+
+	if !h.validateInteraction(s, i) {
+		return
+	}
+
+	if i.GuildID == "" {
+		h.respondWithError(s, i, "Rotation works on shared entries, which belong to a server. Use this command from within one.")
+		return
+	}
+
+	if !h.checkGuildPolicy(s, i, "2fa-rotate") {
+		return
+	}
+
+	if !h.allowRequest(s, i, "2fa-rotate") {
+		return
+	}
+
+	if h.vault == nil {
+		metrics.CommandsTotal.Inc("2fa-rotate", "disabled")
+		h.respondWithError(s, i, "Shared entries are not enabled on this bot.")
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		h.respondWithError(s, i, "Please choose a rotation action.")
+		return
+	}
+
+	subcommand := options[0]
+	entry, ok := h.findSharedEntry(s, i, "2fa-rotate", optionString(subcommand.Options, "name"))
+	if !ok {
+		return
+	}
+
+	allowed := h.permChecker.CanManageSharedEntry(i, entry)
+	if subcommand.Name == "status" {
+		allowed = h.permChecker.CanUseSharedEntry(i, entry)
+	}
+	if !allowed {
+		h.denyAccess(s, i, "2fa-rotate")
+		return
+	}
+
+	switch subcommand.Name {
+	case "start":
+		h.startRotation(s, i, "2fa-rotate", entry, optionString(subcommand.Options, "secret"))
+	case "confirm":
+		h.confirmRotation(s, i, entry, optionString(subcommand.Options, "code"))
+	case "cancel":
+		h.cancelRotation(s, i, entry)
+	case "status":
+		metrics.CommandsTotal.Inc("2fa-rotate", "success")
+		h.respondWithMessage(s, i, formatRotationStatus(entry))
+	default:
+		h.respondWithError(s, i, "Unknown rotation action.")
+	}
+}
+
+func (h *CommandHandler) startRotation(s *discordgo.Session, i *discordgo.InteractionCreate, command string, entry vault.Entry, secret string) {
+	source := "generated"
+	key := totp.NewKey(entry.Issuer, entry.Account, "")
+	if secret != "" {
+		source = "provided"
+		var err error
+		if key, err = h.sharedKey(secret, entry.Issuer, entry.Account); err != nil {
+			metrics.CommandsTotal.Inc(command, "invalid")
+			h.respondWithFailure(s, i, command, "invalid_secret", fmt.Sprintf("Invalid secret: %s", err))
+			return
+		}
+	} else {
+		result, err := h.totpGen.GenerateSecret(entry.Issuer, entry.Account, totp.DefaultQROptions())
+		if err != nil {
+			logger.Error("Secret generation failed", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+			metrics.CommandsTotal.Inc(command, "error")
+			h.respondWithError(s, i, "Failed to generate a new secret.")
+			return
+		}
+		key.Secret = result.Secret
+	}
+
+	qrCode, err := totp.RenderQR(key.URI(), totp.DefaultQROptions())
+	if err != nil {
+		logger.Error("Failed to generate QR code", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc(command, "error")
+		h.respondWithError(s, i, "Failed to generate the QR code.")
+		return
+	}
+
+	if current, err := h.vault.StartRotation(entry.ID, i.Member.User.ID, key); errors.Is(err, vault.ErrRotationPending) {
+		metrics.CommandsTotal.Inc(command, "invalid")
+		h.respondWithError(s, i, fmt.Sprintf("A rotation of **%s** has been pending since <t:%d:R>. Confirm it with a code from the new secret or cancel it first.",
+			current.Name, current.PendingSince.Unix()))
+		return
+	} else if err != nil {
+		logger.Error("Failed to start rotation", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc(command, "error")
+		h.respondWithError(s, i, "Failed to save the new secret.")
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Rotating %s", entry.Name),
+		Color: 0xFF9800,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  "New Secret Key",
+				Value: fmt.Sprintf("||%s||", key.Secret),
+			},
+			{
+				Name: "Next Steps",
+				Value: fmt.Sprintf("1. Enrol the new secret with the service, scanning the QR code or entering the key\n"+
+					"2. Run `/2fa-rotate confirm name:%s code:` with a code from the new secret\n"+
+					"Until then `/2fa-shared code` keeps using the old secret.", entry.Name),
+			},
+		},
+		Image: &discordgo.MessageEmbedImage{
+			URL: "attachment://qrcode.png",
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Files: []*discordgo.File{
+				{
+					Name:        "qrcode.png",
+					ContentType: "image/png",
+					Reader:      bytes.NewReader(qrCode),
+				},
+			},
+		},
+	})
+	if err != nil {
+		// Nobody saw the new secret, so it can never be confirmed.
+		logger.Error("Failed to respond to interaction", "interaction_id", i.ID, "error", err)
+		if _, err := h.vault.CancelRotation(entry.ID, i.Member.User.ID); err != nil {
+			logger.Error("Failed to cancel rotation", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		}
+		metrics.CommandsTotal.Inc(command, "error")
+		return
+	}
+
+	h.recordRotation(i, command, entry, "start", map[string]string{"source": source})
+	metrics.CommandsTotal.Inc(command, "success")
+}
+
+func (h *CommandHandler) confirmRotation(s *discordgo.Session, i *discordgo.InteractionCreate, entry vault.Entry, code string) {
+	_, err := h.vault.CompleteRotation(entry.ID, i.Member.User.ID, func(key *totp.Key) bool {
+		valid, err := key.Verify(code, time.Now())
+		return err == nil && valid
+	})
+	switch {
+	case errors.Is(err, vault.ErrNoPendingRotation):
+		metrics.CommandsTotal.Inc("2fa-rotate", "invalid")
+		h.respondWithError(s, i, fmt.Sprintf("**%s** has no pending rotation. Start one with `/2fa-rotate start`.", entry.Name))
+		return
+	case errors.Is(err, vault.ErrRotationNotConfirmed):
+		metrics.CommandsTotal.Inc("2fa-rotate", "invalid")
+		h.respondWithFailure(s, i, "2fa-rotate", "invalid_code",
+			"That code does not match the new secret. Check the authenticator entry you just added and try again; the old secret is still active.")
+		return
+	case err != nil:
+		logger.Error("Failed to complete rotation", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-rotate", "error")
+		h.respondWithError(s, i, "Failed to save the rotation.")
+		return
+	}
+
+	h.recordRotation(i, "2fa-rotate", entry, "complete", map[string]string{"started_by": entry.PendingBy})
+	metrics.CommandsTotal.Inc("2fa-rotate", "success")
+	h.respondWithMessage(s, i, fmt.Sprintf("Rotation of **%s** confirmed. The old secret is retired and `/2fa-shared code` now uses the new one.", entry.Name))
+}
+
+func (h *CommandHandler) cancelRotation(s *discordgo.Session, i *discordgo.InteractionCreate, entry vault.Entry) {
+	_, err := h.vault.CancelRotation(entry.ID, i.Member.User.ID)
+	if errors.Is(err, vault.ErrNoPendingRotation) {
+		metrics.CommandsTotal.Inc("2fa-rotate", "invalid")
+		h.respondWithError(s, i, fmt.Sprintf("**%s** has no pending rotation.", entry.Name))
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to cancel rotation", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-rotate", "error")
+		h.respondWithError(s, i, "Failed to save the shared entry.")
+		return
+	}
+
+	h.recordRotation(i, "2fa-rotate", entry, "cancel", nil)
+	metrics.CommandsTotal.Inc("2fa-rotate", "success")
+	h.respondWithMessage(s, i, fmt.Sprintf("Pending rotation of **%s** cancelled. The old secret stays active.", entry.Name))
+}
+
+func (h *CommandHandler) recordRotation(i *discordgo.InteractionCreate, command string, entry vault.Entry, change string, details map[string]string) {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["name"] = entry.Name
+	details["action"] = change
+
+	logger.Info("Shared entry rotation", "actor_id", i.Member.User.ID, "guild_id", i.GuildID, "entry_id", entry.ID, "action", change)
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionRotate,
+		ActorID:   i.Member.User.ID,
+		ActorName: i.Member.User.Username,
+		GuildID:   i.GuildID,
+		Command:   command,
+		Entry:     entry.ID,
+		Outcome:   "success",
+		Details:   details,
+	})
+}
+
+func formatRotationStatus(entry vault.Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**\n", entry.Name)
+	if entry.PendingSince != nil {
+		fmt.Fprintf(&b, "**Pending:** started by <@%s> <t:%d:R>; the old secret stays active until a code from the new one is confirmed\n",
+			entry.PendingBy, entry.PendingSince.Unix())
+	} else {
+		b.WriteString("**Pending:** none\n")
+	}
+
+	if len(entry.History) == 0 {
+		b.WriteString("**History:** never rotated")
+		return b.String()
+	}
+	b.WriteString("**History:**")
+	history := entry.History[max(0, len(entry.History)-rotationHistoryShown):]
+	for idx := len(history) - 1; idx >= 0; idx-- {
+		rotation := history[idx]
+		fmt.Fprintf(&b, "\n- %s <t:%d:f> by <@%s>", rotation.Outcome, rotation.CompletedAt.Unix(), rotation.CompletedBy)
+		if rotation.StartedBy != "" && rotation.StartedBy != rotation.CompletedBy {
+			fmt.Fprintf(&b, ", started by <@%s>", rotation.StartedBy)
+		}
+	}
+	if hidden := len(entry.History) - len(history); hidden > 0 {
+		fmt.Fprintf(&b, "\n…and %d earlier", hidden)
+	}
+	return b.String()
+}
@@ -0,0 +1,522 @@
+package bot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/audit"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+	"Discord-Bot-2FA-Key-Gen/sheet"
+	"Discord-Bot-2FA-Key-Gen/totp"
+	"Discord-Bot-2FA-Key-Gen/vault"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func (h *CommandHandler) Handle2FAShared(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in 2FA shared handler", "panic", r)
+			h.respondWithError(s, i, "An unexpected error occurred. Please try again later.")
+		}
+	}()
+
+	if !h.validateInteraction(s, i) {
+		return
+	}
+
+	if i.GuildID == "" {
+		h.respondWithError(s, i, "Shared entries belong to a server and can only be used from within one.")
+		return
+	}
+
+	if h.vault == nil {
+		metrics.CommandsTotal.Inc("2fa-shared", "disabled")
+		h.respondWithError(s, i, "Shared entries are not enabled on this bot.")
+		return
+	}
+
+	if !h.checkGuildPolicy(s, i, "2fa-shared") {
+		return
+	}
+
+	if !h.allowRequest(s, i, "2fa-shared") {
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		h.respondWithError(s, i, "Please choose a shared entry action.")
+		return
+	}
+
+	subcommand := options[0]
+	switch subcommand.Name {
+	case "list":
+		h.listSharedEntries(s, i)
+	case "add":
+		h.addSharedEntry(s, i, subcommand)
+	case "code":
+		h.sharedEntryCode(s, i, subcommand)
+	case "sheet":
+		h.sharedEntrySheet(s, i, subcommand)
+	default:
+		h.manageSharedEntry(s, i, subcommand)
+	}
+}
+
+func (h *CommandHandler) listSharedEntries(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	entries := h.vault.List(func(entry vault.Entry) bool {
+		return h.permChecker.CanUseSharedEntry(i, entry)
+	})
+
+	metrics.CommandsTotal.Inc("2fa-shared", "success")
+	if len(entries) == 0 {
+		h.respondWithMessage(s, i, "There are no shared entries you can use on this server.")
+		return
+	}
+
+	blocks := make([]string, len(entries))
+	for idx, entry := range entries {
+		blocks[idx] = formatSharedEntry(entry)
+	}
+	h.respondWithMessage(s, i, strings.Join(blocks, "\n\n"))
+}
+
+func (h *CommandHandler) addSharedEntry(s *discordgo.Session, i *discordgo.InteractionCreate, subcommand *discordgo.ApplicationCommandInteractionDataOption) {
+	if !h.permChecker.IsGuildManager(i) {
+		h.denyAccess(s, i, "2fa-shared")
+		return
+	}
+
+	name := optionString(subcommand.Options, "name")
+	key, err := h.sharedKey(optionString(subcommand.Options, "secret"), optionString(subcommand.Options, "issuer"), optionString(subcommand.Options, "account"))
+	if err != nil {
+		metrics.CommandsTotal.Inc("2fa-shared", "invalid")
+		h.respondWithFailure(s, i, "2fa-shared", "invalid_secret", fmt.Sprintf("Invalid secret: %s", err))
+		return
+	}
+
+	entry := vault.Entry{
+		Name:      name,
+		Owner:     vault.GuildOwner(i.GuildID),
+		CreatedBy: i.Member.User.ID,
+	}
+	if roleID := optionRoleID(subcommand.Options, "role"); roleID != "" {
+		entry.AccessRoles = []string{roleID}
+	}
+
+	entry, err = h.vault.Add(entry, key)
+	if errors.Is(err, vault.ErrDuplicate) {
+		metrics.CommandsTotal.Inc("2fa-shared", "invalid")
+		h.respondWithError(s, i, fmt.Sprintf("A shared entry named `%s` already exists on this server.", name))
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to store shared entry", "guild_id", i.GuildID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-shared", "error")
+		h.respondWithError(s, i, "Failed to save the shared entry.")
+		return
+	}
+
+	h.recordSharedChange(i, audit.ActionSave, entry, "add", "")
+	metrics.CommandsTotal.Inc("2fa-shared", "success")
+	h.respondWithMessage(s, i, "Shared entry created.\n\n"+formatSharedEntry(entry))
+}
+
+func (h *CommandHandler) sharedEntryCode(s *discordgo.Session, i *discordgo.InteractionCreate, subcommand *discordgo.ApplicationCommandInteractionDataOption) {
+	entry, ok := h.findSharedEntry(s, i, "2fa-shared", optionString(subcommand.Options, "name"))
+	if !ok {
+		return
+	}
+	if !h.permChecker.CanUseSharedEntry(i, entry) {
+		h.denyAccess(s, i, "2fa-shared")
+		return
+	}
+	if entry.RequiresApproval {
+		h.requestApproval(s, i, entry, optionBool(subcommand.Options, "dm"))
+		return
+	}
+
+	key, err := h.vault.Key(entry)
+	if err != nil {
+		logger.Error("Failed to open shared entry", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-shared", "error")
+		h.respondWithError(s, i, "Failed to read the shared entry.")
+		return
+	}
+
+	now := time.Now()
+	code, err := key.Code(now)
+	if err != nil {
+		logger.Error("Failed to generate code for shared entry", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-shared", "error")
+		h.respondWithError(s, i, "Failed to generate a code.")
+		return
+	}
+	expires := now.Add(key.Remaining(now))
+
+	h.respondWithMessage(s, i, fmt.Sprintf("**%s**\nCode: `%s %s`\nExpires <t:%d:R>",
+		entry.Name, code[:len(code)/2], code[len(code)/2:], expires.Unix()))
+
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionView,
+		ActorID:   i.Member.User.ID,
+		ActorName: i.Member.User.Username,
+		GuildID:   i.GuildID,
+		Command:   "2fa-shared",
+		Entry:     entry.ID,
+		Outcome:   "success",
+		Details:   map[string]string{"name": entry.Name},
+	})
+	h.announceSharedCode(s, i, entry)
+
+	metrics.CommandsTotal.Inc("2fa-shared", "success")
+	logger.Info("Shared entry code retrieved", "user_id", i.Member.User.ID, "guild_id", i.GuildID, "entry_id", entry.ID)
+}
+
+func (h *CommandHandler) sharedEntrySheet(s *discordgo.Session, i *discordgo.InteractionCreate, subcommand *discordgo.ApplicationCommandInteractionDataOption) {
+	entry, ok := h.findSharedEntry(s, i, "2fa-shared", optionString(subcommand.Options, "name"))
+	if !ok {
+		return
+	}
+	if !h.permChecker.CanManageSharedEntry(i, entry) {
+		h.denyAccess(s, i, "2fa-shared")
+		return
+	}
+
+	key, err := h.vault.Key(entry)
+	if err != nil {
+		logger.Error("Failed to open shared entry", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-shared", "error")
+		h.respondWithError(s, i, "Failed to read the shared entry.")
+		return
+	}
+	recovery := sheet.Sheet{Key: key, Created: entry.CreatedAt}
+	if codes, err := h.vault.BackupCodes(entry); err == nil {
+		for _, code := range codes {
+			if code.UsedAt == nil {
+				recovery.BackupCodes = append(recovery.BackupCodes, code.Code)
+			}
+		}
+	}
+
+	pngData, err := recovery.PNG()
+	var pdfData []byte
+	if err == nil {
+		pdfData, err = recovery.PDF()
+	}
+	if err != nil {
+		logger.Error("Failed to render recovery sheet", "guild_id", i.GuildID, "entry_id", entry.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-shared", "error")
+		h.respondWithError(s, i, "Failed to render the recovery sheet.")
+		return
+	}
+
+	filename := "recovery-sheet-" + sheetFilename(entry.Name)
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Recovery sheet for **%s** (%s).\nChecksum: `%s`\nPrint it, store it offline and delete the download.",
+				entry.Name, formatCount(len(recovery.BackupCodes), "unused backup code"), recovery.Checksum()),
+			Flags: discordgo.MessageFlagsEphemeral,
+			Files: []*discordgo.File{
+				{Name: filename + ".png", ContentType: "image/png", Reader: bytes.NewReader(pngData)},
+				{Name: filename + ".pdf", ContentType: "application/pdf", Reader: bytes.NewReader(pdfData)},
+			},
+		},
+	})
+	if err != nil {
+		logger.Error("Failed to respond to interaction", "interaction_id", i.ID, "error", err)
+		metrics.CommandsTotal.Inc("2fa-shared", "error")
+		return
+	}
+
+	h.recordAudit(audit.Event{
+		Action:    audit.ActionView,
+		ActorID:   i.Member.User.ID,
+		ActorName: i.Member.User.Username,
+		GuildID:   i.GuildID,
+		Command:   "2fa-shared",
+		Entry:     entry.ID,
+		Outcome:   "success",
+		Details:   map[string]string{"name": entry.Name, "action": "sheet", "checksum": recovery.Checksum()},
+	})
+	metrics.CommandsTotal.Inc("2fa-shared", "success")
+	logger.Info("Recovery sheet generated", "user_id", i.Member.User.ID, "guild_id", i.GuildID, "entry_id", entry.ID)
+}
+
+func formatCount(count int, noun string) string {
+	if count == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+func sheetFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name)
+}
+
+func (h *CommandHandler) manageSharedEntry(s *discordgo.Session, i *discordgo.InteractionCreate, subcommand *discordgo.ApplicationCommandInteractionDataOption) {
+	entry, ok := h.findSharedEntry(s, i, "2fa-shared", optionString(subcommand.Options, "name"))
+	if !ok {
+		return
+	}
+	if !h.permChecker.CanManageSharedEntry(i, entry) {
+		h.denyAccess(s, i, "2fa-shared")
+		return
+	}
+
+	userID := i.Member.User.ID
+	entryID := entry.ID
+	action := audit.ActionShare
+	value := ""
+	var err error
+
+	switch subcommand.Name {
+	case "grant":
+		value = optionRoleID(subcommand.Options, "role")
+		manage := optionBool(subcommand.Options, "manage")
+		entry, err = h.vault.Update(entry.ID, userID, func(entry *vault.Entry) error {
+			if manage {
+				return toggleID(&entry.ManagerRoles, value, true, "role")
+			}
+			return toggleID(&entry.AccessRoles, value, true, "role")
+		})
+	case "revoke":
+		value = optionRoleID(subcommand.Options, "role")
+		entry, err = h.vault.Update(entry.ID, userID, func(entry *vault.Entry) error {
+			access := toggleID(&entry.AccessRoles, value, false, "role")
+			managers := toggleID(&entry.ManagerRoles, value, false, "role")
+			approvers := toggleID(&entry.ApproverRoles, value, false, "role")
+			if access != nil && managers != nil && approvers != nil {
+				return access
+			}
+			if entry.RequiresApproval && len(entry.ApproverRoles) == 0 {
+				return invalidSettingError("That role is the entry's last approver. Add another approver role or turn approval off first.")
+			}
+			return nil
+		})
+	case "announce":
+		value = optionChannelID(subcommand.Options, "channel")
+		entry, err = h.vault.Update(entry.ID, userID, func(entry *vault.Entry) error {
+			entry.AnnounceChannelID = value
+			return nil
+		})
+	case "approval":
+		required := optionBool(subcommand.Options, "required")
+		roleID := optionRoleID(subcommand.Options, "role")
+		channelID := optionChannelID(subcommand.Options, "channel")
+		value = fmt.Sprintf("required=%t", required)
+		entry, err = h.vault.Update(entry.ID, userID, func(entry *vault.Entry) error {
+			return setApproval(entry, required, roleID, channelID)
+		})
+	case "rotate":
+		// Same workflow as /2fa-rotate start: the new secret stays pending until
+		// a code from it is confirmed.
+		h.startRotation(s, i, "2fa-shared", entry, optionString(subcommand.Options, "secret"))
+		return
+	case "delete":
+		action = audit.ActionDelete
+		err = h.vault.Delete(entry.ID)
+	default:
+		h.respondWithError(s, i, "Unknown shared entry action.")
+		return
+	}
+
+	if err != nil {
+		var invalid invalidSettingError
+		if errors.As(err, &invalid) {
+			metrics.CommandsTotal.Inc("2fa-shared", "invalid")
+			h.respondWithError(s, i, err.Error())
+			return
+		}
+		logger.Error("Failed to update shared entry", "guild_id", i.GuildID, "entry_id", entryID, "action", subcommand.Name, "error", err)
+		metrics.CommandsTotal.Inc("2fa-shared", "error")
+		h.respondWithError(s, i, "Failed to save the shared entry.")
+		return
+	}
+
+	h.recordSharedChange(i, action, entry, subcommand.Name, value)
+	metrics.CommandsTotal.Inc("2fa-shared", "success")
+	if subcommand.Name == "delete" {
+		h.respondWithMessage(s, i, fmt.Sprintf("Shared entry **%s** deleted.", entry.Name))
+		return
+	}
+	h.respondWithMessage(s, i, "Shared entry updated.\n\n"+formatSharedEntry(entry))
+}
+
+func (h *CommandHandler) findSharedEntry(s *discordgo.Session, i *discordgo.InteractionCreate, command, name string) (vault.Entry, bool) {
+	entry, err := h.vault.Find(vault.GuildOwner(i.GuildID), name)
+	if err != nil {
+		metrics.CommandsTotal.Inc(command, "invalid")
+		h.respondWithError(s, i, fmt.Sprintf("No shared entry named `%s` exists on this server.", name))
+		return vault.Entry{}, false
+	}
+	return entry, true
+}
+
+func (h *CommandHandler) sharedKey(secret, issuer, account string) (*totp.Key, error) {
+	secret = strings.TrimSpace(secret)
+	if !strings.HasPrefix(secret, "otpauth://") {
+		if err := h.totpGen.ValidateSecret(secret); err != nil {
+			return nil, err
+		}
+		return totp.NewKey(issuer, account, totp.NormalizeSecret(secret)), nil
+	}
+
+	key, err := totp.ParseURI(secret)
+	if err != nil {
+		return nil, err
+	}
+	if issuer != "" {
+		key.Issuer = issuer
+	}
+	if account != "" {
+		key.Account = account
+	}
+	return key, nil
+}
+
+func (h *CommandHandler) announceSharedCode(s *discordgo.Session, i *discordgo.InteractionCreate, entry vault.Entry) {
+	if entry.AnnounceChannelID == "" {
+		return
+	}
+
+	_, err := s.ChannelMessageSendComplex(entry.AnnounceChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("<@%s> retrieved a code for the shared entry **%s** in <#%s>.", i.Member.User.ID, entry.Name, i.ChannelID),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse: []discordgo.AllowedMentionType{},
+		},
+	})
+	if err != nil {
+		logger.Error("Failed to announce shared code retrieval", "channel_id", entry.AnnounceChannelID, "entry_id", entry.ID, "error", err)
+	}
+}
+
+func (h *CommandHandler) recordSharedChange(i *discordgo.InteractionCreate, action audit.Action, entry vault.Entry, change, value string) {
+	logger.Info("Shared entry changed", "actor_id", i.Member.User.ID, "guild_id", i.GuildID, "entry_id", entry.ID, "action", change, "value", value)
+	h.recordAudit(audit.Event{
+		Action:    action,
+		ActorID:   i.Member.User.ID,
+		ActorName: i.Member.User.Username,
+		GuildID:   i.GuildID,
+		Command:   "2fa-shared",
+		Entry:     entry.ID,
+		Outcome:   "success",
+		Details:   map[string]string{"name": entry.Name, "action": change, "value": value},
+	})
+}
+
+func formatSharedEntry(entry vault.Entry) string {
+	label := entry.Issuer
+	if entry.Account != "" {
+		label = strings.TrimPrefix(label+": "+entry.Account, ": ")
+	}
+	if label != "" {
+		label = " (" + label + ")"
+	}
+
+	announce := "off"
+	if entry.AnnounceChannelID != "" {
+		announce = fmt.Sprintf("<#%s>", entry.AnnounceChannelID)
+	}
+
+	approval := "not required"
+	if entry.RequiresApproval {
+		approval = fmt.Sprintf("required from %s in <#%s>", formatMentions(entry.ApproverRoles, "<@&%s>", "nobody"), entry.ApprovalChannelID)
+	}
+
+	return fmt.Sprintf("**%s**%s\n**ID:** `%s`\n**Access:** %s\n**Managers:** %s\n**Announcements:** %s\n**Approval:** %s",
+		entry.Name, label, entry.ID,
+		formatMentions(entry.AccessRoles, "<@&%s>", "managers only"),
+		formatMentions(entry.ManagerRoles, "<@&%s>", "server managers only"),
+		announce, approval)
+}
+
+func setApproval(entry *vault.Entry, required bool, roleID, channelID string) error {
+	if roleID != "" && !slices.Contains(entry.ApproverRoles, roleID) {
+		entry.ApproverRoles = append(entry.ApproverRoles, roleID)
+	}
+	if channelID != "" {
+		entry.ApprovalChannelID = channelID
+	}
+	if required {
+		if entry.ApprovalChannelID == "" {
+			return invalidSettingError("Choose a channel where approval requests will be posted.")
+		}
+		if len(entry.ApproverRoles) == 0 {
+			return invalidSettingError("Choose at least one role that can approve requests.")
+		}
+	}
+	entry.RequiresApproval = required
+	return nil
+}
+
+func optionString(options []*discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	for _, option := range options {
+		if option.Name == name {
+			return strings.TrimSpace(option.StringValue())
+		}
+	}
+	return ""
+}
+
+func optionRoleID(options []*discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	for _, option := range options {
+		if option.Name == name {
+			return option.RoleValue(nil, "").ID
+		}
+	}
+	return ""
+}
+
+func optionChannelID(options []*discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	for _, option := range options {
+		if option.Name == name {
+			return option.ChannelValue(nil).ID
+		}
+	}
+	return ""
+}
+
+func optionAttachmentID(options []*discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	for _, option := range options {
+		if option.Name == name {
+			id, _ := option.Value.(string)
+			return id
+		}
+	}
+	return ""
+}
+
+func optionInt(options []*discordgo.ApplicationCommandInteractionDataOption, name string, fallback int) int {
+	for _, option := range options {
+		if option.Name == name {
+			return int(option.IntValue())
+		}
+	}
+	return fallback
+}
+
+func optionBool(options []*discordgo.ApplicationCommandInteractionDataOption, name string) bool {
+	for _, option := range options {
+		if option.Name == name {
+			return option.BoolValue()
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"Discord-Bot-2FA-Key-Gen/logger"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type CommandDiff struct {
+	Scope   string
+	Created []string
+	Updated []string
+	Deleted []string
+}
+
+func (d CommandDiff) Changed() bool {
+	return len(d.Created)+len(d.Updated)+len(d.Deleted) > 0
+}
+
+func SyncCommands(s *discordgo.Session, appID string, guildIDs []string, global bool) ([]CommandDiff, error) {
+	var diffs []CommandDiff
+
+	globalCommands := Commands()
+	if !global {
+		globalCommands = []*discordgo.ApplicationCommand{}
+	}
+	diff, err := syncScope(s, appID, "", globalCommands)
+	if err != nil {
+		return diffs, err
+	}
+	diffs = append(diffs, diff)
+
+	for _, guildID := range guildIDs {
+		diff, err := syncScope(s, appID, guildID, Commands())
+		if err != nil {
+			return diffs, err
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+func syncScope(s *discordgo.Session, appID, guildID string, desired []*discordgo.ApplicationCommand) (CommandDiff, error) {
+	scope := "global"
+	if guildID != "" {
+		scope = "guild:" + guildID
+	}
+
+	existing, err := s.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return CommandDiff{Scope: scope}, fmt.Errorf("failed to list %s commands: %w", scope, err)
+	}
+
+	diff := diffCommands(existing, desired)
+	diff.Scope = scope
+	if !diff.Changed() {
+		logger.Info("Commands already up to date", "scope", scope, "commands", len(desired))
+		return diff, nil
+	}
+
+	if _, err := s.ApplicationCommandBulkOverwrite(appID, guildID, desired); err != nil {
+		return diff, fmt.Errorf("failed to overwrite %s commands: %w", scope, err)
+	}
+
+	logger.Info("Commands synced",
+		"scope", scope,
+		"created", diff.Created,
+		"updated", diff.Updated,
+		"deleted", diff.Deleted,
+	)
+	return diff, nil
+}
+
+func diffCommands(existing, desired []*discordgo.ApplicationCommand) CommandDiff {
+	current := make(map[string]*discordgo.ApplicationCommand, len(existing))
+	for _, command := range existing {
+		current[command.Name] = command
+	}
+
+	var diff CommandDiff
+	for _, command := range desired {
+		previous, ok := current[command.Name]
+		switch {
+		case !ok:
+			diff.Created = append(diff.Created, command.Name)
+		case commandSignature(previous) != commandSignature(command):
+			diff.Updated = append(diff.Updated, command.Name)
+		}
+		delete(current, command.Name)
+	}
+	for name := range current {
+		diff.Deleted = append(diff.Deleted, name)
+	}
+	sort.Strings(diff.Deleted)
+	return diff
+}
+
+func commandSignature(command *discordgo.ApplicationCommand) string {
+	normalized := discordgo.ApplicationCommand{
+		Name:                     command.Name,
+		Description:              command.Description,
+		Options:                  command.Options,
+		DefaultMemberPermissions: command.DefaultMemberPermissions,
+	}
+	if command.DMPermission != nil && !*command.DMPermission {
+		normalized.DMPermission = command.DMPermission
+	}
+
+	data, _ := json.Marshal(normalized)
+	return string(data)
+}
@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func testCommand(name string, options ...*discordgo.ApplicationCommandOption) *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{Name: name, Description: name + " command", Options: options}
+}
+
+func TestDiffCommands(t *testing.T) {
+	yes, no := true, false
+	permissions := int64(discordgo.PermissionManageServer)
+	option := func(name string, required bool) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionString, Name: name, Description: name, Required: required}
+	}
+	// registered mimics a command as Discord returns it, with server-side fields.
+	registered := func(command *discordgo.ApplicationCommand) *discordgo.ApplicationCommand {
+		copied := *command
+		copied.ID, copied.ApplicationID, copied.Version = "1", "app", "2"
+		copied.Type = discordgo.ChatApplicationCommand
+		return &copied
+	}
+
+	tests := []struct {
+		name     string
+		existing []*discordgo.ApplicationCommand
+		desired  []*discordgo.ApplicationCommand
+		want     CommandDiff
+	}{
+		{
+			name:     "unchanged",
+			existing: []*discordgo.ApplicationCommand{registered(testCommand("2fa-code", option("name", true)))},
+			desired:  []*discordgo.ApplicationCommand{testCommand("2fa-code", option("name", true))},
+		},
+		{
+			name:    "created",
+			desired: []*discordgo.ApplicationCommand{testCommand("2fa-code"), testCommand("2fa-qr")},
+			want:    CommandDiff{Created: []string{"2fa-code", "2fa-qr"}},
+		},
+		{
+			name:     "option added",
+			existing: []*discordgo.ApplicationCommand{registered(testCommand("2fa-code"))},
+			desired:  []*discordgo.ApplicationCommand{testCommand("2fa-code", option("name", false))},
+			want:     CommandDiff{Updated: []string{"2fa-code"}},
+		},
+		{
+			name:     "option made required",
+			existing: []*discordgo.ApplicationCommand{registered(testCommand("2fa-code", option("name", false)))},
+			desired:  []*discordgo.ApplicationCommand{testCommand("2fa-code", option("name", true))},
+			want:     CommandDiff{Updated: []string{"2fa-code"}},
+		},
+		{
+			name:     "description changed",
+			existing: []*discordgo.ApplicationCommand{registered(&discordgo.ApplicationCommand{Name: "2fa-code", Description: "old"})},
+			desired:  []*discordgo.ApplicationCommand{testCommand("2fa-code")},
+			want:     CommandDiff{Updated: []string{"2fa-code"}},
+		},
+		{
+			name:     "default permissions changed",
+			existing: []*discordgo.ApplicationCommand{registered(testCommand("2fa-admin"))},
+			desired:  []*discordgo.ApplicationCommand{{Name: "2fa-admin", Description: "2fa-admin command", DefaultMemberPermissions: &permissions}},
+			want:     CommandDiff{Updated: []string{"2fa-admin"}},
+		},
+		{
+			name:     "stale commands deleted",
+			existing: []*discordgo.ApplicationCommand{registered(testCommand("old-b")), registered(testCommand("2fa-code")), registered(testCommand("old-a"))},
+			desired:  []*discordgo.ApplicationCommand{testCommand("2fa-code")},
+			want:     CommandDiff{Deleted: []string{"old-a", "old-b"}},
+		},
+		{
+			name:     "no desired commands deletes everything",
+			existing: []*discordgo.ApplicationCommand{registered(testCommand("2fa-code")), registered(testCommand("2fa-qr"))},
+			want:     CommandDiff{Deleted: []string{"2fa-code", "2fa-qr"}},
+		},
+		{
+			name:     "dm permission true matches unset",
+			existing: []*discordgo.ApplicationCommand{registered(&discordgo.ApplicationCommand{Name: "2fa-code", Description: "2fa-code command", DMPermission: &yes})},
+			desired:  []*discordgo.ApplicationCommand{testCommand("2fa-code")},
+		},
+		{
+			name:     "dm permission disabled",
+			existing: []*discordgo.ApplicationCommand{registered(testCommand("2fa-code"))},
+			desired:  []*discordgo.ApplicationCommand{{Name: "2fa-code", Description: "2fa-code command", DMPermission: &no}},
+			want:     CommandDiff{Updated: []string{"2fa-code"}},
+		},
+		{
+			name:     "dm permission enabled again",
+			existing: []*discordgo.ApplicationCommand{registered(&discordgo.ApplicationCommand{Name: "2fa-code", Description: "2fa-code command", DMPermission: &no})},
+			desired:  []*discordgo.ApplicationCommand{testCommand("2fa-code")},
+			want:     CommandDiff{Updated: []string{"2fa-code"}},
+		},
+		{
+			name:     "mixed",
+			existing: []*discordgo.ApplicationCommand{registered(testCommand("2fa-code")), registered(testCommand("2fa-old")), registered(testCommand("2fa-qr"))},
+			desired:  []*discordgo.ApplicationCommand{testCommand("2fa-code", option("name", true)), testCommand("2fa-qr"), testCommand("2fa-new")},
+			want:     CommandDiff{Created: []string{"2fa-new"}, Updated: []string{"2fa-code"}, Deleted: []string{"2fa-old"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffCommands(tt.existing, tt.desired)
+			if !slices.Equal(got.Created, tt.want.Created) || !slices.Equal(got.Updated, tt.want.Updated) || !slices.Equal(got.Deleted, tt.want.Deleted) {
+				t.Errorf("diffCommands = %+v, want %+v", got, tt.want)
+			}
+			if got.Changed() != tt.want.Changed() {
+				t.Errorf("Changed = %v, want %v", got.Changed(), tt.want.Changed())
+			}
+		})
+	}
+}
+
+// TestCommandsSurviveRoundTrip checks that the bot's own commands, once sent
+// to Discord and read back, are not seen as changed on the next start.
+func TestCommandsSurviveRoundTrip(t *testing.T) {
+	data, err := json.Marshal(Commands())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var existing []*discordgo.ApplicationCommand
+	if err := json.Unmarshal(data, &existing); err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range existing {
+		command.ID, command.Version = "1", "1"
+	}
+
+	if diff := diffCommands(existing, Commands()); diff.Changed() {
+		t.Errorf("diffCommands after a round trip = %+v, want no changes", diff)
+	}
+}
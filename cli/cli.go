@@ -0,0 +1,583 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/api"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/sheet"
+	"Discord-Bot-2FA-Key-Gen/totp"
+	"Discord-Bot-2FA-Key-Gen/vault"
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(c *cli, args []string) int
+}
+
+var commands = []command{
+	{"code", "[-watch] [-plain]", "Print the current code for a secret read from stdin", runCode},
+	{"generate", "[-issuer NAME] [-account NAME] [-no-qr] [-out FILE.png|FILE.svg] [-size N] [-recovery LEVEL] [-fg HEX] [-bg HEX] [-logo PATH]", "Generate a new secret and show its QR code", runGenerate},
+	{"verify", "[CODE]", "Check a code against a secret read from stdin", runVerify},
+	{"qr", "[-issuer NAME] [-account NAME] [-out FILE.png|FILE.svg] [-size N] [-recovery LEVEL] [-fg HEX] [-bg HEX] [-logo PATH]", "Render a secret or otpauth:// URI from stdin as a QR code", runQR},
+	{"sheet", "[-issuer NAME] [-account NAME] [-codes LIST | -backup-codes N] [-out PREFIX]", "Write a printable recovery sheet as PNG and PDF for a secret or otpauth:// URI from stdin", runSheet},
+	{"import", "[-file PATH] [-format table|uri] [-show-secrets]", "Read otpauth:// and otpauth-migration:// URIs and list their entries", runImport},
+	{"api-key", "-name NAME -scopes LIST [-file PATH] [-rate N/PERIOD] [-client-cn CN] [-entries IDS] [-vault PATH]", "Create a REST API key and add it to the API keys file", runAPIKey},
+	{"vault-key", "", "Generate a random ENTRY_VAULT_KEY or AUDIT_HMAC_KEY", runVaultKey},
+	{"vault-rewrap", "[-addr URL]", "Re-wrap the vault data keys with the active key through the admin API, reading the admin token from stdin", runVaultRewrap},
+}
+
+type cli struct {
+	stdin  *os.File
+	stdout *os.File
+	stderr *os.File
+	input  *bufio.Reader
+	totp   *totp.Generator
+}
+
+func IsCommand(name string) bool {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return true
+		}
+	}
+	return name == "help"
+}
+
+func Run(args []string, stdin, stdout, stderr *os.File) int {
+	logger.InitWriter(stderr, "ERROR", "text")
+
+	c := &cli{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		input:  bufio.NewReader(stdin),
+		totp:   totp.New(),
+	}
+
+	if len(args) == 0 || args[0] == "help" {
+		c.usage()
+		return 0
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(c, args[1:])
+		}
+	}
+	c.usage()
+	return 2
+}
+
+func (c *cli) usage() {
+	fmt.Fprintf(c.stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	w := tabwriter.NewWriter(c.stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(c.stderr, "\nSecrets are always read from stdin, never from arguments, so they stay out of shell history.")
+}
+
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+func (c *cli) fail(format string, args ...any) int {
+	fmt.Fprintf(c.stderr, "Error: "+format+"\n", args...)
+	return 1
+}
+
+func runCode(c *cli, args []string) int {
+	fs := c.flags("code")
+	watch := fs.Bool("watch", false, "keep printing new codes until interrupted")
+	plain := fs.Bool("plain", false, "print only the code, without a countdown")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+
+	secret, err := c.readSecret("Secret: ")
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	if err := c.totp.ValidateSecret(secret); err != nil {
+		return c.fail("%v", err)
+	}
+	key := totp.NewKey("", "", totp.NormalizeSecret(secret))
+
+	if *plain || !isTerminal(c.stdout) {
+		code, err := key.Code(time.Now())
+		if err != nil {
+			return c.fail("%v", err)
+		}
+		fmt.Fprintln(c.stdout, code)
+		return 0
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return c.countdown(ctx, key, *watch)
+}
+
+func (c *cli) countdown(ctx context.Context, key *totp.Key, watch bool) int {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	current := ""
+	for {
+		now := time.Now()
+		code, err := key.Code(now)
+		if err != nil {
+			return c.fail("%v", err)
+		}
+		if current != "" && code != current {
+			if !watch {
+				fmt.Fprintln(c.stdout)
+				return 0
+			}
+			fmt.Fprintln(c.stdout)
+		}
+		current = code
+
+		remaining := key.Remaining(now)
+		seconds := int(remaining.Round(time.Second).Seconds())
+		filled := seconds * 20 / key.Period
+		fmt.Fprintf(c.stdout, "\r\x1b[K  %s %s  [%s%s] %2ds",
+			code[:len(code)/2], code[len(code)/2:],
+			strings.Repeat("█", filled), strings.Repeat("░", 20-filled), seconds)
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(c.stdout)
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+func runGenerate(c *cli, args []string) int {
+	fs := c.flags("generate")
+	issuer := fs.String("issuer", "Discord 2FA Bot", "issuer shown in authenticator apps")
+	account := fs.String("account", os.Getenv("USER"), "account name shown in authenticator apps")
+	noQR := fs.Bool("no-qr", false, "do not print a QR code")
+	style := fs.String("style", "unicode", "QR rendering: unicode or ansi")
+	invert := fs.Bool("invert", false, "invert QR colours for light terminal backgrounds")
+	file := addQRFileFlags(fs)
+	if fs.Parse(args) != nil {
+		return 2
+	}
+	if *file.out != "" {
+		if _, err := file.options(); err != nil {
+			return c.fail("%v", err)
+		}
+	}
+
+	result, err := c.totp.GenerateSecret(*issuer, *account, totp.DefaultQROptions())
+	if err != nil {
+		return c.fail("%v", err)
+	}
+
+	fmt.Fprintf(c.stdout, "Secret: %s\nURI:    %s\n", result.Secret, result.URI)
+	switch {
+	case *file.out != "":
+		if err := file.write(result.URI); err != nil {
+			return c.fail("%v", err)
+		}
+		fmt.Fprintf(c.stdout, "QR:     %s\n", *file.out)
+	case !*noQR:
+		fmt.Fprintln(c.stdout)
+		if err := renderQR(c.stdout, result.URI, *style, *invert); err != nil {
+			return c.fail("%v", err)
+		}
+	}
+	return 0
+}
+
+func runVerify(c *cli, args []string) int {
+	fs := c.flags("verify")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+
+	secret, err := c.readSecret("Secret: ")
+	if err != nil {
+		return c.fail("%v", err)
+	}
+
+	code := fs.Arg(0)
+	if code == "" {
+		if code, err = c.readLine("Code: "); err != nil {
+			return c.fail("%v", err)
+		}
+	}
+
+	valid, err := c.totp.Verify(secret, code)
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	if !valid {
+		fmt.Fprintln(c.stdout, "invalid")
+		return 1
+	}
+	fmt.Fprintln(c.stdout, "valid")
+	return 0
+}
+
+func runQR(c *cli, args []string) int {
+	fs := c.flags("qr")
+	issuer := fs.String("issuer", "Discord 2FA Bot", "issuer used when stdin holds a bare secret")
+	account := fs.String("account", os.Getenv("USER"), "account used when stdin holds a bare secret")
+	style := fs.String("style", "unicode", "QR rendering: unicode or ansi")
+	invert := fs.Bool("invert", false, "invert QR colours for light terminal backgrounds")
+	file := addQRFileFlags(fs)
+	if fs.Parse(args) != nil {
+		return 2
+	}
+	if *file.out != "" {
+		if _, err := file.options(); err != nil {
+			return c.fail("%v", err)
+		}
+	}
+
+	input, err := c.readSecret("Secret or otpauth:// URI: ")
+	if err != nil {
+		return c.fail("%v", err)
+	}
+
+	uri := input
+	if strings.HasPrefix(input, "otpauth://") {
+		if _, err := totp.ParseURI(input); err != nil {
+			return c.fail("%v", err)
+		}
+	} else {
+		if err := c.totp.ValidateSecret(input); err != nil {
+			return c.fail("%v", err)
+		}
+		uri = totp.KeyURI(*issuer, *account, totp.NormalizeSecret(input))
+	}
+
+	if *file.out != "" {
+		if err := file.write(uri); err != nil {
+			return c.fail("%v", err)
+		}
+		fmt.Fprintf(c.stdout, "Wrote %s\n", *file.out)
+		return 0
+	}
+	if err := renderQR(c.stdout, uri, *style, *invert); err != nil {
+		return c.fail("%v", err)
+	}
+	return 0
+}
+
+func runSheet(c *cli, args []string) int {
+	fs := c.flags("sheet")
+	issuer := fs.String("issuer", "Discord 2FA Bot", "issuer used when stdin holds a bare secret")
+	account := fs.String("account", os.Getenv("USER"), "account used when stdin holds a bare secret")
+	codes := fs.String("codes", "", "comma-separated backup codes to print on the sheet")
+	generate := fs.Int("backup-codes", 0, "generate this many backup codes and print them on the sheet")
+	out := fs.String("out", "recovery-sheet", "output path without extension; .png and .pdf are added")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+	if *codes != "" && *generate > 0 {
+		return c.fail("use either -codes or -backup-codes, not both")
+	}
+
+	input, err := c.readSecret("Secret or otpauth:// URI: ")
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	var key *totp.Key
+	if strings.HasPrefix(input, "otpauth://") {
+		if key, err = totp.ParseURI(input); err != nil {
+			return c.fail("%v", err)
+		}
+	} else {
+		if err := c.totp.ValidateSecret(input); err != nil {
+			return c.fail("%v", err)
+		}
+		key = totp.NewKey(*issuer, *account, totp.NormalizeSecret(input))
+	}
+
+	recovery := sheet.Sheet{Key: key, BackupCodes: splitList(*codes), Created: time.Now()}
+	if *generate > 0 {
+		format := totp.DefaultBackupFormat()
+		format.Count = *generate
+		if recovery.BackupCodes, err = totp.GenerateBackupCodes(format); err != nil {
+			return c.fail("%v", err)
+		}
+	}
+
+	pngData, err := recovery.PNG()
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	pdfData, err := recovery.PDF()
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	for path, data := range map[string][]byte{*out + ".png": pngData, *out + ".pdf": pdfData} {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return c.fail("%v", err)
+		}
+	}
+
+	fmt.Fprintf(c.stdout, "Wrote %s.png and %s.pdf\nChecksum: %s\n", *out, *out, recovery.Checksum())
+	return 0
+}
+
+func runImport(c *cli, args []string) int {
+	fs := c.flags("import")
+	file := fs.String("file", "", "read URIs from a file instead of stdin")
+	format := fs.String("format", "table", "output format: table or uri")
+	showSecrets := fs.Bool("show-secrets", false, "include secrets in table output")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+
+	var source io.Reader = c.input
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return c.fail("%v", err)
+		}
+		defer f.Close()
+		source = f
+	} else if isTerminal(c.stdin) {
+		fmt.Fprintln(c.stderr, "Paste otpauth:// or otpauth-migration:// URIs, one per line, then press Ctrl+D:")
+	}
+
+	var keys []*totp.Key
+	scanner := bufio.NewScanner(source)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if totp.IsMigrationURI(line) {
+			entries, err := totp.ParseMigrationURI(line)
+			if err != nil {
+				return c.fail("line %d: %v", lineNo, err)
+			}
+			keys = append(keys, entries...)
+			continue
+		}
+		key, err := totp.ParseURI(line)
+		if err != nil {
+			return c.fail("line %d: %v", lineNo, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return c.fail("%v", err)
+	}
+
+	switch *format {
+	case "uri":
+		for _, key := range keys {
+			fmt.Fprintln(c.stdout, key.URI())
+		}
+	case "table":
+		w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+		header := "ISSUER\tACCOUNT\tTYPE\tCODE"
+		if *showSecrets {
+			header += "\tSECRET"
+		}
+		fmt.Fprintln(w, header)
+		for _, key := range keys {
+			code, err := key.Code(time.Now())
+			if err != nil {
+				code = "error: " + err.Error()
+			}
+			row := fmt.Sprintf("%s\t%s\t%s\t%s", key.Issuer, key.Account, strings.ToUpper(key.Type), code)
+			if *showSecrets {
+				row += "\t" + key.Secret
+			}
+			fmt.Fprintln(w, row)
+		}
+		w.Flush()
+	default:
+		return c.fail("unknown format %q (use table or uri)", *format)
+	}
+
+	fmt.Fprintf(c.stderr, "%d entries imported\n", len(keys))
+	return 0
+}
+
+func runAPIKey(c *cli, args []string) int {
+	fs := c.flags("api-key")
+	name := fs.String("name", "", "name of the key, shown in audit records and metrics")
+	scopes := fs.String("scopes", "", "comma-separated scopes: "+scopeList())
+	file := fs.String("file", "api-keys.json", "API keys file to add the key to")
+	rate := fs.String("rate", "", "rate limit for this key, e.g. 30/1m (defaults to API_RATE_LIMIT)")
+	clientCN := fs.String("client-cn", "", "authenticate with a client certificate with this common name instead of a token")
+	entries := fs.String("entries", "", "comma-separated IDs of other API keys' vault entries this key may use besides its own")
+	vaultPath := fs.String("vault", envOr("ENTRY_VAULT_PATH", "vault.json"), "vault file the -entries IDs are checked against")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+
+	key := &api.Key{
+		Name:      *name,
+		ClientCN:  *clientCN,
+		RateLimit: *rate,
+	}
+	for _, scope := range splitList(*scopes) {
+		key.Scopes = append(key.Scopes, api.Scope(scope))
+	}
+	key.Entries = splitList(*entries)
+	if err := checkAPIEntries(*vaultPath, key.Entries); err != nil {
+		return c.fail("%v", err)
+	}
+
+	var token string
+	if *clientCN == "" {
+		var err error
+		if token, err = api.NewToken(); err != nil {
+			return c.fail("%v", err)
+		}
+		key.TokenSHA256 = api.HashToken(token)
+	}
+
+	if err := api.AppendKey(*file, key); err != nil {
+		return c.fail("%v", err)
+	}
+
+	fmt.Fprintf(c.stderr, "Added key %q to %s\n", key.Name, *file)
+	if token != "" {
+		fmt.Fprintln(c.stderr, "The token is shown only once; store it now:")
+		fmt.Fprintln(c.stdout, token)
+	}
+	return 0
+}
+
+func runVaultKey(c *cli, args []string) int {
+	fs := c.flags("vault-key")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return c.fail("%v", err)
+	}
+	fmt.Fprintln(c.stdout, base64.StdEncoding.EncodeToString(key))
+	return 0
+}
+
+func checkAPIEntries(path string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	stored, err := vault.ReadEntries(path)
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string]string, len(stored))
+	for _, entry := range stored {
+		owners[entry.ID] = entry.Owner
+	}
+	for _, id := range ids {
+		owner, ok := owners[id]
+		switch {
+		case !ok:
+			return fmt.Errorf("no entry with ID %s in %s", id, path)
+		case !vault.IsAPIOwner(owner):
+			return fmt.Errorf("entry %s belongs to %s; -entries only accepts entries created through the API", id, owner)
+		}
+	}
+	return nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func scopeList() string {
+	scopes := make([]string, len(api.Scopes))
+	for idx, scope := range api.Scopes {
+		scopes[idx] = string(scope)
+	}
+	return strings.Join(scopes, ", ")
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (c *cli) readSecret(prompt string) (string, error) {
+	if !isTerminal(c.stdin) {
+		return c.readLine("")
+	}
+
+	if restore := disableEcho(c.stdin); restore != nil {
+		defer func() {
+			restore()
+			fmt.Fprintln(c.stderr)
+		}()
+	}
+	return c.readLine(prompt)
+}
+
+func (c *cli) readLine(prompt string) (string, error) {
+	if prompt != "" && isTerminal(c.stdin) {
+		fmt.Fprint(c.stderr, prompt)
+	}
+
+	line, err := c.input.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", errors.New("no input on stdin")
+	}
+	return line, nil
+}
+
+func disableEcho(f *os.File) func() {
+	cmd := exec.Command("stty", "-echo")
+	cmd.Stdin = f
+	if cmd.Run() != nil {
+		return nil
+	}
+	return func() {
+		cmd := exec.Command("stty", "echo")
+		cmd.Stdin = f
+		cmd.Run()
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"Discord-Bot-2FA-Key-Gen/vault"
+)
+
+func TestCheckAPIEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	data, err := json.Marshal([]vault.Entry{
+		{ID: "a1", Name: "cloud", Owner: vault.APIOwner("deploy")},
+		{ID: "g1", Name: "registrar", Owner: vault.GuildOwner("123")},
+		{ID: "u1", Name: "bank", Owner: vault.UserOwner("456")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		ids     []string
+		wantErr string
+	}{
+		{"no entries", filepath.Join(t.TempDir(), "missing.json"), nil, ""},
+		{"API entry", path, []string{"a1"}, ""},
+		{"server entry", path, []string{"a1", "g1"}, "belongs to guild:123"},
+		{"user entry", path, []string{"u1"}, "belongs to user:456"},
+		{"unknown entry", path, []string{"zz"}, "no entry with ID zz"},
+		{"missing vault", filepath.Join(t.TempDir(), "missing.json"), []string{"a1"}, "failed to read vault"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAPIEntries(tt.path, tt.ids)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
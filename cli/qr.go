@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"Discord-Bot-2FA-Key-Gen/totp"
+
+	"github.com/skip2/go-qrcode"
+)
+
+type qrFileFlags struct {
+	out        *string
+	size       *int
+	recovery   *string
+	foreground *string
+	background *string
+	logo       *string
+}
+
+func addQRFileFlags(fs *flag.FlagSet) *qrFileFlags {
+	defaults := totp.DefaultQROptions()
+	return &qrFileFlags{
+		out:        fs.String("out", "", "write the QR code to this .png or .svg file instead of the terminal"),
+		size:       fs.Int("size", defaults.Size, "image size in pixels when writing a file"),
+		recovery:   fs.String("recovery", defaults.Recovery, "error correction when writing a file: low, medium, high or highest"),
+		foreground: fs.String("fg", "#000000", "module colour when writing a file"),
+		background: fs.String("bg", "#FFFFFF", "background colour when writing a file"),
+		logo:       fs.String("logo", "", "PNG, JPEG or GIF image to place in the centre (forces high recovery)"),
+	}
+}
+
+func (f *qrFileFlags) options() (totp.QROptions, error) {
+	opts := totp.DefaultQROptions()
+	opts.Size = *f.size
+	opts.Recovery = *f.recovery
+	opts.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*f.out)), ".")
+	if opts.Format != "png" && opts.Format != "svg" {
+		return opts, fmt.Errorf("-out must end in .png or .svg")
+	}
+
+	var err error
+	if opts.Foreground, err = totp.ParseColor(*f.foreground); err != nil {
+		return opts, err
+	}
+	if opts.Background, err = totp.ParseColor(*f.background); err != nil {
+		return opts, err
+	}
+
+	if *f.logo != "" {
+		file, err := os.Open(*f.logo)
+		if err != nil {
+			return opts, err
+		}
+		defer file.Close()
+		if opts.Logo, err = totp.LoadLogo(file); err != nil {
+			return opts, err
+		}
+	}
+	return opts, opts.Validate()
+}
+
+func (f *qrFileFlags) write(content string) error {
+	opts, err := f.options()
+	if err != nil {
+		return err
+	}
+	data, err := totp.RenderQR(content, opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*f.out, data, 0600)
+}
+
+func renderQR(w io.Writer, content, style string, invert bool) error {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("failed to generate QR code: %w", err)
+	}
+	bitmap := code.Bitmap()
+
+	dark := func(y, x int) bool {
+		if y >= len(bitmap) || x >= len(bitmap[y]) {
+			return invert
+		}
+		return bitmap[y][x] != invert
+	}
+
+	var out strings.Builder
+	switch style {
+	case "ansi":
+		for y := range bitmap {
+			for x := range bitmap[y] {
+				if dark(y, x) {
+					out.WriteString("\x1b[40m  ")
+				} else {
+					out.WriteString("\x1b[47m  ")
+				}
+			}
+			out.WriteString("\x1b[0m\n")
+		}
+	case "unicode", "":
+		for y := 0; y < len(bitmap); y += 2 {
+			for x := range bitmap[y] {
+				top, bottom := dark(y, x), dark(y+1, x)
+				switch {
+				case top && bottom:
+					out.WriteString(" ")
+				case top:
+					out.WriteString("▄")
+				case bottom:
+					out.WriteString("▀")
+				default:
+					out.WriteString("█")
+				}
+			}
+			out.WriteString("\n")
+		}
+	default:
+		return fmt.Errorf("unknown QR style %q (use unicode or ansi)", style)
+	}
+
+	_, err = io.WriteString(w, out.String())
+	return err
+}
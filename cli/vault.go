@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const adminRequestTimeout = 30 * time.Second
+
+func runVaultRewrap(c *cli, args []string) int {
+	fs := c.flags("vault-rewrap")
+	addr := fs.String("addr", "http://localhost:8080", "base URL of the bot's HTTP_ADDR server")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+
+	token, err := c.readSecret("Admin API token: ")
+	if err != nil {
+		return c.fail("%v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(*addr, "/")+"/admin/vault/rewrap", nil)
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: adminRequestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Error     string      `json:"error"`
+		Rewrapped int         `json:"rewrapped"`
+		Active    int         `json:"active_version"`
+		Entries   map[int]int `json:"entries_by_version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return c.fail("unexpected response (%s): %v", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return c.fail("re-wrap failed (%s): %s", resp.Status, body.Error)
+	}
+
+	fmt.Fprintf(c.stdout, "Re-wrapped %d data key(s) with key version %d\n", body.Rewrapped, body.Active)
+	for _, version := range slices.Sorted(maps.Keys(body.Entries)) {
+		fmt.Fprintf(c.stdout, "  v%d: %d entries\n", version, body.Entries[version])
+	}
+	return 0
+}
@@ -1,66 +1,329 @@
 package config
 
 import (
-	"log"
+	"encoding/base64"
+	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+type RateLimit struct {
+	Count  int
+	Period time.Duration
+}
+
 type Config struct {
-	DiscordToken    string
-	AllowedRoles    []string
-	DevUserID       string
-	LogLevel        string
-	GuildID         string
-	CommandCooldown int
+	DiscordToken      string
+	AllowedRoles      []string
+	AdminUserIDs      []string
+	AdminRoles        []string
+	LogLevel          string
+	LogFormat         string
+	GuildID           string
+	CommandGuildIDs   []string
+	GlobalCommands    bool
+	CommandCooldown   int
+	AuditLogPath      string
+	AuditHMACKey      []byte
+	GuildSettingsPath string
+	AdminGrantsPath   string
+	MetricsAddr       string
+	HTTPAddr          string
+	AdminAPIToken     string
+	ShutdownTimeout   time.Duration
+	ApprovalTimeout   time.Duration
+
+	EntryVaultPath       string
+	EntryVaultKey        []byte
+	EntryVaultKeyVersion int
+	EntryVaultOldKeys    map[int][]byte
+
+	APIAddr         string
+	APIKeysPath     string
+	APIRateLimit    RateLimit
+	APITLSCertPath  string
+	APITLSKeyPath   string
+	APIClientCAPath string
+
+	UserRateLimit        RateLimit
+	CommandRateLimits    map[string]RateLimit
+	GuildRateLimit       RateLimit
+	GlobalRateLimit      RateLimit
+	RateLimitExemptRoles []string
+	RateLimitStore       string
+	RedisAddr            string
+	RedisPassword        string
+	RedisDB              int
+	RedisKeyPrefix       string
+
+	LockoutThreshold      int
+	LockoutWindow         time.Duration
+	LockoutBaseDuration   time.Duration
+	LockoutMaxDuration    time.Duration
+	LockoutResetAfter     time.Duration
+	LockoutAlertChannelID string
+
+	settings    []Setting
+	parseErrors ValidationErrors
+}
+
+type Options struct {
+	File            string
+	Overrides       map[string]string
+	SecretProviders []SecretProvider
 }
 
-func Load() *Config {
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found, using environment variables")
+const dotEnvPath = ".env"
+
+func Load(opts Options) (*Config, error) {
+	dotenv, err := godotenv.Read(dotEnvPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s file: %w", dotEnvPath, err)
+	}
+
+	path := opts.configFile(dotenv)
+
+	var file map[string]string
+	if path != "" {
+		if file, err = readFile(path); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	l := newLoader(file, dotenv, opts.Overrides)
+	l.providers = append(l.providers, opts.SecretProviders...)
+	if provider := vaultProvider(l); provider != nil {
+		l.providers = append(l.providers, provider)
 	}
 
 	config := &Config{
-		DiscordToken:    getEnv("DISCORD_BOT_TOKEN", ""),
-		DevUserID:       getEnv("DEV_USER_ID", ""),
-		LogLevel:        getEnv("LOG_LEVEL", "INFO"),
-		GuildID:         getEnv("GUILD_ID", ""),
-		CommandCooldown: getEnvInt("COMMAND_COOLDOWN", 5),
+		DiscordToken:      l.get("DISCORD_BOT_TOKEN", ""),
+		LogLevel:          l.get("LOG_LEVEL", "INFO"),
+		LogFormat:         l.get("LOG_FORMAT", "text"),
+		GuildID:           l.get("GUILD_ID", ""),
+		CommandCooldown:   l.getInt("COMMAND_COOLDOWN", 5),
+		AuditLogPath:      l.get("AUDIT_LOG_PATH", ""),
+		GuildSettingsPath: l.get("GUILD_SETTINGS_PATH", "guilds.json"),
+		AdminGrantsPath:   l.getPath("ADMIN_GRANTS_PATH", "admins.json"),
+		MetricsAddr:       l.get("METRICS_ADDR", ""),
+		HTTPAddr:          l.get("HTTP_ADDR", ""),
+		AdminAPIToken:     l.get("ADMIN_API_TOKEN", ""),
+		ShutdownTimeout:   l.getDuration("SHUTDOWN_TIMEOUT", 8*time.Second),
+		ApprovalTimeout:   l.getDuration("APPROVAL_TIMEOUT", 10*time.Minute),
 	}
 
-	if roleStr := getEnv("ALLOWED_ROLES", ""); roleStr != "" {
-		config.AllowedRoles = strings.Split(roleStr, ",")
-		for i, role := range config.AllowedRoles {
-			config.AllowedRoles[i] = strings.TrimSpace(role)
-		}
+	config.AllowedRoles = l.getList("ALLOWED_ROLES")
+	config.AdminUserIDs = l.getList("ADMIN_USER_IDS")
+	config.AdminRoles = l.getList("ADMIN_ROLES")
+
+	config.CommandGuildIDs = l.getList("COMMAND_GUILD_IDS")
+	if config.GuildID != "" && !slices.Contains(config.CommandGuildIDs, config.GuildID) {
+		config.CommandGuildIDs = append([]string{config.GuildID}, config.CommandGuildIDs...)
+	}
+	config.GlobalCommands = l.getBool("COMMAND_GLOBAL", len(config.CommandGuildIDs) == 0)
+
+	if devUserID := l.get("DEV_USER_ID", ""); devUserID != "" {
+		config.AdminUserIDs = append(config.AdminUserIDs, devUserID)
 	}
 
-	if config.DiscordToken == "" {
-		log.Fatal("DISCORD_BOT_TOKEN environment variable is required")
+	config.loadAudit(l)
+	config.loadRateLimits(l)
+	config.loadLockout(l)
+	config.loadAPI(l)
+
+	l.unknownFileKeys()
+	config.settings = l.settings
+	config.parseErrors = l.errs
+
+	return config, config.Validate()
+}
+
+func (o Options) configFile(dotenv map[string]string) string {
+	if o.File != "" {
+		return o.File
+	}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
 	}
+	return dotenv["CONFIG_FILE"]
+}
 
-	if config.CommandCooldown < 1 {
-		config.CommandCooldown = 5
+func (o Options) WatchPaths() []string {
+	dotenv, _ := godotenv.Read(dotEnvPath)
+	paths := []string{dotEnvPath}
+	if path := o.configFile(dotenv); path != "" {
+		paths = append(paths, path)
 	}
+	return paths
+}
+
+func (c *Config) Settings() []Setting {
+	return append([]Setting(nil), c.settings...)
+}
 
-	return config
+func (c *Config) loadAudit(l *loader) {
+	key := l.get("AUDIT_HMAC_KEY", "")
+	if key == "" {
+		if c.AuditLogPath != "" {
+			l.fail("AUDIT_HMAC_KEY", "is required when AUDIT_LOG_PATH is set")
+		}
+		return
+	}
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) < 32 {
+		l.fail("AUDIT_HMAC_KEY", "must be at least 32 bytes encoded as base64")
+		return
+	}
+	c.AuditHMACKey = decoded
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func (c *Config) loadRateLimits(l *loader) {
+	cooldown := c.CommandCooldown
+	if cooldown < 1 {
+		cooldown = 5
+	}
+	c.UserRateLimit = l.getRateLimit("RATE_LIMIT_USER", RateLimit{Count: 1, Period: time.Duration(cooldown) * time.Second})
+	c.GuildRateLimit = l.getRateLimit("RATE_LIMIT_GUILD", RateLimit{})
+	c.GlobalRateLimit = l.getRateLimit("RATE_LIMIT_GLOBAL", RateLimit{})
+
+	c.CommandRateLimits = make(map[string]RateLimit)
+	for _, entry := range l.getList("RATE_LIMIT_COMMANDS") {
+		command, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			l.fail("RATE_LIMIT_COMMANDS", fmt.Sprintf("%q must be in the form command=count/period", entry))
+			continue
+		}
+		limit, err := ParseRateLimit(value)
+		if err != nil {
+			l.fail("RATE_LIMIT_COMMANDS", fmt.Sprintf("%s: %s", command, err))
+			continue
+		}
+		c.CommandRateLimits[strings.TrimSpace(command)] = limit
 	}
-	return defaultValue
+
+	c.RateLimitExemptRoles = l.getList("RATE_LIMIT_EXEMPT_ROLES")
+
+	c.RateLimitStore = strings.ToLower(l.get("RATE_LIMIT_STORE", "memory"))
+	c.RedisAddr = l.get("REDIS_ADDR", "localhost:6379")
+	c.RedisPassword = l.get("REDIS_PASSWORD", "")
+	c.RedisDB = l.getInt("REDIS_DB", 0)
+	c.RedisKeyPrefix = l.get("REDIS_KEY_PREFIX", "2fabot:ratelimit:")
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil && intValue > 0 {
-			return intValue
+func (c *Config) loadAPI(l *loader) {
+	c.EntryVaultPath = l.get("ENTRY_VAULT_PATH", "vault.json")
+	activeKey := l.get("ENTRY_VAULT_KEY", "")
+	if activeKey != "" {
+		decoded, err := base64.StdEncoding.DecodeString(activeKey)
+		if err != nil || len(decoded) != 32 {
+			l.fail("ENTRY_VAULT_KEY", "must be 32 bytes encoded as base64")
+		} else {
+			c.EntryVaultKey = decoded
+		}
+	}
+	c.EntryVaultKeyVersion = l.getInt("ENTRY_VAULT_KEY_VERSION", 1)
+	if c.EntryVaultKeyVersion < 1 {
+		l.fail("ENTRY_VAULT_KEY_VERSION", "must be at least 1")
+	}
+	c.EntryVaultOldKeys = make(map[int][]byte)
+	for _, entry := range l.getList("ENTRY_VAULT_OLD_KEYS") {
+		version, key, ok := strings.Cut(entry, ":")
+		number, err := strconv.Atoi(strings.TrimSpace(version))
+		if !ok || err != nil || number < 1 {
+			l.fail("ENTRY_VAULT_OLD_KEYS", "entries must be in the form version:base64key")
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+		if err != nil || len(decoded) != 32 {
+			l.fail("ENTRY_VAULT_OLD_KEYS", fmt.Sprintf("key version %d must be 32 bytes encoded as base64", number))
+			continue
 		}
+		if number == c.EntryVaultKeyVersion {
+			l.fail("ENTRY_VAULT_OLD_KEYS", fmt.Sprintf("key version %d is the active ENTRY_VAULT_KEY_VERSION", number))
+			continue
+		}
+		if _, exists := c.EntryVaultOldKeys[number]; exists {
+			l.fail("ENTRY_VAULT_OLD_KEYS", fmt.Sprintf("key version %d is listed more than once", number))
+			continue
+		}
+		c.EntryVaultOldKeys[number] = decoded
+	}
+	if len(c.EntryVaultOldKeys) > 0 && activeKey == "" {
+		l.fail("ENTRY_VAULT_OLD_KEYS", "requires ENTRY_VAULT_KEY")
+	}
+
+	c.APIAddr = l.get("API_ADDR", "")
+	c.APIKeysPath = l.get("API_KEYS_PATH", "api-keys.json")
+	c.APIRateLimit = l.getRateLimit("API_RATE_LIMIT", RateLimit{Count: 60, Period: time.Minute})
+	c.APITLSCertPath = l.get("API_TLS_CERT_PATH", "")
+	c.APITLSKeyPath = l.get("API_TLS_KEY_PATH", "")
+	c.APIClientCAPath = l.get("API_CLIENT_CA_PATH", "")
+}
+
+func vaultProvider(l *loader) SecretProvider {
+	addr := l.get("VAULT_ADDR", "")
+	token := l.get("VAULT_TOKEN", "")
+	namespace := l.get("VAULT_NAMESPACE", "")
+	mount := l.get("VAULT_KV_MOUNT", "secret")
+	path := l.get("VAULT_SECRET_PATH", "")
+	version := l.getInt("VAULT_KV_VERSION", 2)
+	if addr == "" {
+		return nil
+	}
+
+	if path == "" {
+		l.fail("VAULT_SECRET_PATH", "is required when VAULT_ADDR is set")
+		return nil
+	}
+	if token == "" {
+		l.fail("VAULT_TOKEN", "is required when VAULT_ADDR is set")
+		return nil
+	}
+	if version != 1 && version != 2 {
+		l.fail("VAULT_KV_VERSION", "must be 1 or 2")
+		return nil
+	}
+	return NewVaultProvider(addr, token, namespace, mount, path, version)
+}
+
+func (c *Config) loadLockout(l *loader) {
+	c.LockoutThreshold = l.getInt("LOCKOUT_THRESHOLD", 5)
+	c.LockoutAlertChannelID = l.get("LOCKOUT_ALERT_CHANNEL_ID", "")
+	c.LockoutWindow = l.getDuration("LOCKOUT_WINDOW", 10*time.Minute)
+	c.LockoutBaseDuration = l.getDuration("LOCKOUT_BASE_DURATION", time.Minute)
+	c.LockoutMaxDuration = l.getDuration("LOCKOUT_MAX_DURATION", 24*time.Hour)
+	c.LockoutResetAfter = l.getDuration("LOCKOUT_RESET_AFTER", 24*time.Hour)
+}
+
+func ParseRateLimit(value string) (RateLimit, error) {
+	countStr, periodStr, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("%q must be in the form count/period, e.g. 5/1m", value)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(countStr))
+	if err != nil || count < 1 {
+		return RateLimit{}, fmt.Errorf("%q has an invalid count", value)
+	}
+
+	period, err := time.ParseDuration(strings.TrimSpace(periodStr))
+	if err != nil || period <= 0 {
+		return RateLimit{}, fmt.Errorf("%q has an invalid period", value)
+	}
+
+	return RateLimit{Count: count, Period: period}, nil
+}
+
+func (c *Config) EntryVaultKeys() map[int][]byte {
+	keys := make(map[int][]byte, len(c.EntryVaultOldKeys)+1)
+	for version, key := range c.EntryVaultOldKeys {
+		keys[version] = key
 	}
-	return defaultValue
+	keys[c.EntryVaultKeyVersion] = c.EntryVaultKey
+	return keys
 }
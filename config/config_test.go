@@ -0,0 +1,91 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+)
+
+// setupLoad moves to an empty directory with a .env holding dotenv and
+// unsets the settings the tests cover.
+func setupLoad(t *testing.T, dotenv string) {
+	t.Helper()
+
+	t.Chdir(t.TempDir())
+	for _, key := range []string{"CONFIG_FILE", "CREDENTIALS_DIRECTORY", "VAULT_ADDR", "AUDIT_LOG_PATH", "AUDIT_HMAC_KEY", "ADMIN_GRANTS_PATH"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	t.Setenv("DISCORD_BOT_TOKEN", "token")
+	if err := os.WriteFile(dotEnvPath, []byte(dotenv), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadAudit(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	tests := []struct {
+		name     string
+		dotenv   string
+		wantPath string
+		wantKey  bool
+		wantErr  string
+	}{
+		{name: "off by default"},
+		{name: "shipped template", dotenv: "AUDIT_LOG_PATH=\nAUDIT_HMAC_KEY=\n"},
+		{name: "path and key", dotenv: "AUDIT_LOG_PATH=audit.log\nAUDIT_HMAC_KEY=" + key + "\n", wantPath: "audit.log", wantKey: true},
+		{name: "path without key", dotenv: "AUDIT_LOG_PATH=audit.log\n", wantErr: "AUDIT_HMAC_KEY: is required"},
+		{name: "short key", dotenv: "AUDIT_LOG_PATH=audit.log\nAUDIT_HMAC_KEY=c2hvcnQ=\n", wantErr: "AUDIT_HMAC_KEY: must be at least 32 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupLoad(t, tt.dotenv)
+			cfg, err := Load(Options{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.AuditLogPath != tt.wantPath || (cfg.AuditHMACKey != nil) != tt.wantKey {
+				t.Errorf("AuditLogPath = %q with key %v, want %q with key %v", cfg.AuditLogPath, cfg.AuditHMACKey != nil, tt.wantPath, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestLoadAdminGrantsPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		dotenv string
+		env    map[string]string
+		want   string
+	}{
+		{name: "default", want: "admins.json"},
+		{name: "custom path", dotenv: "ADMIN_GRANTS_PATH=/data/admins.json\n", want: "/data/admins.json"},
+		{name: "empty in .env", dotenv: "ADMIN_GRANTS_PATH=\n", want: ""},
+		{name: "empty in the environment", env: map[string]string{"ADMIN_GRANTS_PATH": ""}, want: ""},
+		{name: "environment wins over .env", dotenv: "ADMIN_GRANTS_PATH=\n", env: map[string]string{"ADMIN_GRANTS_PATH": "grants.json"}, want: "grants.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupLoad(t, tt.dotenv)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := Load(Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.AdminGrantsPath != tt.want {
+				t.Errorf("AdminGrantsPath = %q, want %q", cfg.AdminGrantsPath, tt.want)
+			}
+		})
+	}
+}
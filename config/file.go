@@ -0,0 +1,202 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return parseTOML(data)
+	case ".yaml", ".yml":
+		return parseYAML(data)
+	default:
+		return nil, fmt.Errorf("config file %s must end in .toml, .yaml or .yml", path)
+	}
+}
+
+func parseTOML(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table header %q", lineNo, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		values[settingKey(section, strings.TrimSpace(key))] = value
+	}
+	return values, scanner.Err()
+}
+
+func parseYAML(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	var listKey string
+	var list []string
+
+	flush := func() {
+		if listKey != "" && len(list) > 0 {
+			values[listKey] = strings.Join(list, ",")
+		}
+		listKey, list = "", nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		text := stripComment(scanner.Text())
+		line := strings.TrimSpace(text)
+		if line == "" || line == "---" {
+			continue
+		}
+		indented := text[0] == ' ' || text[0] == '\t'
+
+		if strings.HasPrefix(line, "- ") {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNo)
+			}
+			item, err := parseValue(strings.TrimSpace(line[2:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			list = append(list, item)
+			continue
+		}
+		flush()
+
+		key, raw, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", lineNo)
+		}
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+
+		if !indented {
+			section = ""
+		}
+		if raw == "" {
+			listKey = settingKey(section, key)
+			if !indented {
+				section = key
+			}
+			continue
+		}
+
+		value, err := parseValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if indented && section == "" {
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+		}
+		values[settingKey(section, key)] = value
+	}
+	flush()
+	return values, scanner.Err()
+}
+
+func parseValue(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", nil
+	case strings.HasPrefix(raw, "["):
+		if !strings.HasSuffix(raw, "]") {
+			return "", fmt.Errorf("unterminated list %q", raw)
+		}
+		var items []string
+		for _, item := range strings.Split(raw[1:len(raw)-1], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			value, err := parseValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, value)
+		}
+		return strings.Join(items, ","), nil
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted string %s", raw)
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid quoted string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	default:
+		return raw, nil
+	}
+}
+
+// stripComment drops a trailing comment. As in TOML and YAML, "#" only starts
+// a comment at the start of the line or after whitespace, and never inside a
+// quoted string, so values such as pass#word keep their "#".
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+	for idx, ch := range line {
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\' && quote == '"':
+				escaped = true
+			case ch == quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch ch {
+		case '"', '\'':
+			// A quote inside a bare word, as in Bob's, doesn't open a string.
+			if idx == 0 || strings.ContainsRune(" \t=:[,", rune(line[idx-1])) {
+				quote = ch
+			}
+		case '#':
+			if idx == 0 || line[idx-1] == ' ' || line[idx-1] == '\t' {
+				return line[:idx]
+			}
+		}
+	}
+	return line
+}
+
+func settingKey(section, key string) string {
+	key = strings.Trim(key, `"'`)
+	if section != "" {
+		key = section + "_" + key
+	}
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripComment(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"whole line comment", "# a comment", ""},
+		{"indented comment", "  # a comment", "  "},
+		{"trailing comment", "level = INFO # default", "level = INFO "},
+		{"trailing comment after a tab", "level: INFO\t# default", "level: INFO\t"},
+		{"hash inside a bare value", "password = pass#word", "password = pass#word"},
+		{"hash at the end of a bare value", "password: secret#", "password: secret#"},
+		{"hash in double quotes", `issuer = "Acme # Ops" # note`, `issuer = "Acme # Ops" `},
+		{"hash in single quotes", "issuer: 'Acme # Ops'", "issuer: 'Acme # Ops'"},
+		{"escaped quote", `issuer = "say \"hi\" # not a comment" # comment`, `issuer = "say \"hi\" # not a comment" `},
+		{"escaped backslash before the closing quote", `path = "C:\\" # comment`, `path = "C:\\" `},
+		{"apostrophe in a bare word", "issuer: Bob's # team", "issuer: Bob's "},
+		{"quotes in a list", `roles = ["a#1", 'b # 2'] # comment`, `roles = ["a#1", 'b # 2'] `},
+		{"no comment", "level = INFO", "level = INFO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripComment(tt.line); got != tt.want {
+				t.Errorf("stripComment(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "top level keys",
+			input: "log_level = \"DEBUG\"\ncommand_cooldown = 3\n",
+			want:  map[string]string{"LOG_LEVEL": "DEBUG", "COMMAND_COOLDOWN": "3"},
+		},
+		{
+			name:  "tables prefix their keys",
+			input: "[redis]\naddr = \"localhost:6379\"\n\n[rate-limit]\nuser = \"5/1m\"\n",
+			want:  map[string]string{"REDIS_ADDR": "localhost:6379", "RATE_LIMIT_USER": "5/1m"},
+		},
+		{
+			name:  "lists are joined",
+			input: "allowed_roles = [\"1\", \"2\", '3']\n",
+			want:  map[string]string{"ALLOWED_ROLES": "1,2,3"},
+		},
+		{
+			name:  "comments and hashes in values",
+			input: "# settings\nredis_password = pa#ss # trailing\nissuer = \"Acme #1\"\n",
+			want:  map[string]string{"REDIS_PASSWORD": "pa#ss", "ISSUER": "Acme #1"},
+		},
+		{
+			name:  "escapes in double quotes",
+			input: "issuer = \"Tab\\there \\\"quoted\\\"\"\n",
+			want:  map[string]string{"ISSUER": "Tab\there \"quoted\""},
+		},
+		{
+			name:  "single quotes are literal",
+			input: "issuer = 'C:\\path'\n",
+			want:  map[string]string{"ISSUER": `C:\path`},
+		},
+		{name: "missing equals", input: "log_level\n", wantErr: true},
+		{name: "array of tables", input: "[[keys]]\n", wantErr: true},
+		{name: "unterminated quote", input: "issuer = \"Acme\n", wantErr: true},
+		{name: "unterminated list", input: "roles = [\"1\"\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("parseTOML = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "top level keys",
+			input: "---\nlog_level: DEBUG\ncommand_cooldown: 3\n",
+			want:  map[string]string{"LOG_LEVEL": "DEBUG", "COMMAND_COOLDOWN": "3"},
+		},
+		{
+			name:  "nested keys",
+			input: "redis:\n  addr: localhost:6379\n  db: 2\nlog_level: INFO\n",
+			want:  map[string]string{"REDIS_ADDR": "localhost:6379", "REDIS_DB": "2", "LOG_LEVEL": "INFO"},
+		},
+		{
+			name:  "block lists",
+			input: "allowed_roles:\n  - \"1\"\n  - 2 # second\n",
+			want:  map[string]string{"ALLOWED_ROLES": "1,2"},
+		},
+		{
+			name:  "flow lists",
+			input: "admin_roles: [a, 'b', \"c\"]\n",
+			want:  map[string]string{"ADMIN_ROLES": "a,b,c"},
+		},
+		{
+			name:  "comments and hashes in values",
+			input: "# settings\nredis_password: pa#ss # trailing\nissuer: 'Acme # Ops'\n",
+			want:  map[string]string{"REDIS_PASSWORD": "pa#ss", "ISSUER": "Acme # Ops"},
+		},
+		{
+			name:  "escapes in double quotes",
+			input: "issuer: \"say \\\"hi\\\" # here\"\n",
+			want:  map[string]string{"ISSUER": `say "hi" # here`},
+		},
+		{name: "list item without a key", input: "- a\n", wantErr: true},
+		{name: "missing colon", input: "log_level\n", wantErr: true},
+		{name: "unexpected indentation", input: "  log_level: INFO\n", wantErr: true},
+		{name: "unterminated quote", input: "issuer: 'Acme\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("parseYAML = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFileExtension(t *testing.T) {
+	dir := t.TempDir()
+	for name, wantErr := range map[string]bool{"bot.toml": false, "bot.yaml": false, "bot.yml": false, "bot.json": true} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readFile(path); (err != nil) != wantErr {
+				t.Errorf("readFile(%s) err = %v, wantErr %v", name, err, wantErr)
+			}
+		})
+	}
+}
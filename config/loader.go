@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Source string
+
+const (
+	SourceDefault     Source = "default"
+	SourceFile        Source = "file"
+	SourceDotEnv      Source = ".env"
+	SourceCredentials Source = "credentials"
+	SourceSecretFile  Source = "secret file"
+	SourceEnv         Source = "env"
+	SourceFlag        Source = "flag"
+)
+
+type Setting struct {
+	Key    string
+	Value  string
+	Source Source
+	Secret bool
+}
+
+type loader struct {
+	file      map[string]string
+	dotenv    map[string]string
+	overrides map[string]string
+	providers []SecretProvider
+	settings  []Setting
+	seen      map[string]bool
+	errs      ValidationErrors
+}
+
+func newLoader(file, dotenv, overrides map[string]string) *loader {
+	return &loader{
+		file:      file,
+		dotenv:    dotenv,
+		overrides: overrides,
+		seen:      make(map[string]bool),
+	}
+}
+
+func (l *loader) lookup(key string) (string, Source, bool) {
+	if value, ok := l.overrides[key]; ok {
+		return value, SourceFlag, true
+	}
+	if value := os.Getenv(key); value != "" {
+		return value, SourceEnv, true
+	}
+	if isSecretKey(key) {
+		if value, source, ok := l.lookupSecret(key); ok {
+			return value, source, true
+		}
+	}
+	if value := l.dotenv[key]; value != "" {
+		return value, SourceDotEnv, true
+	}
+	if value, ok := l.file[key]; ok && value != "" {
+		return value, SourceFile, true
+	}
+	return "", SourceDefault, false
+}
+
+func (l *loader) get(key, defaultValue string) string {
+	value, source, ok := l.lookup(key)
+	if !ok {
+		value = defaultValue
+	}
+
+	if !l.seen[key] {
+		l.seen[key] = true
+		l.settings = append(l.settings, Setting{
+			Key:    key,
+			Value:  value,
+			Source: source,
+			Secret: isSecretKey(key),
+		})
+	}
+	return value
+}
+
+// getPath is get for optional files: a key set to an empty value turns the
+// file off instead of falling back to the default.
+func (l *loader) getPath(key, defaultValue string) string {
+	if _, _, ok := l.lookup(key); !ok && l.setEmpty(key) {
+		defaultValue = ""
+	}
+	return l.get(key, defaultValue)
+}
+
+func (l *loader) setEmpty(key string) bool {
+	if _, ok := l.overrides[key]; ok {
+		return true
+	}
+	if _, ok := os.LookupEnv(key); ok {
+		return true
+	}
+	if _, ok := l.dotenv[key]; ok {
+		return true
+	}
+	_, ok := l.file[key]
+	return ok
+}
+
+func (l *loader) getInt(key string, defaultValue int) int {
+	value := l.get(key, strconv.Itoa(defaultValue))
+
+	intValue, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		l.fail(key, fmt.Sprintf("%q is not a whole number", value))
+		return defaultValue
+	}
+	return intValue
+}
+
+func (l *loader) getBool(key string, defaultValue bool) bool {
+	value := l.get(key, strconv.FormatBool(defaultValue))
+
+	boolValue, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		l.fail(key, fmt.Sprintf("%q is not true or false", value))
+		return defaultValue
+	}
+	return boolValue
+}
+
+func (l *loader) getDuration(key string, defaultValue time.Duration) time.Duration {
+	value := l.get(key, defaultValue.String())
+
+	duration, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		l.fail(key, fmt.Sprintf("%q is not a valid duration, e.g. 30s or 10m", value))
+		return defaultValue
+	}
+	return duration
+}
+
+func (l *loader) getList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(l.get(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (l *loader) getRateLimit(key string, defaultValue RateLimit) RateLimit {
+	value := l.get(key, "")
+	if value == "" {
+		return defaultValue
+	}
+
+	limit, err := ParseRateLimit(value)
+	if err != nil {
+		l.fail(key, err.Error())
+		return defaultValue
+	}
+	return limit
+}
+
+func (l *loader) fail(key, message string) {
+	l.errs = append(l.errs, ValidationError{Field: key, Message: message})
+}
+
+func (l *loader) unknownFileKeys() {
+	for key := range l.file {
+		if !l.seen[key] {
+			l.fail(key, "unknown setting in config file")
+		}
+	}
+}
+
+func isSecretKey(key string) bool {
+	for _, suffix := range []string{"_TOKEN", "_PASSWORD", "_SECRET", "_KEY", "_KEYS"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
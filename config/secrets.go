@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type SecretProvider interface {
+	Name() string
+	Lookup(key string) (string, bool, error)
+}
+
+func (l *loader) lookupSecret(key string) (string, Source, bool) {
+	fileKey := key + "_FILE"
+	if path := l.get(fileKey, ""); path != "" {
+		value, err := readSecretFile(path)
+		if err != nil {
+			l.fail(fileKey, err.Error())
+			return "", SourceDefault, false
+		}
+		return value, SourceSecretFile, true
+	}
+
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+		for _, name := range []string{key, strings.ToLower(key)} {
+			value, err := readSecretFile(filepath.Join(dir, name))
+			if err == nil {
+				return value, SourceCredentials, true
+			}
+			if !os.IsNotExist(err) {
+				l.fail(key, fmt.Sprintf("credential %s: %s", name, err))
+				return "", SourceDefault, false
+			}
+		}
+	}
+
+	for idx := 0; idx < len(l.providers); idx++ {
+		provider := l.providers[idx]
+		value, ok, err := provider.Lookup(key)
+		if err != nil {
+			l.fail(key, fmt.Sprintf("%s: %s", provider.Name(), err))
+			l.providers = append(l.providers[:idx:idx], l.providers[idx+1:]...)
+			idx--
+			continue
+		}
+		if ok && value != "" {
+			return value, Source(provider.Name()), true
+		}
+	}
+	return "", SourceDefault, false
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return value, nil
+}
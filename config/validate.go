@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for idx, err := range e {
+		messages[idx] = err.Error()
+	}
+	return fmt.Sprintf("%d configuration problem(s): %s", len(e), strings.Join(messages, "; "))
+}
+
+func (c *Config) Validate() error {
+	errs := append(ValidationErrors(nil), c.parseErrors...)
+	fail := func(field, message string) {
+		errs = append(errs, ValidationError{Field: field, Message: message})
+	}
+
+	if c.DiscordToken == "" {
+		fail("DISCORD_BOT_TOKEN", "is required")
+	}
+
+	switch strings.ToUpper(c.LogLevel) {
+	case "DEBUG", "INFO", "WARN", "ERROR", "FATAL":
+	default:
+		fail("LOG_LEVEL", fmt.Sprintf("%q must be one of DEBUG, INFO, WARN, ERROR, FATAL", c.LogLevel))
+	}
+
+	switch strings.ToLower(c.LogFormat) {
+	case "text", "json":
+	default:
+		fail("LOG_FORMAT", fmt.Sprintf("%q must be text or json", c.LogFormat))
+	}
+
+	if c.CommandCooldown < 1 {
+		fail("COMMAND_COOLDOWN", "must be at least 1 second")
+	}
+
+	switch c.RateLimitStore {
+	case "memory":
+	case "redis":
+		if c.RedisAddr == "" {
+			fail("REDIS_ADDR", "is required when RATE_LIMIT_STORE is redis")
+		}
+	default:
+		fail("RATE_LIMIT_STORE", fmt.Sprintf("%q must be memory or redis", c.RateLimitStore))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		fail("SHUTDOWN_TIMEOUT", "must be greater than zero")
+	}
+
+	if c.ApprovalTimeout <= 0 {
+		fail("APPROVAL_TIMEOUT", "must be greater than zero")
+	}
+
+	if c.RedisDB < 0 {
+		fail("REDIS_DB", "must not be negative")
+	}
+
+	if c.LockoutThreshold < 0 {
+		fail("LOCKOUT_THRESHOLD", "must not be negative")
+	}
+	for field, value := range map[string]int64{
+		"LOCKOUT_WINDOW":        int64(c.LockoutWindow),
+		"LOCKOUT_BASE_DURATION": int64(c.LockoutBaseDuration),
+		"LOCKOUT_MAX_DURATION":  int64(c.LockoutMaxDuration),
+		"LOCKOUT_RESET_AFTER":   int64(c.LockoutResetAfter),
+	} {
+		if value < 0 {
+			fail(field, "must not be negative")
+		}
+	}
+	if c.LockoutMaxDuration > 0 && c.LockoutBaseDuration > c.LockoutMaxDuration {
+		fail("LOCKOUT_BASE_DURATION", "must not exceed LOCKOUT_MAX_DURATION")
+	}
+
+	if c.AdminAPIToken != "" && c.HTTPAddr == "" {
+		fail("ADMIN_API_TOKEN", "is set but HTTP_ADDR is empty, so the admin API is never served")
+	}
+	if c.AdminAPIToken != "" && len(c.AdminAPIToken) < 16 {
+		fail("ADMIN_API_TOKEN", "must be at least 16 characters")
+	}
+
+	if (c.APITLSCertPath == "") != (c.APITLSKeyPath == "") {
+		fail("API_TLS_CERT_PATH", "API_TLS_CERT_PATH and API_TLS_KEY_PATH must be set together")
+	}
+	if c.APIClientCAPath != "" && c.APITLSCertPath == "" {
+		fail("API_CLIENT_CA_PATH", "client certificates require API_TLS_CERT_PATH and API_TLS_KEY_PATH")
+	}
+	if c.APIAddr != "" && c.APIKeysPath == "" {
+		fail("API_KEYS_PATH", "is required when API_ADDR is set")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(errs, func(a, b int) bool {
+		return errs[a].Field < errs[b].Field
+	})
+	return errs
+}
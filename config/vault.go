@@ -0,0 +1,119 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type VaultProvider struct {
+	addr      string
+	token     string
+	namespace string
+	mount     string
+	path      string
+	version   int
+	client    *http.Client
+
+	once   sync.Once
+	values map[string]string
+	err    error
+}
+
+func NewVaultProvider(addr, token, namespace, mount, path string, version int) *VaultProvider {
+	return &VaultProvider{
+		addr:      strings.TrimRight(addr, "/"),
+		token:     token,
+		namespace: namespace,
+		mount:     strings.Trim(mount, "/"),
+		path:      strings.Trim(path, "/"),
+		version:   version,
+		client:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (v *VaultProvider) Name() string {
+	return "vault"
+}
+
+func (v *VaultProvider) Lookup(key string) (string, bool, error) {
+	v.once.Do(func() {
+		v.values, v.err = v.fetch()
+	})
+	if v.err != nil {
+		return "", false, v.err
+	}
+
+	if value, ok := v.values[key]; ok {
+		return value, true, nil
+	}
+	value, ok := v.values[strings.ToLower(key)]
+	return value, ok, nil
+}
+
+func (v *VaultProvider) fetch() (map[string]string, error) {
+	url := fmt.Sprintf("%s/v1/%s/%s", v.addr, v.mount, v.path)
+	if v.version == 2 {
+		url = fmt.Sprintf("%s/v1/%s/data/%s", v.addr, v.mount, v.path)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", v.path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", v.path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read secret %s: HTTP %d", v.path, resp.StatusCode)
+	}
+
+	var payload struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid response for secret %s: %w", v.path, err)
+	}
+
+	data := payload.Data
+	if v.version == 2 {
+		var inner struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &inner); err != nil {
+			return nil, fmt.Errorf("invalid response for secret %s: %w", v.path, err)
+		}
+		data = inner.Data
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid response for secret %s: %w", v.path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if str, ok := value.(string); ok {
+			values[key] = str
+		} else {
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
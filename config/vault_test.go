@@ -0,0 +1,245 @@
+package config
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newVaultServer stands in for a Vault KV engine that serves body at path
+// to requests carrying the token "s.test".
+func newVaultServer(t *testing.T, path, body string) (*httptest.Server, *atomic.Int32, *http.Header) {
+	t.Helper()
+
+	var requests atomic.Int32
+	headers := &http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		*headers = r.Header.Clone()
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Path != path {
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests, headers
+}
+
+func TestVaultProviderLookup(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   int
+		mount     string
+		namespace string
+		token     string
+		path      string
+		body      string
+		key       string
+		want      string
+		wantFound bool
+		wantErr   string
+	}{
+		{
+			name:      "kv v2",
+			version:   2,
+			path:      "/v1/secret/data/bots/2fa",
+			body:      `{"data":{"data":{"DISCORD_BOT_TOKEN":"abc"},"metadata":{"version":3}}}`,
+			key:       "DISCORD_BOT_TOKEN",
+			want:      "abc",
+			wantFound: true,
+		},
+		{
+			name:      "kv v1",
+			version:   1,
+			path:      "/v1/secret/bots/2fa",
+			body:      `{"data":{"DISCORD_BOT_TOKEN":"abc"}}`,
+			key:       "DISCORD_BOT_TOKEN",
+			want:      "abc",
+			wantFound: true,
+		},
+		{
+			name:      "custom mount with slashes",
+			version:   2,
+			mount:     "/kv/",
+			path:      "/v1/kv/data/bots/2fa",
+			body:      `{"data":{"data":{"REDIS_PASSWORD":"pw"}}}`,
+			key:       "REDIS_PASSWORD",
+			want:      "pw",
+			wantFound: true,
+		},
+		{
+			name:      "lower case field",
+			version:   2,
+			path:      "/v1/secret/data/bots/2fa",
+			body:      `{"data":{"data":{"admin_api_token":"xyz"}}}`,
+			key:       "ADMIN_API_TOKEN",
+			want:      "xyz",
+			wantFound: true,
+		},
+		{
+			name:      "non-string value",
+			version:   2,
+			path:      "/v1/secret/data/bots/2fa",
+			body:      `{"data":{"data":{"REDIS_DB":2}}}`,
+			key:       "REDIS_DB",
+			want:      "2",
+			wantFound: true,
+		},
+		{
+			name:    "missing field",
+			version: 2,
+			path:    "/v1/secret/data/bots/2fa",
+			body:    `{"data":{"data":{"OTHER":"x"}}}`,
+			key:     "DISCORD_BOT_TOKEN",
+		},
+		{
+			name:    "wrong token",
+			version: 2,
+			token:   "s.wrong",
+			path:    "/v1/secret/data/bots/2fa",
+			body:    `{}`,
+			key:     "DISCORD_BOT_TOKEN",
+			wantErr: "HTTP 403",
+		},
+		{
+			name:    "wrong engine version",
+			version: 1,
+			path:    "/v1/secret/data/bots/2fa",
+			body:    `{}`,
+			key:     "DISCORD_BOT_TOKEN",
+			wantErr: "HTTP 404",
+		},
+		{
+			name:    "invalid json",
+			version: 2,
+			path:    "/v1/secret/data/bots/2fa",
+			body:    `<html>`,
+			key:     "DISCORD_BOT_TOKEN",
+			wantErr: "invalid response",
+		},
+		{
+			name:    "v2 response without inner data",
+			version: 2,
+			path:    "/v1/secret/data/bots/2fa",
+			body:    `{"data":"oops"}`,
+			key:     "DISCORD_BOT_TOKEN",
+			wantErr: "invalid response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, headers := newVaultServer(t, tt.path, tt.body)
+			mount := tt.mount
+			if mount == "" {
+				mount = "secret"
+			}
+			token := tt.token
+			if token == "" {
+				token = "s.test"
+			}
+			provider := NewVaultProvider(server.URL+"/", token, tt.namespace, mount, "/bots/2fa/", tt.version)
+
+			got, found, err := provider.Lookup(tt.key)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), token) {
+					t.Errorf("error leaks the token: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("Lookup(%s) = %q, %v; want %q, %v", tt.key, got, found, tt.want, tt.wantFound)
+			}
+			if headers.Get("X-Vault-Namespace") != "" {
+				t.Errorf("namespace header sent without a namespace: %q", headers.Get("X-Vault-Namespace"))
+			}
+		})
+	}
+}
+
+func TestVaultProviderNamespaceAndCaching(t *testing.T) {
+	server, requests, headers := newVaultServer(t, "/v1/secret/data/bots/2fa", `{"data":{"data":{"A_TOKEN":"a","B_TOKEN":"b"}}}`)
+	provider := NewVaultProvider(server.URL, "s.test", "team-a", "secret", "bots/2fa", 2)
+
+	for _, key := range []string{"A_TOKEN", "B_TOKEN", "C_TOKEN"} {
+		if _, _, err := provider.Lookup(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("%d requests to Vault, want 1 for every lookup", got)
+	}
+	if got := headers.Get("X-Vault-Namespace"); got != "team-a" {
+		t.Errorf("X-Vault-Namespace = %q, want team-a", got)
+	}
+}
+
+func TestLoadReadsSecretsFromVault(t *testing.T) {
+	hmacKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	server, _, _ := newVaultServer(t, "/v1/secret/data/bots/2fa",
+		`{"data":{"data":{"DISCORD_BOT_TOKEN":"from-vault","AUDIT_HMAC_KEY":"`+hmacKey+`","LOG_LEVEL":"DEBUG"}}}`)
+
+	t.Chdir(t.TempDir())
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	t.Setenv("DISCORD_BOT_TOKEN", "")
+	t.Setenv("AUDIT_HMAC_KEY", "")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "s.test")
+	t.Setenv("VAULT_SECRET_PATH", "bots/2fa")
+
+	cfg, err := Load(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DiscordToken != "from-vault" {
+		t.Errorf("DiscordToken = %q, want the Vault value", cfg.DiscordToken)
+	}
+	if len(cfg.AuditHMACKey) != 32 {
+		t.Errorf("AuditHMACKey has %d bytes, want 32", len(cfg.AuditHMACKey))
+	}
+	// Only secrets come from Vault; ordinary settings keep their defaults.
+	if cfg.LogLevel != "INFO" {
+		t.Errorf("LogLevel = %q, want the default", cfg.LogLevel)
+	}
+	for _, setting := range cfg.Settings() {
+		if setting.Key == "DISCORD_BOT_TOKEN" && setting.Source != "vault" {
+			t.Errorf("DISCORD_BOT_TOKEN source = %q, want vault", setting.Source)
+		}
+	}
+}
+
+func TestLoadReportsVaultFailure(t *testing.T) {
+	server, _, _ := newVaultServer(t, "/v1/secret/data/bots/2fa", `{}`)
+
+	t.Chdir(t.TempDir())
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	t.Setenv("DISCORD_BOT_TOKEN", "")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "s.revoked")
+	t.Setenv("VAULT_SECRET_PATH", "bots/2fa")
+
+	_, err := Load(Options{})
+	if err == nil || !strings.Contains(err.Error(), "vault: failed to read secret bots/2fa: HTTP 403") {
+		t.Fatalf("Load err = %v, want the Vault failure", err)
+	}
+	if strings.Contains(err.Error(), "s.revoked") {
+		t.Errorf("error leaks the token: %v", err)
+	}
+}
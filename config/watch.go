@@ -0,0 +1,64 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+type Watcher struct {
+	paths    []string
+	interval time.Duration
+	states   map[string]fileState
+}
+
+func NewWatcher(paths []string, interval time.Duration) *Watcher {
+	w := &Watcher{
+		paths:    paths,
+		interval: interval,
+		states:   make(map[string]fileState),
+	}
+	for _, path := range paths {
+		w.states[path] = statFile(path)
+	}
+	return w
+}
+
+func (w *Watcher) Run(ctx context.Context, onChange func(path string)) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed := ""
+			for _, path := range w.paths {
+				if state := statFile(path); state != w.states[path] {
+					w.states[path] = state
+					if changed == "" {
+						changed = path
+					}
+				}
+			}
+			if changed != "" {
+				onChange(changed)
+			}
+		}
+	}
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+}
@@ -0,0 +1,182 @@
+package guild
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var Commands = []string{"2fa-code", "2fa-generate", "2fa-verify", "2fa-shared", "2fa-backup-codes", "2fa-rotate"}
+
+// Display profiles in order of how much of the secret they reveal.
+var DisplayProfiles = []string{"code", "masked", "full"}
+
+var DisplayCommands = []string{"2fa-code"}
+
+type Settings struct {
+	GuildID          string            `json:"guild_id"`
+	AllowedRoles     []string          `json:"allowed_roles,omitempty"`
+	AllowedChannels  []string          `json:"allowed_channels,omitempty"`
+	CooldownSeconds  int               `json:"cooldown_seconds,omitempty"`
+	Issuer           string            `json:"issuer,omitempty"`
+	DisabledCommands []string          `json:"disabled_commands,omitempty"`
+	DisplayLimits    map[string]string `json:"display_limits,omitempty"`
+	UpdatedBy        string            `json:"updated_by,omitempty"`
+	UpdatedAt        time.Time         `json:"updated_at,omitempty"`
+}
+
+func (s Settings) CommandEnabled(command string) bool {
+	return !slices.Contains(s.DisabledCommands, command)
+}
+
+func (s Settings) ChannelAllowed(channelID string) bool {
+	return len(s.AllowedChannels) == 0 || slices.Contains(s.AllowedChannels, channelID)
+}
+
+// DisplayLimit defaults to the code alone; showing the secret in a channel
+// has to be allowed by a server manager.
+func (s Settings) DisplayLimit(command string) string {
+	if limit, ok := s.DisplayLimits[command]; ok {
+		return limit
+	}
+	return DisplayProfiles[0]
+}
+
+func (s Settings) DisplayAllowed(command, profile string) bool {
+	idx := slices.Index(DisplayProfiles, profile)
+	return idx >= 0 && idx <= slices.Index(DisplayProfiles, s.DisplayLimit(command))
+}
+
+func (s Settings) clone() Settings {
+	s.AllowedRoles = slices.Clone(s.AllowedRoles)
+	s.AllowedChannels = slices.Clone(s.AllowedChannels)
+	s.DisabledCommands = slices.Clone(s.DisabledCommands)
+	s.DisplayLimits = maps.Clone(s.DisplayLimits)
+	return s
+}
+
+type Store struct {
+	path   string
+	guilds map[string]Settings
+	mutex  sync.RWMutex
+}
+
+func Open(path string) (*Store, error) {
+	store := &Store{
+		path:   path,
+		guilds: make(map[string]Settings),
+	}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read guild settings: %w", err)
+	}
+
+	var guilds []Settings
+	if err := json.Unmarshal(data, &guilds); err != nil {
+		return nil, fmt.Errorf("failed to parse guild settings %s: %w", path, err)
+	}
+	for _, settings := range guilds {
+		store.guilds[settings.GuildID] = settings
+	}
+	return store, nil
+}
+
+func (s *Store) Get(guildID string) Settings {
+	if s == nil {
+		return Settings{GuildID: guildID}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	settings, ok := s.guilds[guildID]
+	if !ok {
+		return Settings{GuildID: guildID}
+	}
+	return settings.clone()
+}
+
+func (s *Store) Update(guildID, actorID string, change func(*Settings) error) (Settings, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	settings, ok := s.guilds[guildID]
+	if !ok {
+		settings = Settings{GuildID: guildID}
+	}
+	settings = settings.clone()
+
+	if err := change(&settings); err != nil {
+		return Settings{}, err
+	}
+	settings.UpdatedBy = actorID
+	settings.UpdatedAt = time.Now().UTC()
+
+	previous, existed := s.guilds[guildID]
+	s.guilds[guildID] = settings
+	if err := s.save(); err != nil {
+		if existed {
+			s.guilds[guildID] = previous
+		} else {
+			delete(s.guilds, guildID)
+		}
+		return Settings{}, err
+	}
+	return settings.clone(), nil
+}
+
+func (s *Store) Reset(guildID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous, existed := s.guilds[guildID]
+	if !existed {
+		return nil
+	}
+	delete(s.guilds, guildID)
+	if err := s.save(); err != nil {
+		s.guilds[guildID] = previous
+		return err
+	}
+	return nil
+}
+
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	guilds := make([]Settings, 0, len(s.guilds))
+	for _, settings := range s.guilds {
+		guilds = append(guilds, settings)
+	}
+	sort.Slice(guilds, func(a, b int) bool {
+		return guilds[a].GuildID < guilds[b].GuildID
+	})
+
+	data, err := json.MarshalIndent(guilds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write guild settings: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace guild settings: %w", err)
+	}
+	return nil
+}
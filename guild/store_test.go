@@ -0,0 +1,57 @@
+package guild
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDisplayAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  map[string]string
+		profile string
+		want    bool
+	}{
+		{"code by default", nil, "code", true},
+		{"masked refused by default", nil, "masked", false},
+		{"full refused by default", nil, "full", false},
+		{"raised to masked", map[string]string{"2fa-code": "masked"}, "masked", true},
+		{"raised to masked still refuses full", map[string]string{"2fa-code": "masked"}, "full", false},
+		{"raised to full", map[string]string{"2fa-code": "full"}, "full", true},
+		{"unknown profile", map[string]string{"2fa-code": "full"}, "everything", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := Settings{DisplayLimits: tt.limits}
+			if got := settings.DisplayAllowed("2fa-code", tt.profile); got != tt.want {
+				t.Errorf("DisplayAllowed(%q) = %v, want %v", tt.profile, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayLimitSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guilds.json")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Update("g1", "u1", func(settings *Settings) error {
+		settings.DisplayLimits = map[string]string{"2fa-code": "full"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Get("g1").DisplayLimit("2fa-code"); got != "full" {
+		t.Errorf("raised limit after reopen = %q, want full", got)
+	}
+	if got := reopened.Get("g2").DisplayLimit("2fa-code"); got != "code" {
+		t.Errorf("limit of an unconfigured server = %q, want code", got)
+	}
+}
@@ -1,122 +1,132 @@
 package logger
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"io"
+	"log/slog"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 )
 
-type Level int
+const LevelFatal = slog.Level(12)
 
-const (
-	DEBUG Level = iota
-	INFO
-	WARN
-	ERROR
-	FATAL
+var (
+	level         = new(slog.LevelVar)
+	defaultLogger = slog.New(newHandler(os.Stdout, "text"))
 )
 
-type Logger struct {
-	level  Level
-	logger *log.Logger
+func Init(levelStr, format string) {
+	InitWriter(os.Stdout, levelStr, format)
 }
 
-var GlobalLogger *Logger
+func InitWriter(w io.Writer, levelStr, format string) {
+	SetLevel(levelStr)
+	defaultLogger = slog.New(newHandler(w, format))
+	slog.SetDefault(defaultLogger)
+}
+
+func Sync() error {
+	info, err := os.Stdout.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	return os.Stdout.Sync()
+}
 
-func Init(levelStr string) {
-	var level Level
-	switch levelStr {
+func SetLevel(levelStr string) {
+	level.Set(ParseLevel(levelStr))
+}
+
+func ParseLevel(levelStr string) slog.Level {
+	switch strings.ToUpper(levelStr) {
 	case "DEBUG":
-		level = DEBUG
+		return slog.LevelDebug
 	case "INFO":
-		level = INFO
+		return slog.LevelInfo
 	case "WARN":
-		level = WARN
+		return slog.LevelWarn
 	case "ERROR":
-		level = ERROR
+		return slog.LevelError
 	case "FATAL":
-		level = FATAL
+		return LevelFatal
 	default:
-		level = INFO
+		return slog.LevelInfo
 	}
+}
 
-	GlobalLogger = &Logger{
-		level:  level,
-		logger: log.New(os.Stdout, "", 0),
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       level,
+		ReplaceAttr: replaceAttr,
 	}
-}
 
-func (l *Logger) log(level Level, prefix string, v ...interface{}) {
-	if level >= l.level {
-		timestamp := time.Now().Format("2006-01-02 15:04:05")
-		_, file, line, ok := runtime.Caller(3)
-		if !ok {
-			file = "unknown"
-			line = 0
-		}
+	if strings.EqualFold(format, "json") {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
 
-		shortFile := file
-		for i := len(file) - 1; i > 0; i-- {
-			if file[i] == '/' {
-				shortFile = file[i+1:]
-				break
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 {
+		switch a.Key {
+		case slog.TimeKey:
+			return a
+		case slog.LevelKey:
+			if lvl, ok := a.Value.Any().(slog.Level); ok && lvl == LevelFatal {
+				a.Value = slog.StringValue("FATAL")
+			}
+			return a
+		case slog.SourceKey:
+			if source, ok := a.Value.Any().(*slog.Source); ok {
+				source.File = shortFile(source.File)
 			}
+			return a
 		}
-
-		message := fmt.Sprintf("[%s] %s %s:%d %s", timestamp, prefix, shortFile, line, fmt.Sprint(v...))
-		l.logger.Println(message)
 	}
+	return redactAttr(a)
 }
 
-func (l *Logger) Debug(v ...interface{}) {
-	l.log(DEBUG, "[DEBUG]", v...)
+func shortFile(file string) string {
+	if idx := strings.LastIndexByte(file, '/'); idx >= 0 {
+		return file[idx+1:]
+	}
+	return file
 }
 
-func (l *Logger) Info(v ...interface{}) {
-	l.log(INFO, "[INFO]", v...)
-}
+func log(lvl slog.Level, msg string, args ...any) {
+	ctx := context.Background()
+	if !defaultLogger.Enabled(ctx, lvl) {
+		return
+	}
 
-func (l *Logger) Warn(v ...interface{}) {
-	l.log(WARN, "[WARN]", v...)
-}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
 
-func (l *Logger) Error(v ...interface{}) {
-	l.log(ERROR, "[ERROR]", v...)
+	record := slog.NewRecord(time.Now(), lvl, msg, pcs[0])
+	record.Add(args...)
+	_ = defaultLogger.Handler().Handle(ctx, record)
 }
 
-func (l *Logger) Fatal(v ...interface{}) {
-	l.log(FATAL, "[FATAL]", v...)
-	os.Exit(1)
+func Debug(msg string, args ...any) {
+	log(slog.LevelDebug, msg, args...)
 }
 
-func Debug(v ...interface{}) {
-	if GlobalLogger != nil {
-		GlobalLogger.Debug(v...)
-	}
+func Info(msg string, args ...any) {
+	log(slog.LevelInfo, msg, args...)
 }
 
-func Info(v ...interface{}) {
-	if GlobalLogger != nil {
-		GlobalLogger.Info(v...)
-	}
+func Warn(msg string, args ...any) {
+	log(slog.LevelWarn, msg, args...)
 }
 
-func Warn(v ...interface{}) {
-	if GlobalLogger != nil {
-		GlobalLogger.Warn(v...)
-	}
-}
-
-func Error(v ...interface{}) {
-	if GlobalLogger != nil {
-		GlobalLogger.Error(v...)
-	}
+func Error(msg string, args ...any) {
+	log(slog.LevelError, msg, args...)
 }
 
-func Fatal(v ...interface{}) {
-	if GlobalLogger != nil {
-		GlobalLogger.Fatal(v...)
-	}
+func Fatal(msg string, args ...any) {
+	log(LevelFatal, msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+type Sensitive string
+
+func (Sensitive) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (Sensitive) String() string {
+	return redacted
+}
+
+var sensitiveKeys = map[string]bool{
+	"code":       true,
+	"secret":     true,
+	"uri":        true,
+	"otp":        true,
+	"token":      true,
+	"password":   true,
+	"key":        true,
+	"master_key": true,
+	"api_key":    true,
+	"codes":      true,
+}
+
+// Secrets are matched as one upper-case run, the way they are issued, and in
+// the groups of four that authenticator apps display, e.g. "jbsw y3dp ehpk
+// 3pxp". Both must be whole words with a digit from 2-7, so long words, hex
+// and identifiers stay readable; anything after secret= or in an otpauth URI
+// is redacted regardless.
+var (
+	otpauthPattern = regexp.MustCompile(`(?i)otpauth(-migration)?://\S+`)
+	secretParam    = regexp.MustCompile(`(?i)(secret=)[^&\s]+`)
+	base32Pattern  = regexp.MustCompile(`\b[A-Z2-7]{16,}(?:={1,6}|\b)|(?i:\b[a-z2-7]{4}(?:[ -][a-z2-7]{4}){3,}(?:[ -][a-z2-7]{1,4})?\b)`)
+)
+
+const minSecretLength = 16
+
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, suffix := range []string{"_secret", "_code", "_token", "_uri", "_password"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func Redact(s string) string {
+	s = otpauthPattern.ReplaceAllString(s, "otpauth://"+redacted)
+	s = secretParam.ReplaceAllString(s, "${1}"+redacted)
+	return base32Pattern.ReplaceAllStringFunc(s, func(token string) string {
+		if looksLikeBase32Secret(token) {
+			return redacted
+		}
+		return token
+	})
+}
+
+func looksLikeBase32Secret(token string) bool {
+	normalized := strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(token))
+	normalized = strings.TrimRight(normalized, "=")
+	if len(normalized) < minSecretLength || !strings.ContainsAny(normalized, "234567") {
+		return false
+	}
+	for _, c := range normalized {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '2' && c <= '7') {
+			return false
+		}
+	}
+	return true
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	if a.Key != slog.MessageKey && IsSensitiveKey(a.Key) {
+		a.Value = slog.StringValue(redacted)
+		return a
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(Redact(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(Redact(v.String()))
+		case []byte:
+			a.Value = slog.StringValue(Redact(string(v)))
+		default:
+			raw := fmt.Sprintf("%+v", v)
+			if clean := Redact(raw); clean != raw {
+				a.Value = slog.StringValue(clean)
+			}
+		}
+	}
+	return a
+}
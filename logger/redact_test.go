@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"upper case secret", "secret JBSWY3DPEHPK3PXP here", "secret [REDACTED] here"},
+		{"padded secret", "JBSWY3DPEHPK3PXP====", "[REDACTED]"},
+		{"secret in parentheses", "(JBSWY3DPEHPK3PXP)", "([REDACTED])"},
+		{"long secret", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "[REDACTED]"},
+		{"space grouped secret", "got jbsw y3dp ehpk 3pxp, thanks", "got [REDACTED], thanks"},
+		{"upper case space grouped secret", "JBSW Y3DP EHPK 3PXP", "[REDACTED]"},
+		{"hyphen grouped secret", "JBSW-Y3DP-EHPK-3PXP-GEZD", "[REDACTED]"},
+		{"grouped secret with short tail", "jbsw y3dp ehpk 3pxp ab", "[REDACTED]"},
+		{"otpauth uri", "parse otpauth://totp/Acme:bob?secret=JBSWY3DPEHPK3PXP&issuer=Acme failed", "parse otpauth://[REDACTED] failed"},
+		{"migration uri", "otpauth-migration://offline?data=CjEKCkhlbGxvId", "otpauth://[REDACTED]"},
+		{"secret query parameter", "GET /setup?secret=abc123&user=1", "GET /setup?secret=[REDACTED]&user=1"},
+		{"lower case secret after secret=", "secret=jbswyddpehpkzpxp", "secret=[REDACTED]"},
+		{"short token", "JBSW Y3DP EH", "JBSW Y3DP EH"},
+		{"sentence", "Failed to respond to interaction", "Failed to respond to interaction"},
+		{"sentence with long word", "Configuration reloaded, nothing changed", "Configuration reloaded, nothing changed"},
+		{"grouping must start at a word", "key version 2 is listed more than once", "key version 2 is listed more than once"},
+		{"identifiers", "StringValue called on data option of type Attachment", "StringValue called on data option of type Attachment"},
+		{"module path", "Discord-Bot-2FA-Key-Gen/vault", "Discord-Bot-2FA-Key-Gen/vault"},
+		{"snowflake", "user 123456789012345678", "user 123456789012345678"},
+		{"long lower case word", "internationalization failed", "internationalization failed"},
+		{"long upper case word", "INTERNATIONALIZATION", "INTERNATIONALIZATION"},
+		{"lower case run with digits", "jbswy3dpehpk3pxp", "jbswy3dpehpk3pxp"},
+		{"mixed case identifier", "applicationCommandPermissions2", "applicationCommandPermissions2"},
+		{"upper case run inside a word", "prefixJBSWY3DPEHPK3PXP", "prefixJBSWY3DPEHPK3PXP"},
+		{"upper case run with digits outside base32", "ABCDEF0123456789ABCDEF", "ABCDEF0123456789ABCDEF"},
+		{"hex fingerprint", "fingerprint 3f2a7c9e4b6d2e5f7a3c9b1d", "fingerprint 3f2a7c9e4b6d2e5f7a3c9b1d"},
+		{"sha256 digest", "hash e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", "hash e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"grouped words without digits", "when they were here last", "when they were here last"},
+		{"snake case identifier", "ENTRY_VAULT_KEY_VERSION_OLD_KEYS", "ENTRY_VAULT_KEY_VERSION_OLD_KEYS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.input); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSensitiveKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"secret", true},
+		{"Secret", true},
+		{"code", true},
+		{"codes", true},
+		{"uri", true},
+		{"token", true},
+		{"api_key", true},
+		{"master_key", true},
+		{"pending_secret", true},
+		{"backup_code", true},
+		{"admin_token", true},
+		{"setup_uri", true},
+		{"redis_password", true},
+		{"user_id", false},
+		{"entry_id", false},
+		{"error", false},
+		{"command", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := IsSensitiveKey(tt.key); got != tt.want {
+				t.Errorf("IsSensitiveKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
+
+type record struct {
+	Name   string
+	Secret string
+}
+
+func TestLogRedaction(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func()
+	}{
+		{"message", func() { Info("secret is " + testSecret) }},
+		{"grouped secret in message", func() { Info("secret is jbsw y3dp ehpk 3pxp") }},
+		{"sensitive key", func() { Info("event", "secret", "not-base32-at-all") }},
+		{"sensitive key suffix", func() { Info("event", "pending_secret", "x") }},
+		{"code key", func() { Debug("event", "code", "123456") }},
+		{"string value", func() { Warn("event", "input", testSecret) }},
+		{"secret= in string value", func() { Warn("event", "input", "secret=jbswyddpehpkzpxp") }},
+		{"error value", func() { Error("event", "error", errors.New("invalid secret "+testSecret)) }},
+		{"wrapped error value", func() {
+			Error("event", "error", errors.Join(errors.New("outer"), errors.New("otpauth://totp/x?secret="+testSecret)))
+		}},
+		{"stringer value", func() { Info("event", "value", stringer(testSecret)) }},
+		{"byte slice value", func() { Info("event", "body", []byte(`{"s":"`+testSecret+`"}`)) }},
+		{"struct value", func() { Info("event", "entry", record{Name: "bank", Secret: testSecret}) }},
+		{"map value", func() { Info("event", "fields", map[string]string{"s": testSecret}) }},
+		{"slice value", func() { Info("event", "values", []string{"a", testSecret}) }},
+		{"group", func() { Info("event", slog.Group("request", "secret", "x", "input", testSecret)) }},
+		{"sensitive wrapper", func() { Info("event", "value", Sensitive("123456")) }},
+		{"uri value", func() { Info("event", "link", "otpauth://totp/Acme:bob?secret="+testSecret) }},
+	}
+
+	for _, format := range []string{"text", "json"} {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				InitWriter(&buf, "DEBUG", format)
+				t.Cleanup(func() { InitWriter(&bytes.Buffer{}, "INFO", "text") })
+
+				tt.log()
+
+				out := buf.String()
+				if out == "" {
+					t.Fatal("nothing was logged")
+				}
+				for _, leak := range []string{testSecret, "jbsw y3dp ehpk 3pxp", "jbswyddpehpkzpxp", "123456", "not-base32-at-all"} {
+					if strings.Contains(out, leak) {
+						t.Errorf("log output contains %q: %s", leak, out)
+					}
+				}
+				if !strings.Contains(out, redacted) {
+					t.Errorf("log output has no %s marker: %s", redacted, out)
+				}
+			})
+		}
+	}
+}
+
+func TestLogKeepsOrdinaryValues(t *testing.T) {
+	var buf bytes.Buffer
+	InitWriter(&buf, "INFO", "text")
+	t.Cleanup(func() { InitWriter(&bytes.Buffer{}, "INFO", "text") })
+
+	Info("Configuration reloaded", "user_id", "123456789012345678", "command", "2fa-code", "count", 3)
+
+	out := buf.String()
+	for _, want := range []string{"Configuration reloaded", "user_id=123456789012345678", "command=2fa-code", "count=3"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output is missing %q: %s", want, out)
+		}
+	}
+	if strings.Contains(out, redacted) {
+		t.Errorf("ordinary values were redacted: %s", out)
+	}
+}
@@ -1,132 +1,662 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"Discord-Bot-2FA-Key-Gen/api"
+	"Discord-Bot-2FA-Key-Gen/audit"
 	"Discord-Bot-2FA-Key-Gen/auth"
 	"Discord-Bot-2FA-Key-Gen/bot"
+	"Discord-Bot-2FA-Key-Gen/cli"
 	"Discord-Bot-2FA-Key-Gen/config"
+	"Discord-Bot-2FA-Key-Gen/guild"
 	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+	"Discord-Bot-2FA-Key-Gen/ratelimit"
+	"Discord-Bot-2FA-Key-Gen/server"
 	"Discord-Bot-2FA-Key-Gen/totp"
+	"Discord-Bot-2FA-Key-Gen/vault"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 func main() {
-	cfg := config.Load()
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	verifyAudit := flag.String("verify-audit", "", "verify the audit log at the given path and exit")
+	syncOnly := flag.Bool("sync-only", false, "sync slash commands with Discord and exit")
+	checkConfig := flag.Bool("check-config", false, "validate the configuration, print the effective settings and exit")
+	configFile := flag.String("config", "", "path to a .toml or .yaml config file (defaults to $CONFIG_FILE)")
+	overrides := settingFlags{}
+	flag.Var(overrides, "set", "override a setting as KEY=value (repeatable)")
+	flag.Parse()
+
+	configOpts := config.Options{File: *configFile, Overrides: overrides}
+	cfg, err := config.Load(configOpts)
+
+	if *verifyAudit != "" {
+		os.Exit(runVerifyAudit(*verifyAudit, cfg, err))
+	}
+
+	if *checkConfig {
+		os.Exit(runCheckConfig(cfg, err))
+	}
+
+	if err != nil {
+		logger.Init("INFO", "text")
+		logConfigError(err)
+		os.Exit(1)
+	}
+
+	logger.Init(cfg.LogLevel, cfg.LogFormat)
+
+	if *syncOnly {
+		os.Exit(runSyncOnly(cfg))
+	}
 
-	logger.Init(cfg.LogLevel)
 	logger.Info("Starting 2FA Discord Bot...")
 
-	if cfg.DiscordToken == "" {
-		logger.Fatal("DISCORD_BOT_TOKEN is required")
+	var auditLog *audit.Logger
+	if cfg.AuditLogPath != "" {
+		auditLog, err = audit.Open(cfg.AuditLogPath, cfg.AuditHMACKey)
+		if err != nil {
+			logger.Fatal("Failed to open audit log", "path", cfg.AuditLogPath, "error", err)
+		}
+		if auditLog.HeadRepaired() {
+			logger.Warn("Audit head was one record behind the log and has been moved forward", "path", cfg.AuditLogPath)
+		}
 	}
 
 	totpGen := totp.New()
-	permChecker := auth.NewPermissionChecker(cfg)
-	cooldownDuration := time.Duration(cfg.CommandCooldown) * time.Second
-	commandHandler := bot.NewCommandHandler(totpGen, permChecker, cooldownDuration)
+	guildStore, err := guild.Open(cfg.GuildSettingsPath)
+	if err != nil {
+		logger.Fatal("Failed to open guild settings", "path", cfg.GuildSettingsPath, "error", err)
+	}
+	var entryVault *vault.Vault
+	if cfg.EntryVaultKey != nil {
+		keyring, err := vault.NewKeyring(cfg.EntryVaultKeyVersion, cfg.EntryVaultKeys())
+		if err != nil {
+			logger.Fatal("Invalid vault keys", "error", err)
+		}
+		entryVault, err = vault.Open(cfg.EntryVaultPath, keyring)
+		if err != nil {
+			logger.Fatal("Failed to open vault", "path", cfg.EntryVaultPath, "error", err)
+		}
+		logger.Info("Vault opened", "path", cfg.EntryVaultPath, "entries", entryVault.Size(),
+			"key_version", cfg.EntryVaultKeyVersion, "entries_by_key_version", fmt.Sprint(entryVault.KeyVersions()))
+	}
+	permChecker, err := auth.NewPermissionChecker(cfg, auditLog, guildStore)
+	if err != nil {
+		logger.Fatal("Failed to load admin grants", "path", cfg.AdminGrantsPath, "error", err)
+	}
+	rateLimitStore, err := newRateLimitStore(cfg)
+	if err != nil {
+		logger.Fatal("Failed to open rate limit store", "store", cfg.RateLimitStore, "error", err)
+	}
+	rateLimiter := ratelimit.New(ratelimit.PolicyFromConfig(cfg), ratelimit.LockoutPolicyFromConfig(cfg), rateLimitStore)
+	commandHandler := bot.NewCommandHandler(totpGen, permChecker, auditLog, rateLimiter, entryVault, cfg.LockoutAlertChannelID)
+	commandHandler.SetApprovalTimeout(cfg.ApprovalTimeout)
+	reloader := &configReloader{
+		opts:           configOpts,
+		current:        cfg,
+		permChecker:    permChecker,
+		rateLimiter:    rateLimiter,
+		commandHandler: commandHandler,
+		entryVault:     entryVault,
+	}
 
 	dg, err := discordgo.New("Bot " + cfg.DiscordToken)
 	if err != nil {
-		logger.Fatal("Error creating Discord session:", err)
+		logger.Fatal("Error creating Discord session", "error", err)
+	}
+	dg.Client.Transport = metrics.InstrumentTransport(dg.Client.Transport)
+
+	metrics.NewGaugeFunc("discord_2fa_bot_rate_limit_buckets", "Token buckets currently tracked by the rate limiter.", func() float64 {
+		return float64(rateLimiter.Size())
+	})
+
+	var metricsServer *http.Server
+	if cfg.MetricsAddr != "" {
+		metricsServer = startMetricsServer(cfg.MetricsAddr)
 	}
 
 	dg.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
-		logger.Info("Bot is ready! Logged in as:", r.User.Username)
+		logger.Info("Bot is ready", "username", r.User.Username)
+	})
+
+	var connected, gatewayUp, commandsRegistered atomic.Bool
+	dg.AddHandler(func(s *discordgo.Session, c *discordgo.Connect) {
+		gatewayUp.Store(true)
+		if connected.Swap(true) {
+			metrics.GatewayReconnects.Inc("reconnect")
+		}
+	})
+
+	dg.AddHandler(func(s *discordgo.Session, d *discordgo.Disconnect) {
+		gatewayUp.Store(false)
 	})
 
+	dg.AddHandler(func(s *discordgo.Session, r *discordgo.Resumed) {
+		metrics.GatewayReconnects.Inc("resume")
+	})
+
+	inFlight := bot.NewInFlight()
 	dg.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if !inFlight.Begin() {
+			respondShuttingDown(s, i)
+			return
+		}
+		defer inFlight.End()
+
 		handleInteraction(s, i, commandHandler)
 	})
 
 	dg.Identify.Intents = discordgo.IntentsGuilds
 
+	var apiServer *api.Server
+	if cfg.APIAddr != "" {
+		apiServer, err = api.New(cfg, totpGen, entryVault, auditLog)
+		if err != nil {
+			logger.Fatal("Failed to start API server", "error", err)
+		}
+		reloader.apiServer = apiServer
+		apiServer.Start()
+	}
+
+	var httpServer *server.Server
+	if cfg.HTTPAddr != "" {
+		hooks := server.AdminHooks{
+			Cooldowns: func() []server.CooldownEntry {
+				var entries []server.CooldownEntry
+				for _, state := range rateLimiter.Snapshot() {
+					entries = append(entries, server.CooldownEntry{
+						Key:               state.Key,
+						Tokens:            state.Tokens,
+						Burst:             state.Burst,
+						RetryAfterSeconds: state.RetryAfter.Seconds(),
+					})
+				}
+				return entries
+			},
+			ReloadConfig: func() error {
+				return reloader.Reload("api")
+			},
+			SyncCommands: func() error {
+				return syncCommands(dg, dg.State.User.ID, cfg)
+			},
+		}
+		if entryVault != nil {
+			hooks.VaultKeys = func() server.VaultKeys {
+				return server.VaultKeys{Active: entryVault.ActiveKeyVersion(), Entries: entryVault.KeyVersions()}
+			}
+			hooks.RewrapVault = entryVault.Rewrap
+		}
+		httpServer = server.New(cfg.HTTPAddr, cfg.AdminAPIToken, hooks)
+		httpServer.AddReadinessCheck("gateway", func() error {
+			if !gatewayUp.Load() {
+				return errors.New("gateway not connected")
+			}
+			return nil
+		})
+		httpServer.AddReadinessCheck("commands", func() error {
+			if !commandsRegistered.Load() {
+				return errors.New("commands not registered")
+			}
+			return nil
+		})
+		if entryVault != nil {
+			httpServer.AddReadinessCheck("vault", entryVault.Check)
+		}
+		httpServer.AddReadinessCheck("shutdown", func() error {
+			if inFlight.Closed() {
+				return errors.New("shutting down")
+			}
+			return nil
+		})
+		httpServer.Start()
+	}
+
 	err = dg.Open()
 	if err != nil {
-		logger.Fatal("Error opening Discord connection:", err)
+		logger.Fatal("Error opening Discord connection", "error", err)
 	}
-	defer func() {
-		if err := dg.Close(); err != nil {
-			logger.Error("Error closing Discord connection:", err)
-		}
-	}()
 
-	if err := registerCommands(dg, cfg.GuildID); err != nil {
-		logger.Fatal("Failed to register commands:", err)
+	if err := syncCommands(dg, dg.State.User.ID, cfg); err != nil {
+		logger.Fatal("Failed to sync commands", "error", err)
 	}
+	commandsRegistered.Store(true)
 
-	commandHandler.StartCleanupRoutine()
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		commandHandler.RunCleanupRoutine(backgroundCtx)
+	}()
+	go func() {
+		defer background.Done()
+		paths := configOpts.WatchPaths()
+		if apiServer != nil {
+			paths = append(paths, cfg.APIKeysPath)
+		}
+		config.NewWatcher(paths, 2*time.Second).Run(backgroundCtx, func(path string) {
+			logger.Info("Configuration file changed", "path", path)
+			reloader.Reload("file")
+		})
+	}()
 
 	logger.Info("Bot is running. Press Ctrl+C to exit.")
 
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-stop
 
-	logger.Info("Shutting down bot...")
-}
+	for running := true; running; {
+		select {
+		case <-hangup:
+			reloader.Reload("sighup")
+		case <-stop:
+			running = false
+		}
+	}
 
-func handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, handler *bot.CommandHandler) {
-	defer func() {
-		if r := recover(); r != nil {
-			logger.Error("Panic in interaction handler:", r)
+	logger.Info("Shutting down bot...", "timeout", cfg.ShutdownTimeout)
+	signal.Stop(hangup)
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelDrain()
+	if err := inFlight.Drain(drainCtx); err != nil {
+		logger.Warn("Timed out waiting for in-flight interactions", "remaining", inFlight.Active())
+	} else {
+		logger.Info("All in-flight interactions finished")
+	}
+	if err := commandHandler.CloseApprovals(drainCtx, dg); err != nil {
+		logger.Warn("Timed out waiting for approval expiries", "error", err)
+	}
+
+	stopBackground()
+	background.Wait()
+
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelStop()
+	if httpServer != nil {
+		if err := httpServer.Shutdown(stopCtx); err != nil {
+			logger.Error("Error stopping HTTP server", "error", err)
 		}
-	}()
+	}
+	if apiServer != nil {
+		if err := apiServer.Shutdown(stopCtx); err != nil {
+			logger.Error("Error stopping API server", "error", err)
+		}
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(stopCtx); err != nil {
+			logger.Error("Error stopping metrics server", "error", err)
+		}
+	}
 
-	switch i.ApplicationCommandData().Name {
-	case "2fa-code":
-		handler.Handle2FACode(s, i)
-	case "2fa-generate":
-		handler.Handle2FAGenerate(s, i)
+	if err := rateLimiter.Close(); err != nil {
+		logger.Error("Error closing rate limit store", "error", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		logger.Error("Error closing audit log", "error", err)
+	}
+
+	if err := dg.Close(); err != nil {
+		logger.Error("Error closing Discord connection", "error", err)
+	}
+
+	logger.Info("Shutdown complete")
+	if err := logger.Sync(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to flush logs: %v\n", err)
 	}
 }
 
-func registerCommands(s *discordgo.Session, guildID string) error {
-	commands := []*discordgo.ApplicationCommand{
-		{
-			Name:        "2fa-code",
-			Description: "Generate a 2FA verification code from your secret key",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "secret",
-					Description: "Your 2FA secret key (Base32 format)",
-					Required:    true,
-				},
-			},
-		},
-		{
-			Name:        "2fa-generate",
-			Description: "Generate a new 2FA secret key with QR code",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "issuer",
-					Description: "Service name (optional, defaults to 'Discord 2FA Bot')",
-					Required:    false,
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "account",
-					Description: "Account name (optional, defaults to your username)",
-					Required:    false,
-				},
-			},
+func respondShuttingDown(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "The bot is restarting. Please try again in a moment.",
+			Flags:   discordgo.MessageFlagsEphemeral,
 		},
+	})
+	if err != nil {
+		logger.Error("Failed to send shutdown response", "interaction_id", i.ID, "error", err)
+	}
+}
+
+func newRateLimitStore(cfg *config.Config) (ratelimit.Store, error) {
+	if cfg.RateLimitStore == "redis" {
+		logger.Info("Using Redis rate limit store", "addr", cfg.RedisAddr, "db", cfg.RedisDB)
+		return ratelimit.NewRedisStore(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, cfg.RedisKeyPrefix)
 	}
+	return ratelimit.NewMemoryStore(), nil
+}
 
-	for _, command := range commands {
-		_, err := s.ApplicationCommandCreate(s.State.User.ID, guildID, command)
+var restartOnlySettings = map[string]bool{
+	"DISCORD_BOT_TOKEN":        true,
+	"GUILD_ID":                 true,
+	"COMMAND_GUILD_IDS":        true,
+	"COMMAND_GLOBAL":           true,
+	"LOG_FORMAT":               true,
+	"AUDIT_LOG_PATH":           true,
+	"AUDIT_HMAC_KEY":           true,
+	"GUILD_SETTINGS_PATH":      true,
+	"ADMIN_GRANTS_PATH":        true,
+	"METRICS_ADDR":             true,
+	"HTTP_ADDR":                true,
+	"ADMIN_API_TOKEN":          true,
+	"RATE_LIMIT_STORE":         true,
+	"REDIS_ADDR":               true,
+	"REDIS_PASSWORD":           true,
+	"REDIS_DB":                 true,
+	"REDIS_KEY_PREFIX":         true,
+	"LOCKOUT_ALERT_CHANNEL_ID": true,
+	"ENTRY_VAULT_PATH":         true,
+	"API_ADDR":                 true,
+	"API_KEYS_PATH":            true,
+	"API_TLS_CERT_PATH":        true,
+	"API_TLS_KEY_PATH":         true,
+	"API_CLIENT_CA_PATH":       true,
+}
+
+type configReloader struct {
+	opts           config.Options
+	current        *config.Config
+	permChecker    *auth.PermissionChecker
+	rateLimiter    *ratelimit.Limiter
+	commandHandler *bot.CommandHandler
+	apiServer      *api.Server
+	entryVault     *vault.Vault
+	mutex          sync.Mutex
+}
+
+func (r *configReloader) Reload(trigger string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cfg, err := config.Load(r.opts)
+	if err != nil {
+		metrics.ConfigReloads.Inc(trigger, "rejected")
+		logger.Error("Configuration reload rejected, keeping current configuration", "trigger", trigger, "error", err)
+		return err
+	}
+
+	// Everything is validated before anything is applied, so a rejected
+	// reload leaves the running configuration untouched.
+	var apiKeys []*api.Key
+	if r.apiServer != nil {
+		if apiKeys, err = r.apiServer.ReadKeys(); err != nil {
+			metrics.ConfigReloads.Inc(trigger, "rejected")
+			logger.Error("API key reload rejected, keeping current configuration", "trigger", trigger, "error", err)
+			return err
+		}
+	}
+
+	changed := changedSettings(r.current, cfg)
+	var keyring *vault.Keyring
+	if r.entryVault != nil && slices.ContainsFunc(changed, isVaultKeySetting) {
+		keyring, err = vault.NewKeyring(cfg.EntryVaultKeyVersion, cfg.EntryVaultKeys())
+		if err == nil {
+			err = r.entryVault.CheckKeyring(keyring)
+		}
 		if err != nil {
-			logger.Error("Cannot create command", command.Name+":", err)
+			metrics.ConfigReloads.Inc(trigger, "rejected")
+			logger.Error("Vault key reload rejected, keeping current configuration", "trigger", trigger, "error", err)
+			return err
+		}
+	}
+
+	if keyring != nil {
+		if err := r.entryVault.SetKeyring(keyring); err != nil {
+			metrics.ConfigReloads.Inc(trigger, "rejected")
+			logger.Error("Vault key reload rejected, keeping current configuration", "trigger", trigger, "error", err)
 			return err
 		}
-		logger.Info("Registered command:", command.Name)
+		logger.Info("Vault keys reloaded", "key_version", cfg.EntryVaultKeyVersion, "entries_by_key_version", fmt.Sprint(r.entryVault.KeyVersions()))
+	}
+	if r.apiServer != nil {
+		r.apiServer.SetKeys(apiKeys)
+	}
+	if len(changed) == 0 {
+		metrics.ConfigReloads.Inc(trigger, "unchanged")
+		logger.Info("Configuration reloaded, nothing changed", "trigger", trigger)
+		return nil
+	}
+
+	r.permChecker.UpdateConfig(cfg)
+	r.rateLimiter.SetPolicy(ratelimit.PolicyFromConfig(cfg))
+	r.rateLimiter.SetLockoutPolicy(ratelimit.LockoutPolicyFromConfig(cfg))
+	r.commandHandler.SetApprovalTimeout(cfg.ApprovalTimeout)
+	if r.apiServer != nil {
+		r.apiServer.SetRateLimit(cfg.APIRateLimit)
+	}
+	logger.SetLevel(cfg.LogLevel)
+	r.current = cfg
+
+	for _, key := range changed {
+		if restartOnlySettings[key] || (r.entryVault == nil && isVaultKeySetting(key)) {
+			logger.Warn("Setting changed but only takes effect after a restart", "setting", key)
+		}
+	}
+
+	metrics.ConfigReloads.Inc(trigger, "applied")
+	logger.Info("Configuration reloaded", "trigger", trigger, "changed", strings.Join(changed, ","))
+	return nil
+}
+
+func isVaultKeySetting(key string) bool {
+	return key == "ENTRY_VAULT_KEY" || key == "ENTRY_VAULT_KEY_VERSION" || key == "ENTRY_VAULT_OLD_KEYS"
+}
+
+func changedSettings(old, updated *config.Config) []string {
+	previous := make(map[string]string)
+	for _, setting := range old.Settings() {
+		previous[setting.Key] = setting.Value
+	}
+
+	var changed []string
+	for _, setting := range updated.Settings() {
+		if value, ok := previous[setting.Key]; !ok || value != setting.Value {
+			changed = append(changed, setting.Key)
+		}
+	}
+	return changed
+}
+
+func startMetricsServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		logger.Info("Metrics server listening", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server failed", "addr", addr, "error", err)
+		}
+	}()
+
+	return server
+}
+
+func syncCommands(s *discordgo.Session, appID string, cfg *config.Config) error {
+	_, err := bot.SyncCommands(s, appID, cfg.CommandGuildIDs, cfg.GlobalCommands)
+	return err
+}
+
+func runSyncOnly(cfg *config.Config) int {
+	dg, err := discordgo.New("Bot " + cfg.DiscordToken)
+	if err != nil {
+		logger.Error("Error creating Discord session", "error", err)
+		return 1
+	}
+
+	app, err := dg.User("@me")
+	if err != nil {
+		logger.Error("Failed to look up the bot user", "error", err)
+		return 1
+	}
+
+	diffs, err := bot.SyncCommands(dg, app.ID, cfg.CommandGuildIDs, cfg.GlobalCommands)
+	for _, diff := range diffs {
+		fmt.Printf("%s: %d created, %d updated, %d deleted\n", diff.Scope, len(diff.Created), len(diff.Updated), len(diff.Deleted))
 	}
+	if err != nil {
+		logger.Error("Failed to sync commands", "error", err)
+		return 1
+	}
+	return 0
+}
 
+type settingFlags map[string]string
+
+func (f settingFlags) String() string {
+	return ""
+}
+
+func (f settingFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("%q must be in the form KEY=value", value)
+	}
+	f[strings.ToUpper(strings.TrimSpace(key))] = val
 	return nil
 }
+
+func logConfigError(err error) {
+	var problems config.ValidationErrors
+	if !errors.As(err, &problems) {
+		logger.Error("Failed to load configuration", "error", err)
+		return
+	}
+	for _, problem := range problems {
+		logger.Error("Invalid configuration", "field", problem.Field, "problem", problem.Message)
+	}
+}
+
+func runCheckConfig(cfg *config.Config, err error) int {
+	if cfg != nil {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "SETTING\tVALUE\tSOURCE")
+		for _, setting := range cfg.Settings() {
+			value := setting.Value
+			if setting.Secret && value != "" {
+				value = "********"
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", setting.Key, value, setting.Source)
+		}
+		writer.Flush()
+	}
+
+	if err == nil {
+		fmt.Println("\nConfiguration OK")
+		return 0
+	}
+
+	var problems config.ValidationErrors
+	if !errors.As(err, &problems) {
+		fmt.Fprintf(os.Stderr, "\nConfiguration FAILED: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "\nConfiguration FAILED with %d problem(s):\n", len(problems))
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "  %s\n", problem)
+	}
+	return 1
+}
+
+// Only the HMAC key is needed to verify, so other configuration problems
+// don't get in the way.
+func runVerifyAudit(path string, cfg *config.Config, configErr error) int {
+	if cfg == nil || len(cfg.AuditHMACKey) == 0 {
+		fmt.Fprintln(os.Stderr, "Audit log verification needs AUDIT_HMAC_KEY, the key the log was written with.")
+		if configErr != nil {
+			fmt.Fprintf(os.Stderr, "Configuration: %v\n", configErr)
+		}
+		return 1
+	}
+
+	result, err := audit.Verify(path, cfg.AuditHMACKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Audit log verification FAILED: %v\n", err)
+		return 1
+	}
+
+	if result.HeadBehind {
+		fmt.Println("The head is one record behind the log, as after an interrupted write; the bot moves it forward on its next start.")
+	}
+	fmt.Printf("Audit log OK: %d records, head %s\n", result.Records, result.LastHash)
+	return 0
+}
+
+func handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, handler *bot.CommandHandler) {
+	start := time.Now()
+	var name string
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in interaction handler", "panic", r, "interaction_type", i.Type.String(), "name", name, "interaction_id", i.ID)
+		}
+		if name != "" {
+			logger.Debug("Interaction handled",
+				"interaction_type", i.Type.String(),
+				"name", name,
+				"interaction_id", i.ID,
+				"guild_id", i.GuildID,
+				"latency", time.Since(start),
+			)
+		}
+	}()
+
+	switch i.Type {
+	case discordgo.InteractionMessageComponent:
+		name = i.MessageComponentData().CustomID
+		handler.HandleComponent(s, i)
+		return
+	case discordgo.InteractionApplicationCommand:
+		name = i.ApplicationCommandData().Name
+	default:
+		// Autocomplete and modal submits aren't used by any command.
+		logger.Debug("Ignoring interaction", "interaction_type", i.Type.String(), "interaction_id", i.ID)
+		return
+	}
+
+	switch name {
+	case "2fa-code":
+		handler.Handle2FACode(s, i)
+	case "2fa-generate":
+		handler.Handle2FAGenerate(s, i)
+	case "2fa-verify":
+		handler.Handle2FAVerify(s, i)
+	case "2fa-shared":
+		handler.Handle2FAShared(s, i)
+	case "2fa-backup-codes":
+		handler.Handle2FABackupCodes(s, i)
+	case "2fa-rotate":
+		handler.Handle2FARotate(s, i)
+	case "2fa-config":
+		handler.Handle2FAConfig(s, i)
+	case "2fa-admin":
+		handler.Handle2FAAdmin(s, i)
+	}
+}
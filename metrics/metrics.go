@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "discord_2fa_bot_"
+
+var (
+	CommandsTotal = NewCounterVec(namespace+"commands_total",
+		"Slash commands handled, by command and outcome.", "command", "outcome")
+	PermissionDenials = NewCounterVec(namespace+"permission_denials_total",
+		"Commands rejected by the permission checker.", "command")
+	CooldownRejections = NewCounterVec(namespace+"cooldown_rejections_total",
+		"Commands rejected because the user is on cooldown.", "command")
+	ValidationFailures = NewCounterVec(namespace+"validation_failures_total",
+		"Secret validation failures, by reason.", "reason")
+	DiscordAPILatency = NewHistogramVec(namespace+"discord_api_request_duration_seconds",
+		"Latency of Discord REST API requests.", nil, "method", "status")
+	DiscordAPIErrors = NewCounterVec(namespace+"discord_api_errors_total",
+		"Discord REST API requests that failed or returned an error status.", "method", "status")
+	FailedAttempts = NewCounterVec(namespace+"failed_attempts_total",
+		"Failures counted towards lockouts, by reason.", "reason")
+	Lockouts = NewCounterVec(namespace+"lockouts_total",
+		"Lockouts applied after repeated failures, by the reason of the final failure.", "reason")
+	GatewayReconnects = NewCounterVec(namespace+"gateway_reconnects_total",
+		"Discord gateway reconnections, by kind.", "kind")
+	ConfigReloads = NewCounterVec(namespace+"config_reloads_total",
+		"Configuration reload attempts, by trigger and outcome.", "trigger", "outcome")
+	Approvals = NewCounterVec(namespace+"approvals_total",
+		"Shared code approval requests, by outcome.", "outcome")
+	APIRequests = NewCounterVec(namespace+"api_requests_total",
+		"REST API requests, by API key, route and status code.", "key", "route", "status")
+	RateLimitStoreErrors = NewCounterVec(namespace+"rate_limit_store_errors_total",
+		"Rate limit store operations that failed and used the in-process fallback, by operation.", "operation")
+)
+
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func InstrumentTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &instrumentedTransport{next: next}
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start).Seconds()
+
+	status := "error"
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+
+	DiscordAPILatency.Observe(elapsed, req.Method, status)
+	if err != nil || resp.StatusCode >= 400 {
+		DiscordAPIErrors.Inc(req.Method, status)
+	}
+
+	return resp, err
+}
@@ -0,0 +1,240 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/config"
+	"Discord-Bot-2FA-Key-Gen/logger"
+	"Discord-Bot-2FA-Key-Gen/metrics"
+)
+
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+func (l Limit) Enabled() bool {
+	return l.Count > 0 && l.Period > 0
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Count) / l.Period.Seconds()
+}
+
+type Policy struct {
+	User        Limit
+	Commands    map[string]Limit
+	Guild       Limit
+	Global      Limit
+	ExemptRoles []string
+}
+
+func PolicyFromConfig(cfg *config.Config) Policy {
+	policy := Policy{
+		User:        Limit(cfg.UserRateLimit),
+		Commands:    make(map[string]Limit, len(cfg.CommandRateLimits)),
+		Guild:       Limit(cfg.GuildRateLimit),
+		Global:      Limit(cfg.GlobalRateLimit),
+		ExemptRoles: cfg.RateLimitExemptRoles,
+	}
+	for command, limit := range cfg.CommandRateLimits {
+		policy.Commands[command] = Limit(limit)
+	}
+	return policy
+}
+
+type Request struct {
+	UserID    string
+	GuildID   string
+	Command   string
+	Roles     []string
+	UserLimit Limit
+}
+
+type Scope string
+
+const (
+	ScopeUser    Scope = "user"
+	ScopeCommand Scope = "command"
+	ScopeGuild   Scope = "guild"
+	ScopeGlobal  Scope = "global"
+	ScopeLockout Scope = "lockout"
+)
+
+type Decision struct {
+	Allowed    bool
+	Exempt     bool
+	Scope      Scope
+	RetryAfter time.Duration
+}
+
+type BucketCheck struct {
+	Key   string
+	Scope Scope
+	Limit Limit
+}
+
+// When a shared store such as Redis fails, requests are limited by fallback,
+// an in-process store, rather than let through unlimited. Lockouts recorded
+// there keep applying after the shared store recovers until they expire.
+type Limiter struct {
+	policy        Policy
+	lockoutPolicy LockoutPolicy
+	store         Store
+	fallback      *MemoryStore
+	mutex         sync.RWMutex
+	now           func() time.Time
+}
+
+func New(policy Policy, lockoutPolicy LockoutPolicy, store Store) *Limiter {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	fallback, ok := store.(*MemoryStore)
+	if !ok {
+		fallback = NewMemoryStore()
+	}
+	return &Limiter{
+		policy:        policy,
+		lockoutPolicy: lockoutPolicy,
+		store:         store,
+		fallback:      fallback,
+		now:           time.Now,
+	}
+}
+
+func (l *Limiter) usesFallback() bool {
+	return l.store != Store(l.fallback)
+}
+
+func (l *Limiter) storeFailed(operation, userID string, err error) {
+	metrics.RateLimitStoreErrors.Inc(operation)
+	logger.Error("Rate limit store unavailable, using in-process state", "operation", operation, "user_id", userID, "error", err)
+}
+
+func (l *Limiter) SetPolicy(policy Policy) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.policy = policy
+}
+
+func (l *Limiter) Allow(req Request) Decision {
+	l.mutex.RLock()
+	exempt := isExempt(l.policy.ExemptRoles, req.Roles)
+	var checks []BucketCheck
+	if !exempt {
+		checks = checksFor(l.policy, req)
+	}
+	l.mutex.RUnlock()
+
+	now := l.now()
+	if until, locked := l.fallback.lockedUntil(now, req.UserID); locked && l.usesFallback() {
+		return Decision{Scope: ScopeLockout, RetryAfter: until.Sub(now)}
+	}
+
+	decision, err := l.store.Allow(now, req.UserID, checks)
+	if err != nil {
+		l.storeFailed("allow", req.UserID, err)
+		decision, _ = l.fallback.Allow(now, req.UserID, checks)
+	}
+
+	if decision.Allowed && exempt {
+		decision.Exempt = true
+	}
+	return decision
+}
+
+func (l *Limiter) Reset(userID string) {
+	if l.usesFallback() {
+		_ = l.fallback.Reset(userID)
+	}
+	if err := l.store.Reset(userID); err != nil {
+		logger.Error("Failed to reset rate limits", "user_id", userID, "error", err)
+	}
+}
+
+func (l *Limiter) Size() int {
+	size, err := l.store.Size()
+	if err != nil {
+		logger.Error("Failed to count rate limit buckets", "error", err)
+	}
+	return size
+}
+
+func (l *Limiter) Snapshot() []BucketState {
+	states, err := l.store.Snapshot(l.now())
+	if err != nil {
+		logger.Error("Failed to list rate limit buckets", "error", err)
+	}
+	return states
+}
+
+func (l *Limiter) CleanupExpired() {
+	if l.usesFallback() {
+		_ = l.fallback.Cleanup(l.now(), l.currentLockoutPolicy())
+	}
+	if err := l.store.Cleanup(l.now(), l.currentLockoutPolicy()); err != nil {
+		logger.Error("Failed to clean up rate limit state", "error", err)
+	}
+}
+
+func (l *Limiter) Close() error {
+	return l.store.Close()
+}
+
+func checksFor(policy Policy, req Request) []BucketCheck {
+	var checks []BucketCheck
+
+	if limit, ok := policy.Commands[req.Command]; ok && limit.Enabled() {
+		checks = append(checks, BucketCheck{Key: userKey(req.UserID) + ":" + req.Command, Scope: ScopeCommand, Limit: limit})
+	} else if req.UserLimit.Enabled() {
+		checks = append(checks, BucketCheck{Key: userKey(req.UserID), Scope: ScopeUser, Limit: req.UserLimit})
+	} else if policy.User.Enabled() {
+		checks = append(checks, BucketCheck{Key: userKey(req.UserID), Scope: ScopeUser, Limit: policy.User})
+	}
+
+	if req.GuildID != "" && policy.Guild.Enabled() {
+		checks = append(checks, BucketCheck{Key: "guild:" + req.GuildID, Scope: ScopeGuild, Limit: policy.Guild})
+	}
+
+	if policy.Global.Enabled() {
+		checks = append(checks, BucketCheck{Key: "global", Scope: ScopeGlobal, Limit: policy.Global})
+	}
+
+	return checks
+}
+
+func isExempt(exemptRoles, roles []string) bool {
+	for _, exempt := range exemptRoles {
+		for _, role := range roles {
+			if role != "" && role == exempt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func userKey(userID string) string {
+	return "user:" + userID
+}
+
+func (d Decision) Message() string {
+	seconds := int(math.Ceil(d.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	switch d.Scope {
+	case ScopeLockout:
+		return fmt.Sprintf("You are temporarily locked out after repeated failed attempts. Try again in %s.", formatDuration(d.RetryAfter))
+	case ScopeGuild, ScopeGlobal:
+		return fmt.Sprintf("The bot is handling too many requests right now. Please try again in %d seconds.", seconds)
+	default:
+		return fmt.Sprintf("Please wait %d seconds before using this command again.", seconds)
+	}
+}
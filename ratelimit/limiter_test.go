@@ -0,0 +1,211 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/metrics"
+)
+
+var errStoreDown = errors.New("connection refused")
+
+// flakyStore wraps a memory store and fails every call while down is set.
+type flakyStore struct {
+	*MemoryStore
+	down bool
+}
+
+func (f *flakyStore) Allow(now time.Time, userID string, checks []BucketCheck) (Decision, error) {
+	if f.down {
+		return Decision{}, errStoreDown
+	}
+	return f.MemoryStore.Allow(now, userID, checks)
+}
+
+func (f *flakyStore) RecordFailure(now time.Time, userID string, policy LockoutPolicy) (Lockout, error) {
+	if f.down {
+		return Lockout{}, errStoreDown
+	}
+	return f.MemoryStore.RecordFailure(now, userID, policy)
+}
+
+func (f *flakyStore) ClearLockout(now time.Time, userID string) (bool, error) {
+	if f.down {
+		return false, errStoreDown
+	}
+	return f.MemoryStore.ClearLockout(now, userID)
+}
+
+func newTestLimiter(policy Policy, lockout LockoutPolicy, store Store) (*Limiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New(policy, lockout, store)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiterAllow(t *testing.T) {
+	perMinute := func(count int) Limit { return Limit{Count: count, Period: time.Minute} }
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		requests  []Request
+		wantLast  bool
+		wantScope Scope
+	}{
+		{
+			name:     "within the user limit",
+			policy:   Policy{User: perMinute(2)},
+			requests: []Request{{UserID: "u1"}, {UserID: "u1"}},
+			wantLast: true,
+		},
+		{
+			name:      "over the user limit",
+			policy:    Policy{User: perMinute(2)},
+			requests:  []Request{{UserID: "u1"}, {UserID: "u1"}, {UserID: "u1"}},
+			wantScope: ScopeUser,
+		},
+		{
+			name:     "users have separate buckets",
+			policy:   Policy{User: perMinute(1)},
+			requests: []Request{{UserID: "u1"}, {UserID: "u2"}},
+			wantLast: true,
+		},
+		{
+			name:      "command limit replaces the user limit",
+			policy:    Policy{User: perMinute(5), Commands: map[string]Limit{"2fa-code": perMinute(1)}},
+			requests:  []Request{{UserID: "u1", Command: "2fa-code"}, {UserID: "u1", Command: "2fa-code"}},
+			wantScope: ScopeCommand,
+		},
+		{
+			name:      "guild limit is shared",
+			policy:    Policy{Guild: perMinute(1)},
+			requests:  []Request{{UserID: "u1", GuildID: "g"}, {UserID: "u2", GuildID: "g"}},
+			wantScope: ScopeGuild,
+		},
+		{
+			name:      "global limit is shared",
+			policy:    Policy{Global: perMinute(1)},
+			requests:  []Request{{UserID: "u1"}, {UserID: "u2", GuildID: "g"}},
+			wantScope: ScopeGlobal,
+		},
+		{
+			name:     "exempt roles skip every limit",
+			policy:   Policy{User: perMinute(1), ExemptRoles: []string{"staff"}},
+			requests: []Request{{UserID: "u1", Roles: []string{"staff"}}, {UserID: "u1", Roles: []string{"staff"}}},
+			wantLast: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestLimiter(tt.policy, LockoutPolicy{}, nil)
+
+			var decision Decision
+			for _, req := range tt.requests {
+				decision = l.Allow(req)
+			}
+			if decision.Allowed != tt.wantLast {
+				t.Fatalf("Allowed = %v, want %v", decision.Allowed, tt.wantLast)
+			}
+			if !tt.wantLast && decision.Scope != tt.wantScope {
+				t.Errorf("Scope = %q, want %q", decision.Scope, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, Window: time.Minute, BaseDuration: time.Minute, MaxDuration: 4 * time.Minute}
+	l, now := newTestLimiter(Policy{}, policy, nil)
+
+	for attempt := 1; attempt < 3; attempt++ {
+		if lockout := l.RecordFailure("u1"); lockout.Triggered {
+			t.Fatalf("locked out after %d failures", attempt)
+		}
+	}
+	lockout := l.RecordFailure("u1")
+	if !lockout.Triggered || lockout.Duration != time.Minute {
+		t.Fatalf("RecordFailure = %+v, want a one minute lockout", lockout)
+	}
+	if decision := l.Allow(Request{UserID: "u1"}); decision.Allowed || decision.Scope != ScopeLockout {
+		t.Fatalf("Allow during lockout = %+v", decision)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if decision := l.Allow(Request{UserID: "u1"}); !decision.Allowed {
+		t.Fatalf("Allow after lockout = %+v", decision)
+	}
+
+	for range 3 {
+		lockout = l.RecordFailure("u1")
+	}
+	if lockout.Level != 2 || lockout.Duration != 2*time.Minute {
+		t.Fatalf("second lockout = %+v, want level 2 for two minutes", lockout)
+	}
+	if !l.ClearLockout("u1") {
+		t.Fatal("ClearLockout reported no active lockout")
+	}
+	if decision := l.Allow(Request{UserID: "u1"}); !decision.Allowed {
+		t.Fatalf("Allow after ClearLockout = %+v", decision)
+	}
+}
+
+func TestLimiterFallsBackWhenStoreFails(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), down: true}
+	policy := Policy{User: Limit{Count: 1, Period: time.Minute}}
+	lockoutPolicy := LockoutPolicy{Threshold: 2, Window: time.Minute, BaseDuration: time.Hour}
+	l, _ := newTestLimiter(policy, lockoutPolicy, store)
+	before := storeErrors(t, "allow")
+
+	if decision := l.Allow(Request{UserID: "u1"}); !decision.Allowed {
+		t.Fatalf("first request while the store is down = %+v, want allowed", decision)
+	}
+	if decision := l.Allow(Request{UserID: "u1"}); decision.Allowed || decision.Scope != ScopeUser {
+		t.Fatalf("second request while the store is down = %+v, want the user limit", decision)
+	}
+	if got := storeErrors(t, "allow"); got != before+2 {
+		t.Errorf("allow store errors = %v, want %v", got, before+2)
+	}
+
+	l.RecordFailure("u2")
+	if lockout := l.RecordFailure("u2"); !lockout.Triggered {
+		t.Fatalf("lockout while the store is down = %+v, want triggered", lockout)
+	}
+
+	store.down = false
+	if decision := l.Allow(Request{UserID: "u2"}); decision.Allowed || decision.Scope != ScopeLockout {
+		t.Fatalf("request after the store recovered = %+v, want the fallback lockout", decision)
+	}
+	if !l.ClearLockout("u2") {
+		t.Fatal("ClearLockout did not report the fallback lockout")
+	}
+	if decision := l.Allow(Request{UserID: "u2"}); !decision.Allowed {
+		t.Fatalf("request after ClearLockout = %+v", decision)
+	}
+}
+
+func storeErrors(t *testing.T, operation string) float64 {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+
+	prefix := `discord_2fa_bot_rate_limit_store_errors_total{operation="` + operation + `"} `
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, prefix); ok {
+			var count float64
+			if _, err := fmt.Sscan(value, &count); err != nil {
+				t.Fatalf("parse %q: %v", line, err)
+			}
+			return count
+		}
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/config"
+	"Discord-Bot-2FA-Key-Gen/logger"
+)
+
+type LockoutPolicy struct {
+	Threshold    int
+	Window       time.Duration
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+	ResetAfter   time.Duration
+}
+
+func (p LockoutPolicy) Enabled() bool {
+	return p.Threshold > 0 && p.BaseDuration > 0
+}
+
+func LockoutPolicyFromConfig(cfg *config.Config) LockoutPolicy {
+	return LockoutPolicy{
+		Threshold:    cfg.LockoutThreshold,
+		Window:       cfg.LockoutWindow,
+		BaseDuration: cfg.LockoutBaseDuration,
+		MaxDuration:  cfg.LockoutMaxDuration,
+		ResetAfter:   cfg.LockoutResetAfter,
+	}
+}
+
+type Lockout struct {
+	Triggered bool
+	Failures  int
+	Level     int
+	Duration  time.Duration
+	Until     time.Time
+}
+
+func (l *Limiter) SetLockoutPolicy(policy LockoutPolicy) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.lockoutPolicy = policy
+}
+
+func (l *Limiter) currentLockoutPolicy() LockoutPolicy {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return l.lockoutPolicy
+}
+
+func (l *Limiter) RecordFailure(userID string) Lockout {
+	policy := l.currentLockoutPolicy()
+	if !policy.Enabled() || userID == "" {
+		return Lockout{}
+	}
+
+	lockout, err := l.store.RecordFailure(l.now(), userID, policy)
+	if err != nil {
+		l.storeFailed("record_failure", userID, err)
+		lockout, _ = l.fallback.RecordFailure(l.now(), userID, policy)
+	}
+	return lockout
+}
+
+func (l *Limiter) ClearLockout(userID string) bool {
+	var fallbackLocked bool
+	if l.usesFallback() {
+		fallbackLocked, _ = l.fallback.ClearLockout(l.now(), userID)
+	}
+	wasLocked, err := l.store.ClearLockout(l.now(), userID)
+	if err != nil {
+		logger.Error("Failed to clear lockout", "user_id", userID, "error", err)
+	}
+	return wasLocked || fallbackLocked
+}
+
+func lockoutDuration(policy LockoutPolicy, level int) time.Duration {
+	duration := time.Duration(float64(policy.BaseDuration) * math.Pow(2, float64(level-1)))
+	if policy.MaxDuration > 0 && (duration > policy.MaxDuration || duration <= 0) {
+		duration = policy.MaxDuration
+	}
+	return duration
+}
+
+func (lo Lockout) Message() string {
+	return fmt.Sprintf("Too many failed attempts. You are locked out for %s.", formatDuration(lo.Duration))
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return plural(int(math.Ceil(d.Hours())), "hour")
+	case d >= time.Minute:
+		return plural(int(math.Ceil(d.Minutes())), "minute")
+	default:
+		return plural(int(math.Ceil(d.Seconds())), "second")
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,305 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const allowScript = `
+local now = tonumber(ARGV[1])
+local locked = tonumber(redis.call('HGET', KEYS[1], 'locked_until') or '0')
+if locked > now then
+	return {-1, locked - now}
+end
+
+local tokens = {}
+for i = 2, #KEYS do
+	local count = tonumber(ARGV[2 * i - 2])
+	local period = tonumber(ARGV[2 * i - 1])
+	local rate = count / period
+	local state = redis.call('HMGET', KEYS[i], 'tokens', 'updated')
+	local t = tonumber(state[1])
+	local updated = tonumber(state[2])
+	if t == nil or updated == nil then
+		t = count
+		updated = now
+	end
+	if now > updated then
+		t = t + (now - updated) * rate
+	end
+	if t > count then
+		t = count
+	end
+	if t < 1 then
+		return {i - 1, math.ceil((1 - t) / rate)}
+	end
+	tokens[i] = t
+end
+
+for i = 2, #KEYS do
+	local count = ARGV[2 * i - 2]
+	local period = ARGV[2 * i - 1]
+	redis.call('HSET', KEYS[i], 'tokens', tostring(tokens[i] - 1), 'updated', now, 'count', count, 'period', period)
+	redis.call('PEXPIRE', KEYS[i], period)
+end
+return {0, 0}
+`
+
+const recordFailureScript = `
+local now = tonumber(ARGV[1])
+local threshold = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local base = tonumber(ARGV[4])
+local max = tonumber(ARGV[5])
+local reset = tonumber(ARGV[6])
+
+local level = tonumber(redis.call('HGET', KEYS[1], 'level') or '0')
+local last = tonumber(redis.call('HGET', KEYS[1], 'last_failure') or '0')
+if reset > 0 and last > 0 and now - last > reset then
+	level = 0
+end
+
+if window > 0 then
+	redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', '(' .. (now - window + 1))
+end
+local seq = redis.call('HINCRBY', KEYS[1], 'seq', 1)
+redis.call('ZADD', KEYS[2], now, now .. ':' .. seq)
+local failures = redis.call('ZCARD', KEYS[2])
+redis.call('HSET', KEYS[1], 'level', level, 'last_failure', now)
+
+local duration = 0
+local locked_until = 0
+if failures >= threshold then
+	level = level + 1
+	duration = base * math.pow(2, level - 1)
+	if max > 0 and duration > max then
+		duration = max
+	end
+	duration = math.floor(duration)
+	locked_until = now + duration
+	redis.call('HSET', KEYS[1], 'level', level, 'locked_until', locked_until)
+	redis.call('DEL', KEYS[2])
+end
+
+local ttl = math.max(window, reset, max, 86400000)
+redis.call('PEXPIRE', KEYS[1], ttl + duration)
+if window > 0 and failures < threshold then
+	redis.call('PEXPIRE', KEYS[2], window)
+end
+return {failures, level, duration, locked_until}
+`
+
+const clearLockoutScript = `
+local locked = tonumber(redis.call('HGET', KEYS[1], 'locked_until') or '0')
+redis.call('DEL', KEYS[1], KEYS[2])
+return locked
+`
+
+type RedisStore struct {
+	client *redisClient
+	prefix string
+}
+
+func NewRedisStore(addr, password string, db int, prefix string) (*RedisStore, error) {
+	store := &RedisStore{
+		client: newRedisClient(addr, password, db),
+		prefix: prefix,
+	}
+
+	if _, err := store.client.Do("PING"); err != nil {
+		store.client.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (r *RedisStore) Allow(now time.Time, userID string, checks []BucketCheck) (Decision, error) {
+	nowMs := now.UnixMilli()
+
+	args := []string{"EVAL", allowScript, strconv.Itoa(len(checks) + 1), r.lockoutKey(userID)}
+	for _, c := range checks {
+		args = append(args, r.bucketKey(c.Key))
+	}
+	args = append(args, strconv.FormatInt(nowMs, 10))
+	for _, c := range checks {
+		args = append(args, strconv.Itoa(c.Limit.Count), strconv.FormatInt(c.Limit.Period.Milliseconds(), 10))
+	}
+
+	reply, err := r.client.Do(args...)
+	if err != nil {
+		return Decision{}, err
+	}
+	values, err := replyInts(reply)
+	if err != nil || len(values) != 2 {
+		return Decision{}, fmt.Errorf("unexpected rate limit script reply: %v", reply)
+	}
+
+	index, wait := values[0], time.Duration(values[1])*time.Millisecond
+	switch {
+	case index == 0:
+		return Decision{Allowed: true}, nil
+	case index < 0:
+		return Decision{Scope: ScopeLockout, RetryAfter: wait}, nil
+	case int(index) <= len(checks):
+		return Decision{Scope: checks[index-1].Scope, RetryAfter: wait}, nil
+	default:
+		return Decision{}, fmt.Errorf("rate limit script returned unknown bucket %d", index)
+	}
+}
+
+func (r *RedisStore) RecordFailure(now time.Time, userID string, policy LockoutPolicy) (Lockout, error) {
+	reply, err := r.client.Do("EVAL", recordFailureScript, "2",
+		r.lockoutKey(userID), r.failuresKey(userID),
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.Itoa(policy.Threshold),
+		strconv.FormatInt(policy.Window.Milliseconds(), 10),
+		strconv.FormatInt(policy.BaseDuration.Milliseconds(), 10),
+		strconv.FormatInt(policy.MaxDuration.Milliseconds(), 10),
+		strconv.FormatInt(policy.ResetAfter.Milliseconds(), 10),
+	)
+	if err != nil {
+		return Lockout{}, err
+	}
+	values, err := replyInts(reply)
+	if err != nil || len(values) != 4 {
+		return Lockout{}, fmt.Errorf("unexpected lockout script reply: %v", reply)
+	}
+
+	lockout := Lockout{
+		Failures: int(values[0]),
+		Level:    int(values[1]),
+	}
+	if values[2] > 0 {
+		lockout.Triggered = true
+		lockout.Duration = time.Duration(values[2]) * time.Millisecond
+		lockout.Until = time.UnixMilli(values[3])
+	}
+	return lockout, nil
+}
+
+func (r *RedisStore) ClearLockout(now time.Time, userID string) (bool, error) {
+	reply, err := r.client.Do("EVAL", clearLockoutScript, "2", r.lockoutKey(userID), r.failuresKey(userID))
+	if err != nil {
+		return false, err
+	}
+	lockedUntil, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("unexpected clear lockout reply: %v", reply)
+	}
+	return lockedUntil > now.UnixMilli(), nil
+}
+
+func (r *RedisStore) Reset(userID string) error {
+	key := r.bucketKey(userKey(userID))
+	keys, err := r.scan(key + ":*")
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.Do(append([]string{"DEL", key}, keys...)...)
+	return err
+}
+
+func (r *RedisStore) Snapshot(now time.Time) ([]BucketState, error) {
+	keys, err := r.scan(r.bucketKey("*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var states []BucketState
+	for _, key := range keys {
+		reply, err := r.client.Do("HMGET", key, "tokens", "updated", "count", "period")
+		if err != nil {
+			return states, err
+		}
+		fields, ok := reply.([]any)
+		if !ok || len(fields) != 4 {
+			continue
+		}
+
+		tokens, _ := strconv.ParseFloat(replyString(fields[0]), 64)
+		updated, _ := strconv.ParseInt(replyString(fields[1]), 10, 64)
+		count, _ := strconv.Atoi(replyString(fields[2]))
+		period, _ := strconv.ParseInt(replyString(fields[3]), 10, 64)
+		if count <= 0 || period <= 0 {
+			continue
+		}
+
+		b := &bucket{
+			tokens:  tokens,
+			updated: time.UnixMilli(updated),
+			limit:   Limit{Count: count, Period: time.Duration(period) * time.Millisecond},
+		}
+		if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+			b.tokens = math.Min(float64(count), b.tokens+elapsed*b.limit.rate())
+		}
+		if b.tokens >= float64(count) {
+			continue
+		}
+
+		states = append(states, BucketState{
+			Key:        strings.TrimPrefix(key, r.bucketKey("")),
+			Tokens:     b.tokens,
+			Burst:      count,
+			RetryAfter: retryAfter(b),
+		})
+	}
+	return states, nil
+}
+
+func (r *RedisStore) Size() (int, error) {
+	keys, err := r.scan(r.bucketKey("*"))
+	return len(keys), err
+}
+
+func (r *RedisStore) Cleanup(time.Time, LockoutPolicy) error {
+	return nil
+}
+
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
+
+func (r *RedisStore) scan(pattern string) ([]string, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := r.client.Do("SCAN", cursor, "MATCH", pattern, "COUNT", "500")
+		if err != nil {
+			return keys, err
+		}
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 2 {
+			return keys, fmt.Errorf("unexpected SCAN reply: %v", reply)
+		}
+		batch, _ := parts[1].([]any)
+		for _, key := range batch {
+			keys = append(keys, replyString(key))
+		}
+
+		cursor = replyString(parts[0])
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+func (r *RedisStore) bucketKey(key string) string {
+	return r.prefix + "bucket:" + key
+}
+
+func (r *RedisStore) lockoutKey(userID string) string {
+	return r.prefix + "lockout:" + userID
+}
+
+func (r *RedisStore) failuresKey(userID string) string {
+	return r.prefix + "lockout:" + userID + ":failures"
+}
+
+func replyString(reply any) string {
+	value, _ := reply.(string)
+	return value
+}
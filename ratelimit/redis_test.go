@@ -0,0 +1,468 @@
+package ratelimit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis speaks enough RESP to stand in for a Redis server: it parses
+// every command, records it, and answers with whatever reply returns.
+type fakeRedis struct {
+	listener net.Listener
+	reply    func(args []string) string
+
+	mutex    sync.Mutex
+	commands [][]string
+}
+
+func newFakeRedis(t *testing.T, reply func(args []string) string) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: listener, reply: reply}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		f.mutex.Lock()
+		f.commands = append(f.commands, args)
+		f.mutex.Unlock()
+
+		reply := f.reply(args)
+		if reply == "" {
+			return
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) names() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var names []string
+	for _, args := range f.commands {
+		names = append(names, args[0])
+	}
+	return names
+}
+
+func (f *fakeRedis) last(name string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for idx := len(f.commands) - 1; idx >= 0; idx-- {
+		if f.commands[idx][0] == name {
+			return f.commands[idx]
+		}
+	}
+	return nil
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for idx := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "$")))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[idx] = string(data[:size])
+	}
+	return args, nil
+}
+
+func respInts(values ...int64) string {
+	reply := "*" + strconv.Itoa(len(values)) + "\r\n"
+	for _, value := range values {
+		reply += ":" + strconv.FormatInt(value, 10) + "\r\n"
+	}
+	return reply
+}
+
+// replies answers PING with PONG and every other command from the map.
+func replies(byCommand map[string]string) func([]string) string {
+	return func(args []string) string {
+		if reply, ok := byCommand[args[0]]; ok {
+			return reply
+		}
+		if args[0] == "PING" {
+			return "+PONG\r\n"
+		}
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+func newTestRedisStore(t *testing.T, reply func([]string) string) (*RedisStore, *fakeRedis) {
+	t.Helper()
+
+	server := newFakeRedis(t, reply)
+	store, err := NewRedisStore(server.addr(), "", 0, "test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func TestNewRedisStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		db        int
+		reply     func([]string) string
+		wantErr   string
+		wantNames []string
+	}{
+		{
+			name:      "ping only",
+			reply:     replies(nil),
+			wantNames: []string{"PING"},
+		},
+		{
+			name:      "auth and select",
+			password:  "hunter2",
+			db:        3,
+			reply:     replies(map[string]string{"AUTH": "+OK\r\n", "SELECT": "+OK\r\n"}),
+			wantNames: []string{"AUTH", "SELECT", "PING"},
+		},
+		{
+			name:     "wrong password",
+			password: "wrong",
+			reply:    replies(map[string]string{"AUTH": "-WRONGPASS invalid username-password pair\r\n"}),
+			wantErr:  "redis authentication failed",
+		},
+		{
+			name:    "unknown database",
+			db:      99,
+			reply:   replies(map[string]string{"SELECT": "-ERR DB index is out of range\r\n"}),
+			wantErr: "failed to select redis database 99",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeRedis(t, tt.reply)
+			store, err := NewRedisStore(server.addr(), tt.password, tt.db, "test:")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if got := server.names(); !slices.Equal(got, tt.wantNames) {
+				t.Errorf("commands = %v, want %v", got, tt.wantNames)
+			}
+			if tt.password != "" && server.last("AUTH")[1] != tt.password {
+				t.Errorf("AUTH = %v", server.last("AUTH"))
+			}
+		})
+	}
+}
+
+func TestNewRedisStoreUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	if _, err := NewRedisStore(addr, "", 0, "test:"); err == nil {
+		t.Fatal("NewRedisStore succeeded without a server")
+	}
+}
+
+func TestRedisStoreAllow(t *testing.T) {
+	checks := []BucketCheck{
+		{Key: userKey("u1"), Scope: ScopeUser, Limit: Limit{Count: 5, Period: time.Minute}},
+		{Key: "guild:g1", Scope: ScopeGuild, Limit: Limit{Count: 20, Period: time.Hour}},
+	}
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    Decision
+		wantErr bool
+	}{
+		{"allowed", respInts(0, 0), Decision{Allowed: true}, false},
+		{"locked out", respInts(-1, 3000), Decision{Scope: ScopeLockout, RetryAfter: 3 * time.Second}, false},
+		{"first bucket empty", respInts(1, 1500), Decision{Scope: ScopeUser, RetryAfter: 1500 * time.Millisecond}, false},
+		{"second bucket empty", respInts(2, 60000), Decision{Scope: ScopeGuild, RetryAfter: time.Minute}, false},
+		{"unknown bucket", respInts(3, 10), Decision{}, true},
+		{"short reply", respInts(0), Decision{}, true},
+		{"script error", "-ERR Error running script\r\n", Decision{}, true},
+		{"wrong reply type", "+OK\r\n", Decision{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, server := newTestRedisStore(t, replies(map[string]string{"EVAL": tt.reply}))
+			now := time.UnixMilli(1_700_000_000_000)
+
+			got, err := store.Allow(now, "u1", checks)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Allow = %+v, want %+v", got, tt.want)
+			}
+
+			want := []string{"EVAL", allowScript, "3",
+				"test:lockout:u1", "test:bucket:" + userKey("u1"), "test:bucket:guild:g1",
+				"1700000000000", "5", "60000", "20", "3600000"}
+			if args := server.last("EVAL"); !slices.Equal(args, want) {
+				t.Errorf("EVAL args = %q, want %q", args[2:], want[2:])
+			}
+		})
+	}
+}
+
+func TestRedisStoreRecordFailure(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, Window: time.Minute, BaseDuration: time.Minute, MaxDuration: time.Hour, ResetAfter: 24 * time.Hour}
+	until := time.UnixMilli(1_700_000_060_000)
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    Lockout
+		wantErr bool
+	}{
+		{"counted", respInts(2, 0, 0, 0), Lockout{Failures: 2}, false},
+		{"triggered", respInts(3, 1, 60000, until.UnixMilli()), Lockout{Failures: 3, Level: 1, Triggered: true, Duration: time.Minute, Until: until}, false},
+		{"short reply", respInts(3, 1), Lockout{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, server := newTestRedisStore(t, replies(map[string]string{"EVAL": tt.reply}))
+
+			got, err := store.RecordFailure(time.UnixMilli(1_700_000_000_000), "u1", policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Until.Equal(tt.want.Until) {
+				t.Errorf("Until = %v, want %v", got.Until, tt.want.Until)
+			}
+			got.Until, tt.want.Until = time.Time{}, time.Time{}
+			if got != tt.want {
+				t.Errorf("RecordFailure = %+v, want %+v", got, tt.want)
+			}
+
+			want := []string{"EVAL", recordFailureScript, "2", "test:lockout:u1", "test:lockout:u1:failures",
+				"1700000000000", "3", "60000", "60000", "3600000", "86400000"}
+			if args := server.last("EVAL"); !slices.Equal(args, want) {
+				t.Errorf("EVAL args = %q, want %q", args[2:], want[2:])
+			}
+		})
+	}
+}
+
+func TestRedisStoreClearLockout(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    bool
+		wantErr bool
+	}{
+		{"active lockout", ":1700000005000\r\n", true, false},
+		{"expired lockout", ":1699999995000\r\n", false, false},
+		{"no lockout", ":0\r\n", false, false},
+		{"wrong reply type", "$2\r\nok\r\n", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _ := newTestRedisStore(t, replies(map[string]string{"EVAL": tt.reply}))
+
+			got, err := store.ClearLockout(now, "u1")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ClearLockout = %v, %v; want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedisStoreResetScansEveryPage(t *testing.T) {
+	store, server := newTestRedisStore(t, func(args []string) string {
+		switch {
+		case args[0] == "PING":
+			return "+PONG\r\n"
+		case args[0] == "SCAN" && args[1] == "0":
+			return "*2\r\n$2\r\n17\r\n*1\r\n$26\r\ntest:bucket:user:u1:2fa-co\r\n"
+		case args[0] == "SCAN" && args[1] == "17":
+			return "*2\r\n$1\r\n0\r\n*1\r\n$27\r\ntest:bucket:user:u1:2fa-gen\r\n"
+		case args[0] == "DEL":
+			return ":3\r\n"
+		}
+		return "-ERR unexpected\r\n"
+	})
+
+	if err := store.Reset("u1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DEL", "test:bucket:user:u1", "test:bucket:user:u1:2fa-co", "test:bucket:user:u1:2fa-gen"}
+	if got := server.last("DEL"); !slices.Equal(got, want) {
+		t.Errorf("DEL = %q, want %q", got, want)
+	}
+	if scan := server.last("SCAN"); scan[3] != "test:bucket:user:u1:*" {
+		t.Errorf("SCAN pattern = %q", scan[3])
+	}
+}
+
+func TestRedisClientReconnects(t *testing.T) {
+	var mutex sync.Mutex
+	pings := 0
+	server := newFakeRedis(t, func(args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		pings++
+		// Drop the connection on the second command, as a restarting
+		// server would.
+		if pings == 2 {
+			return ""
+		}
+		return "+PONG\r\n"
+	})
+
+	client := newRedisClient(server.addr(), "", 0)
+	defer client.Close()
+
+	if _, err := client.Do("PING"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do("PING"); err == nil {
+		t.Fatal("Do succeeded on a dropped connection")
+	}
+	if reply, err := client.Do("PING"); err != nil || reply != "PONG" {
+		t.Fatalf("Do after reconnect = %v, %v", reply, err)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    any
+		wantErr string
+	}{
+		{"simple string", "+OK\r\n", "OK", ""},
+		{"integer", ":-42\r\n", int64(-42), ""},
+		{"bulk string", "$5\r\nhello\r\n", "hello", ""},
+		{"empty bulk string", "$0\r\n\r\n", "", ""},
+		{"nil bulk string", "$-1\r\n", nil, ""},
+		{"nil array", "*-1\r\n", nil, ""},
+		{"array", "*3\r\n:1\r\n$1\r\na\r\n$-1\r\n", []any{int64(1), "a", nil}, ""},
+		{"error", "-ERR wrong type\r\n", nil, "redis: ERR wrong type"},
+		{"missing carriage return", "+OK\n", nil, "malformed redis reply"},
+		{"unknown type", "?x\r\n", nil, "unsupported redis reply type"},
+		{"truncated bulk string", "$5\r\nhel", nil, "failed to read redis reply"},
+		{"bad integer", ":abc\r\n", nil, "invalid syntax"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if items, ok := tt.want.([]any); ok {
+				if !slices.Equal(got.([]any), items) {
+					t.Errorf("readReply = %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("readReply = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplyKeepsErrorsInsideArrays(t *testing.T) {
+	got, err := readReply(bufio.NewReader(strings.NewReader("*2\r\n-ERR first\r\n:2\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := got.([]any)
+	var replyErr redisError
+	if len(items) != 2 || !errors.As(items[0].(error), &replyErr) || items[1] != int64(2) {
+		t.Errorf("readReply = %#v, want an error element and 2", got)
+	}
+}
+
+func TestLimiterFallsBackWhenRedisFails(t *testing.T) {
+	store, _ := newTestRedisStore(t, replies(map[string]string{"EVAL": "-LOADING Redis is loading the dataset in memory\r\n"}))
+	l, _ := newTestLimiter(Policy{User: Limit{Count: 1, Period: time.Minute}}, LockoutPolicy{}, store)
+
+	if decision := l.Allow(Request{UserID: "u1"}); !decision.Allowed {
+		t.Fatalf("first request = %+v, want allowed by the fallback", decision)
+	}
+	if decision := l.Allow(Request{UserID: "u1"}); decision.Allowed {
+		t.Fatalf("second request = %+v, want limited by the fallback", decision)
+	}
+}
@@ -0,0 +1,238 @@
+package ratelimit
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Store interface {
+	Allow(now time.Time, userID string, checks []BucketCheck) (Decision, error)
+	RecordFailure(now time.Time, userID string, policy LockoutPolicy) (Lockout, error)
+	ClearLockout(now time.Time, userID string) (bool, error)
+	Reset(userID string) error
+	Snapshot(now time.Time) ([]BucketState, error)
+	Size() (int, error)
+	Cleanup(now time.Time, policy LockoutPolicy) error
+	Close() error
+}
+
+type BucketState struct {
+	Key        string
+	Tokens     float64
+	Burst      int
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+type lockoutState struct {
+	failures    []time.Time
+	level       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type MemoryStore struct {
+	buckets  map[string]*bucket
+	lockouts map[string]*lockoutState
+	mutex    sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		lockouts: make(map[string]*lockoutState),
+	}
+}
+
+func (m *MemoryStore) Allow(now time.Time, userID string, checks []BucketCheck) (Decision, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if state, ok := m.lockouts[userID]; ok && state.lockedUntil.After(now) {
+		return Decision{Scope: ScopeLockout, RetryAfter: state.lockedUntil.Sub(now)}, nil
+	}
+
+	buckets := make([]*bucket, len(checks))
+	for idx, c := range checks {
+		b := m.refill(c.Key, c.Limit, now)
+		if b.tokens < 1 {
+			return Decision{
+				Scope:      c.Scope,
+				RetryAfter: retryAfter(b),
+			}, nil
+		}
+		buckets[idx] = b
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return Decision{Allowed: true}, nil
+}
+
+func (m *MemoryStore) lockedUntil(now time.Time, userID string) (time.Time, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state, ok := m.lockouts[userID]
+	if !ok || !state.lockedUntil.After(now) {
+		return time.Time{}, false
+	}
+	return state.lockedUntil, true
+}
+
+func (m *MemoryStore) RecordFailure(now time.Time, userID string, policy LockoutPolicy) (Lockout, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state, ok := m.lockouts[userID]
+	if !ok {
+		state = &lockoutState{}
+		m.lockouts[userID] = state
+	}
+
+	if policy.ResetAfter > 0 && !state.lastFailure.IsZero() && now.Sub(state.lastFailure) > policy.ResetAfter {
+		state.level = 0
+	}
+	state.lastFailure = now
+
+	recent := state.failures[:0]
+	for _, failure := range state.failures {
+		if policy.Window <= 0 || now.Sub(failure) < policy.Window {
+			recent = append(recent, failure)
+		}
+	}
+	state.failures = append(recent, now)
+
+	failures := len(state.failures)
+	if failures < policy.Threshold {
+		return Lockout{Failures: failures, Level: state.level}, nil
+	}
+
+	state.level++
+	duration := lockoutDuration(policy, state.level)
+	state.lockedUntil = now.Add(duration)
+	state.failures = nil
+
+	return Lockout{
+		Triggered: true,
+		Failures:  failures,
+		Level:     state.level,
+		Duration:  duration,
+		Until:     state.lockedUntil,
+	}, nil
+}
+
+func (m *MemoryStore) ClearLockout(now time.Time, userID string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state, ok := m.lockouts[userID]
+	if !ok {
+		return false, nil
+	}
+	delete(m.lockouts, userID)
+	return state.lockedUntil.After(now), nil
+}
+
+func (m *MemoryStore) Reset(userID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	prefix := userKey(userID)
+	for key := range m.buckets {
+		if key == prefix || strings.HasPrefix(key, prefix+":") {
+			delete(m.buckets, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Snapshot(now time.Time) ([]BucketState, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var states []BucketState
+	for key, b := range m.buckets {
+		b = m.refill(key, b.limit, now)
+		if b.tokens >= float64(b.limit.Count) {
+			continue
+		}
+		states = append(states, BucketState{
+			Key:        key,
+			Tokens:     b.tokens,
+			Burst:      b.limit.Count,
+			RetryAfter: retryAfter(b),
+		})
+	}
+	return states, nil
+}
+
+func (m *MemoryStore) Size() (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return len(m.buckets), nil
+}
+
+func (m *MemoryStore) Cleanup(now time.Time, policy LockoutPolicy) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, b := range m.buckets {
+		if m.refill(key, b.limit, now).tokens >= float64(b.limit.Count) {
+			delete(m.buckets, key)
+		}
+	}
+
+	for userID, state := range m.lockouts {
+		if state.lockedUntil.After(now) {
+			continue
+		}
+		idle := now.Sub(state.lastFailure)
+		if idle > policy.Window && (policy.ResetAfter <= 0 || idle > policy.ResetAfter) {
+			delete(m.lockouts, userID)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *MemoryStore) refill(key string, limit Limit, now time.Time) *bucket {
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Count), updated: now, limit: limit}
+		m.buckets[key] = b
+		return b
+	}
+
+	if b.limit != limit {
+		b.tokens = math.Min(b.tokens, float64(limit.Count))
+		b.limit = limit
+	}
+
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Count), b.tokens+elapsed*limit.rate())
+		b.updated = now
+	}
+	return b
+}
+
+func retryAfter(b *bucket) time.Duration {
+	missing := 1 - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / b.limit.rate() * float64(time.Second))
+}
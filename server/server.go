@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/logger"
+)
+
+type CooldownEntry struct {
+	Key               string  `json:"key"`
+	Tokens            float64 `json:"tokens"`
+	Burst             int     `json:"burst"`
+	RetryAfterSeconds float64 `json:"retry_after_seconds"`
+}
+
+type VaultKeys struct {
+	Active  int         `json:"active_version"`
+	Entries map[int]int `json:"entries_by_version"`
+}
+
+type AdminHooks struct {
+	Cooldowns    func() []CooldownEntry
+	ReloadConfig func() error
+	SyncCommands func() error
+	VaultKeys    func() VaultKeys
+	RewrapVault  func() (int, error)
+}
+
+type readinessCheck struct {
+	name string
+	fn   func() error
+}
+
+type Server struct {
+	httpServer *http.Server
+	adminToken string
+	hooks      AdminHooks
+	checks     []readinessCheck
+	mutex      sync.RWMutex
+}
+
+func New(addr, adminToken string, hooks AdminHooks) *Server {
+	s := &Server{
+		adminToken: adminToken,
+		hooks:      hooks,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("GET /admin/cooldowns", s.requireAdmin(s.handleCooldowns))
+	mux.HandleFunc("POST /admin/reload", s.requireAdmin(s.handleReload))
+	mux.HandleFunc("POST /admin/sync-commands", s.requireAdmin(s.handleSyncCommands))
+	mux.HandleFunc("GET /admin/vault/keys", s.requireAdmin(s.handleVaultKeys))
+	mux.HandleFunc("POST /admin/vault/rewrap", s.requireAdmin(s.handleVaultRewrap))
+
+	s.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+func (s *Server) AddReadinessCheck(name string, fn func() error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.checks = append(s.checks, readinessCheck{name: name, fn: fn})
+}
+
+func (s *Server) Start() {
+	go func() {
+		logger.Info("HTTP server listening", "addr", s.httpServer.Addr)
+		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP server failed", "addr", s.httpServer.Addr, "error", err)
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	s.mutex.RLock()
+	checks := append([]readinessCheck(nil), s.checks...)
+	s.mutex.RUnlock()
+
+	status := http.StatusOK
+	results := make(map[string]string, len(checks))
+	for _, check := range checks {
+		if err := check.fn(); err != nil {
+			status = http.StatusServiceUnavailable
+			results[check.name] = err.Error()
+			continue
+		}
+		results[check.name] = "ok"
+	}
+
+	overall := "ok"
+	if status != http.StatusOK {
+		overall = "unavailable"
+	}
+	writeJSON(w, status, map[string]any{"status": overall, "checks": results})
+}
+
+func (s *Server) handleCooldowns(w http.ResponseWriter, _ *http.Request) {
+	if s.hooks.Cooldowns == nil {
+		writeError(w, http.StatusNotImplemented, "cooldown listing is not available")
+		return
+	}
+
+	entries := s.hooks.Cooldowns()
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Key < entries[b].Key
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"cooldowns": entries})
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, _ *http.Request) {
+	s.runHook(w, "reload", s.hooks.ReloadConfig)
+}
+
+func (s *Server) handleSyncCommands(w http.ResponseWriter, _ *http.Request) {
+	s.runHook(w, "sync-commands", s.hooks.SyncCommands)
+}
+
+func (s *Server) handleVaultKeys(w http.ResponseWriter, _ *http.Request) {
+	if s.hooks.VaultKeys == nil {
+		writeError(w, http.StatusNotImplemented, "the vault is not enabled")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.hooks.VaultKeys())
+}
+
+func (s *Server) handleVaultRewrap(w http.ResponseWriter, _ *http.Request) {
+	if s.hooks.RewrapVault == nil || s.hooks.VaultKeys == nil {
+		writeError(w, http.StatusNotImplemented, "the vault is not enabled")
+		return
+	}
+
+	logger.Info("Admin API action requested", "action", "vault-rewrap")
+	rewrapped, err := s.hooks.RewrapVault()
+	if err != nil {
+		logger.Error("Admin API action failed", "action", "vault-rewrap", "error", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Info("Vault data keys re-wrapped", "rewrapped", rewrapped)
+	keys := s.hooks.VaultKeys()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":             "ok",
+		"rewrapped":          rewrapped,
+		"active_version":     keys.Active,
+		"entries_by_version": keys.Entries,
+	})
+}
+
+func (s *Server) runHook(w http.ResponseWriter, action string, hook func() error) {
+	if hook == nil {
+		writeError(w, http.StatusNotImplemented, action+" is not available")
+		return
+	}
+
+	logger.Info("Admin API action requested", "action", action)
+	if err := hook(); err != nil {
+		logger.Error("Admin API action failed", "action", action, "error", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			writeError(w, http.StatusNotFound, "admin API is disabled")
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			logger.Warn("Unauthorized admin API request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("Failed to write HTTP response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
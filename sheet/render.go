@@ -0,0 +1,130 @@
+package sheet
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+)
+
+const pngScale = 2.0
+
+func (s Sheet) PNG() ([]byte, error) {
+	l, err := s.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, int(pageWidth*pngScale), int(pageHeight*pngScale)))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	grey := color.Gray{Y: 0xAA}
+	for _, y := range l.rules {
+		fillRect(img, int(margin*pngScale), int(y*pngScale), int((pageWidth-2*margin)*pngScale), 2, grey)
+	}
+
+	module := int(qrSize * pngScale / float64(len(l.qr)))
+	offset := (int(qrSize*pngScale) - module*len(l.qr)) / 2
+	for row := range l.qr {
+		for col, dark := range l.qr[row] {
+			if dark {
+				fillRect(img, int(l.qrX*pngScale)+offset+col*module, int(l.qrY*pngScale)+offset+row*module, module, module, color.Black)
+			}
+		}
+	}
+
+	for _, item := range l.texts {
+		scale := max(1, int(math.Round(item.size*pngScale*0.7/glyphHeight)))
+		text := item.text
+		if item.style == fontBold {
+			drawText(img, int(item.x*pngScale)+1, int(item.y*pngScale), text, scale, color.Black)
+		}
+		drawText(img, int(item.x*pngScale), int(item.y*pngScale), text, scale, color.Black)
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (s Sheet) PDF() ([]byte, error) {
+	l, err := s.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	var content strings.Builder
+	content.WriteString("0.67 G 1 w\n")
+	for _, y := range l.rules {
+		fmt.Fprintf(&content, "%.2f %.2f m %.2f %.2f l S\n", margin, pageHeight-y, pageWidth-margin, pageHeight-y)
+	}
+
+	module := qrSize / float64(len(l.qr))
+	content.WriteString("0 g\n")
+	for row := range l.qr {
+		for col, dark := range l.qr[row] {
+			if dark {
+				fmt.Fprintf(&content, "%.3f %.3f %.3f %.3f re\n",
+					l.qrX+float64(col)*module, pageHeight-l.qrY-float64(row+1)*module, module, module)
+			}
+		}
+	}
+	content.WriteString("f\n")
+
+	fonts := map[fontStyle]string{fontRegular: "F1", fontBold: "F2", fontMono: "F3"}
+	for _, item := range l.texts {
+		baseline := pageHeight - item.y - item.size*0.7
+		fmt.Fprintf(&content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", fonts[item.style], item.size, item.x, baseline, pdfString(item.text))
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Contents 4 0 R /Resources << /Font << /F1 5 0 R /F2 6 0 R /F3 7 0 R >> >> >>", pageWidth, pageHeight),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Title (2FA Recovery Sheet) /Producer (Discord 2FA Bot) >>",
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for idx, object := range objects {
+		offsets[idx] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", idx+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+	return out.Bytes(), nil
+}
+
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= ' ' && r <= '~':
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
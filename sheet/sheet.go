@@ -0,0 +1,206 @@
+package sheet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/totp"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 50.0
+	qrSize     = 160.0
+)
+
+type fontStyle int
+
+const (
+	fontRegular fontStyle = iota
+	fontBold
+	fontMono
+)
+
+type textItem struct {
+	x, y  float64
+	size  float64
+	style fontStyle
+	text  string
+}
+
+type layout struct {
+	texts []textItem
+	qr    [][]bool
+	qrX   float64
+	qrY   float64
+	rules []float64
+}
+
+type Sheet struct {
+	Key         *totp.Key
+	BackupCodes []string
+	Created     time.Time
+	Generator   string
+}
+
+func (s Sheet) Checksum() string {
+	sum := sha256.New()
+	sum.Write([]byte(totp.NormalizeSecret(s.Key.Secret)))
+	for _, code := range s.BackupCodes {
+		sum.Write([]byte{'\n'})
+		sum.Write([]byte(totp.NormalizeBackupCode(code)))
+	}
+	digest := strings.ToUpper(hex.EncodeToString(sum.Sum(nil))[:16])
+	return strings.Join(chunk(digest, 4), "-")
+}
+
+func chunk(value string, size int) []string {
+	var groups []string
+	for len(value) > size {
+		groups = append(groups, value[:size])
+		value = value[size:]
+	}
+	if value != "" {
+		groups = append(groups, value)
+	}
+	return groups
+}
+
+func (s Sheet) layout() (*layout, error) {
+	code, err := qrcode.New(s.Key.URI(), qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate QR code: %w", err)
+	}
+
+	l := &layout{
+		qr:  code.Bitmap(),
+		qrX: pageWidth - margin - qrSize,
+		qrY: margin + 40,
+	}
+	add := func(x, y, size float64, style fontStyle, text string) {
+		l.texts = append(l.texts, textItem{x: x, y: y, size: size, style: style, text: text})
+	}
+
+	add(margin, margin, 22, fontBold, "2FA Recovery Sheet")
+	add(margin, margin+30, 9, fontRegular, "Keep this page offline and locked away. Anyone holding it can generate your codes.")
+
+	created := s.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	details := []struct{ label, value string }{
+		{"Issuer", s.Key.Issuer},
+		{"Account", s.Key.Account},
+		{"Type", keyDescription(s.Key)},
+		{"Created", created.UTC().Format("2006-01-02 15:04 UTC")},
+	}
+	y := margin + 60
+	for _, detail := range details {
+		value := detail.value
+		if value == "" {
+			value = "-"
+		}
+		add(margin, y, 11, fontBold, detail.label)
+		add(margin+70, y, 11, fontRegular, truncate(value, 38))
+		y += 22
+	}
+
+	y = max(y, l.qrY+qrSize) + 20
+	l.rules = append(l.rules, y)
+	y += 20
+
+	add(margin, y, 12, fontBold, "Secret key (Base32)")
+	y += 22
+	for _, line := range wrapGroups(chunk(totp.NormalizeSecret(s.Key.Secret), 4), 6) {
+		add(margin, y, 16, fontMono, line)
+		y += 24
+	}
+
+	if len(s.BackupCodes) > 0 {
+		y += 10
+		l.rules = append(l.rules, y)
+		y += 20
+		add(margin, y, 12, fontBold, "Backup codes")
+		y += 24
+		y = s.layoutCodes(add, y)
+	}
+
+	y += 10
+	l.rules = append(l.rules, y)
+	y += 20
+	add(margin, y, 12, fontBold, "Checksum")
+	add(margin+90, y, 12, fontMono, s.Checksum())
+	y += 18
+	add(margin, y, 8, fontRegular, "First 64 bits of SHA-256 over the secret and backup codes.")
+
+	generator := s.Generator
+	if generator == "" {
+		generator = "Discord 2FA Bot"
+	}
+	add(margin, pageHeight-margin, 8, fontRegular, fmt.Sprintf("Generated by %s. Tick each backup code as it is used.", generator))
+	return l, nil
+}
+
+func (s Sheet) layoutCodes(add func(x, y, size float64, style fontStyle, text string), y float64) float64 {
+	longest := 0
+	for _, code := range s.BackupCodes {
+		longest = max(longest, len(code))
+	}
+
+	columns := 1
+	switch {
+	case longest <= 14 && len(s.BackupCodes) > 10:
+		columns = 3
+	case longest <= 26:
+		columns = 2
+	}
+	rows := (len(s.BackupCodes) + columns - 1) / columns
+
+	size, spacing := 12.0, 20.0
+	available := pageHeight - margin - 90 - y
+	if float64(rows)*spacing > available {
+		spacing = max(available/float64(rows), 10)
+		size = min(size, spacing*0.7)
+	}
+
+	width := (pageWidth - 2*margin) / float64(columns)
+	for idx, code := range s.BackupCodes {
+		column, row := idx/rows, idx%rows
+		text := fmt.Sprintf("[ ] %2d. %s", idx+1, code)
+		add(margin+float64(column)*width, y+float64(row)*spacing, size, fontMono, text)
+	}
+	return y + float64(rows)*spacing
+}
+
+func keyDescription(key *totp.Key) string {
+	if key.Type == "hotp" {
+		return fmt.Sprintf("HOTP, %s, %d digits, counter %d", key.Algorithm, key.Digits, key.Counter)
+	}
+	return fmt.Sprintf("TOTP, %s, %d digits, %ds period", key.Algorithm, key.Digits, key.Period)
+}
+
+func wrapGroups(groups []string, perLine int) []string {
+	var lines []string
+	for len(groups) > perLine {
+		lines = append(lines, strings.Join(groups[:perLine], " "))
+		groups = groups[perLine:]
+	}
+	if len(groups) > 0 {
+		lines = append(lines, strings.Join(groups, " "))
+	}
+	return lines
+}
+
+func truncate(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit-3]) + "..."
+}
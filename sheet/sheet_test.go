@@ -0,0 +1,221 @@
+package sheet
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/totp"
+)
+
+func testSheet(codes ...string) Sheet {
+	return Sheet{
+		Key:         totp.NewKey(`Acme (EU) \ Ops`, "alice@example.com", "JBSWY3DPEHPK3PXP"),
+		BackupCodes: codes,
+		Created:     time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC),
+	}
+}
+
+// unescapePDFString reverses pdfString for the escapes it produces.
+func unescapePDFString(t *testing.T, escaped string) string {
+	t.Helper()
+
+	var b strings.Builder
+	for idx := 0; idx < len(escaped); idx++ {
+		if escaped[idx] != '\\' {
+			b.WriteByte(escaped[idx])
+			continue
+		}
+		idx++
+		if idx == len(escaped) {
+			t.Fatalf("dangling backslash in %q", escaped)
+		}
+		switch next := escaped[idx]; {
+		case next == '\\' || next == '(' || next == ')':
+			b.WriteByte(next)
+		case next >= '0' && next <= '7' && idx+2 < len(escaped):
+			code, err := strconv.ParseUint(escaped[idx:idx+3], 8, 8)
+			if err != nil {
+				t.Fatalf("bad octal escape in %q", escaped)
+			}
+			b.WriteRune(rune(code))
+			idx += 2
+		default:
+			t.Fatalf("unexpected escape \\%c in %q", next, escaped)
+		}
+	}
+	return b.String()
+}
+
+func TestPDFString(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "Secret key (Base32)", "Secret key (Base32)"},
+		{"backslash", `C:\keys\`, `C:\keys\`},
+		{"unbalanced parentheses", "a) (b ((c", "a) (b ((c"},
+		{"latin-1", "Société Générale", "Société Générale"},
+		{"outside latin-1", "Acme ✓ 東京", "Acme ? ??"},
+		{"control characters", "a\nb\tc", "a?b?c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escaped := pdfString(tt.text)
+			// An unescaped parenthesis or a trailing backslash would end or
+			// break the literal string early.
+			if strings.Count(escaped, "(") != strings.Count(escaped, `\(`) || strings.Count(escaped, ")") != strings.Count(escaped, `\)`) {
+				t.Errorf("pdfString(%q) = %q leaves a parenthesis unescaped", tt.text, escaped)
+			}
+			if got := unescapePDFString(t, escaped); got != tt.want {
+				t.Errorf("round trip of %q = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFStructure(t *testing.T) {
+	pdf, err := testSheet("ABCD-EFGH", "JKLM-NPQR").PDF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("PDF is missing its header or trailer")
+	}
+
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if match == nil {
+		t.Fatal("PDF has no startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	lines := strings.Split(string(pdf[xref:]), "\n")
+	var first, count int
+	if _, err := fmt.Sscanf(lines[1], "%d %d", &first, &count); err != nil || first != 0 {
+		t.Fatalf("xref subsection header = %q", lines[1])
+	}
+	if lines[2] != "0000000000 65535 f " {
+		t.Errorf("xref entry 0 = %q, want the free list head", lines[2])
+	}
+	for number := 1; number < count; number++ {
+		entry := lines[2+number]
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Fatalf("xref entry %d = %q is not 20 bytes in use", number, entry)
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		if want := fmt.Sprintf("%d 0 obj\n", number); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q, want %q", number, pdf[offset:min(offset+12, len(pdf))], want)
+		}
+	}
+	if !strings.Contains(string(pdf), fmt.Sprintf("/Size %d ", count)) {
+		t.Errorf("trailer /Size does not match the %d xref entries", count)
+	}
+
+	stream := regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*?)endstream`).FindSubmatch(pdf)
+	if stream == nil {
+		t.Fatal("PDF has no content stream")
+	}
+	if length, _ := strconv.Atoi(string(stream[1])); length != len(stream[2]) {
+		t.Errorf("/Length = %d, stream has %d bytes", length, len(stream[2]))
+	}
+
+	var texts []string
+	for _, shown := range regexp.MustCompile(`\(((?:\\.|[^\\()])*)\) Tj`).FindAllSubmatch(stream[2], -1) {
+		texts = append(texts, unescapePDFString(t, string(shown[1])))
+	}
+	content := strings.Join(texts, "\n")
+	for _, want := range []string{`Acme (EU) \ Ops`, "alice@example.com", "JBSW Y3DP EHPK 3PXP", "ABCD-EFGH", testSheet("ABCD-EFGH", "JKLM-NPQR").Checksum()} {
+		if !strings.Contains(content, want) {
+			t.Errorf("PDF text is missing %q", want)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	data, err := testSheet("ABCD-EFGH").PNG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("output is not a PNG: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != int(pageWidth*pngScale) || bounds.Dy() != int(pageHeight*pngScale) {
+		t.Fatalf("PNG is %v, want %vx%v", bounds, pageWidth*pngScale, pageHeight*pngScale)
+	}
+
+	white := color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != white {
+		t.Errorf("page corner is %v, want white", got)
+	}
+	dark := 0
+	qrLeft, qrTop := int((pageWidth-margin-qrSize)*pngScale), int((margin+40)*pngScale)
+	for y := qrTop; y < qrTop+int(qrSize*pngScale); y++ {
+		for x := qrLeft; x < qrLeft+int(qrSize*pngScale); x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r == 0 {
+				dark++
+			}
+		}
+	}
+	if dark == 0 {
+		t.Error("QR code area is blank")
+	}
+
+	other, err := testSheet("ZZZZ-ZZZZ").PNG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(data, other) {
+		t.Error("different backup codes render the same PNG")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	base := testSheet("ABCD-EFGH", "JKLM-NPQR").Checksum()
+	if !regexp.MustCompile(`^[0-9A-F]{4}(-[0-9A-F]{4}){3}$`).MatchString(base) {
+		t.Fatalf("Checksum = %q, want four groups of four hex digits", base)
+	}
+
+	normalized := testSheet("abcd efgh", " jklmnpqr")
+	normalized.Key.Secret = "jbsw y3dp-ehpk_3pxp"
+	if got := normalized.Checksum(); got != base {
+		t.Errorf("Checksum of re-typed sheet = %s, want %s", got, base)
+	}
+	if got := testSheet("ABCD-EFGH").Checksum(); got == base {
+		t.Error("Checksum ignores a missing backup code")
+	}
+	if got := testSheet("JKLM-NPQR", "ABCD-EFGH").Checksum(); got == base {
+		t.Error("Checksum ignores backup code order")
+	}
+}
+
+func TestBackupCodesStayAboveFooter(t *testing.T) {
+	for _, count := range []int{1, 10, 16, 40, 100} {
+		codes := make([]string, count)
+		for idx := range codes {
+			codes[idx] = fmt.Sprintf("CODE-%04d", idx)
+		}
+		l, err := testSheet(codes...).layout()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		footer := l.texts[len(l.texts)-1]
+		for _, item := range l.texts[:len(l.texts)-1] {
+			if item.y+item.size > footer.y {
+				t.Errorf("%d codes: %q at y %.1f overlaps the footer at %.1f", count, item.text, item.y, footer.y)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package totp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+const minBackupCodeBits = 40
+
+var BackupAlphabets = map[string]string{
+	"alphanumeric": "23456789ABCDEFGHJKLMNPQRSTUVWXYZ",
+	"numeric":      "0123456789",
+	"hex":          "0123456789ABCDEF",
+}
+
+type BackupFormat struct {
+	Count       int
+	Groups      int
+	GroupLength int
+	Alphabet    string
+}
+
+func DefaultBackupFormat() BackupFormat {
+	return BackupFormat{
+		Count:       10,
+		Groups:      2,
+		GroupLength: 5,
+		Alphabet:    "alphanumeric",
+	}
+}
+
+func (f BackupFormat) Validate() error {
+	alphabet, ok := BackupAlphabets[f.Alphabet]
+	if !ok {
+		names := make([]string, 0, len(BackupAlphabets))
+		for name := range BackupAlphabets {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("unknown alphabet %q (use %s)", f.Alphabet, strings.Join(names, ", "))
+	}
+	if f.Count < 1 || f.Count > 50 {
+		return fmt.Errorf("count must be between 1 and 50")
+	}
+	if f.Groups < 1 || f.Groups > 8 {
+		return fmt.Errorf("groups must be between 1 and 8")
+	}
+	if f.GroupLength < 2 || f.GroupLength > 12 {
+		return fmt.Errorf("group length must be between 2 and 12")
+	}
+	bits := float64(f.Groups*f.GroupLength) * math.Log2(float64(len(alphabet)))
+	if bits < minBackupCodeBits {
+		return fmt.Errorf("codes would only carry %.0f bits of entropy; use more or longer groups (at least %d bits)", bits, minBackupCodeBits)
+	}
+	return nil
+}
+
+func GenerateBackupCodes(format BackupFormat) ([]string, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+	alphabet := BackupAlphabets[format.Alphabet]
+	size := big.NewInt(int64(len(alphabet)))
+
+	codes := make([]string, 0, format.Count)
+	for len(codes) < format.Count {
+		groups := make([]string, format.Groups)
+		for g := range groups {
+			group := make([]byte, format.GroupLength)
+			for c := range group {
+				n, err := rand.Int(rand.Reader, size)
+				if err != nil {
+					return nil, err
+				}
+				group[c] = alphabet[n.Int64()]
+			}
+			groups[g] = string(group)
+		}
+		code := strings.Join(groups, "-")
+		if !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+func NormalizeBackupCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '\t', '\n':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
@@ -3,6 +3,7 @@ package totp
 import (
 	"crypto/rand"
 	"encoding/base32"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -11,7 +12,15 @@ import (
 
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
-	"github.com/skip2/go-qrcode"
+)
+
+var (
+	ErrEmptySecret    = errors.New("secret key cannot be empty")
+	ErrSecretTooShort = errors.New("secret key too short (minimum 16 characters)")
+	ErrSecretTooLong  = errors.New("secret key too long (maximum 128 characters)")
+	ErrInvalidBase32  = errors.New("invalid Base32 format (only A-Z and 2-7 allowed)")
+	ErrInvalidPadding = errors.New("invalid Base32 padding")
+	ErrDecodeFailed   = errors.New("failed to decode Base32 secret")
 )
 
 type Generator struct{}
@@ -21,8 +30,6 @@ type Result struct {
 	RemainingTime int
 	ValidUntil    time.Time
 	Secret        string
-	QRCode        []byte
-	URI           string
 }
 
 type SecretResult struct {
@@ -35,7 +42,7 @@ func New() *Generator {
 	return &Generator{}
 }
 
-func (t *Generator) GenerateSecret(issuer, accountName string) (*SecretResult, error) {
+func (t *Generator) GenerateSecret(issuer, accountName string, qr QROptions) (*SecretResult, error) {
 	if issuer == "" {
 		issuer = "Discord 2FA Bot"
 	}
@@ -51,17 +58,17 @@ func (t *Generator) GenerateSecret(issuer, accountName string) (*SecretResult, e
 		Period:      30,
 	})
 	if err != nil {
-		logger.Error("Failed to generate TOTP key:", err)
+		logger.Error("Failed to generate TOTP key", "error", err)
 		return nil, fmt.Errorf("failed to generate secret key")
 	}
 
-	qrCode, err := qrcode.Encode(key.URL(), qrcode.Medium, 256)
+	qrCode, err := RenderQR(key.URL(), qr)
 	if err != nil {
-		logger.Error("Failed to generate QR code:", err)
+		logger.Error("Failed to generate QR code", "error", err)
 		return nil, fmt.Errorf("failed to generate QR code")
 	}
 
-	logger.Info("Generated new TOTP secret")
+	logger.Info("Generated new TOTP secret", "issuer", issuer)
 
 	return &SecretResult{
 		Secret: key.Secret(),
@@ -72,29 +79,29 @@ func (t *Generator) GenerateSecret(issuer, accountName string) (*SecretResult, e
 
 func (t *Generator) ValidateSecret(secret string) error {
 	if secret == "" {
-		return fmt.Errorf("secret key cannot be empty")
+		return ErrEmptySecret
 	}
 
 	secret = t.normalizeSecret(secret)
 
 	if len(secret) < 16 {
-		return fmt.Errorf("secret key too short (minimum 16 characters)")
+		return ErrSecretTooShort
 	}
 	if len(secret) > 128 {
-		return fmt.Errorf("secret key too long (maximum 128 characters)")
+		return ErrSecretTooLong
 	}
 
 	if !t.isValidBase32(secret) {
-		return fmt.Errorf("invalid Base32 format (only A-Z and 2-7 allowed)")
+		return ErrInvalidBase32
 	}
 
 	if strings.Count(secret, "=") > 6 {
-		return fmt.Errorf("invalid Base32 padding")
+		return ErrInvalidPadding
 	}
 
 	_, err := base32.StdEncoding.DecodeString(secret)
 	if err != nil {
-		return fmt.Errorf("failed to decode Base32 secret")
+		return ErrDecodeFailed
 	}
 
 	return nil
@@ -102,7 +109,7 @@ func (t *Generator) ValidateSecret(secret string) error {
 
 func (t *Generator) GenerateCode(secret string) (*Result, error) {
 	if err := t.ValidateSecret(secret); err != nil {
-		logger.Warn("Invalid secret validation:", err)
+		logger.Warn("Invalid secret validation", "error", err)
 		return nil, err
 	}
 
@@ -111,7 +118,7 @@ func (t *Generator) GenerateCode(secret string) (*Result, error) {
 	now := time.Now()
 	code, err := totp.GenerateCode(secret, now)
 	if err != nil {
-		logger.Error("Failed to generate TOTP code:", err)
+		logger.Error("Failed to generate TOTP code", "error", err)
 		return nil, fmt.Errorf("failed to generate verification code")
 	}
 
@@ -122,26 +129,63 @@ func (t *Generator) GenerateCode(secret string) (*Result, error) {
 
 	validUntil := now.Add(time.Duration(remainingSeconds) * time.Second)
 
-	uri := fmt.Sprintf("otpauth://totp/Discord-2FA-Bot:User?secret=%s&issuer=Discord-2FA-Bot", secret)
-	qrCode, err := qrcode.Encode(uri, qrcode.Medium, 256)
-	if err != nil {
-		logger.Warn("Failed to generate QR code:", err)
-		qrCode = nil
-	}
-
-	logger.Debug("Generated TOTP code:", code, "Valid for:", remainingSeconds, "seconds")
+	logger.Debug("Generated TOTP code", "code", logger.Sensitive(code), "remaining_seconds", remainingSeconds)
 
 	return &Result{
 		Code:          code,
 		RemainingTime: remainingSeconds,
 		ValidUntil:    validUntil,
 		Secret:        secret,
-		QRCode:        qrCode,
-		URI:           uri,
 	}, nil
 }
 
+func (t *Generator) Verify(secret, code string) (bool, error) {
+	if err := t.ValidateSecret(secret); err != nil {
+		return false, err
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != 6 {
+		return false, nil
+	}
+
+	valid, err := totp.ValidateCustom(code, t.normalizeSecret(secret), time.Now(), totp.ValidateOpts{
+		Period:    30,
+		Skew:      1,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		logger.Warn("TOTP verification failed", "error", err)
+		return false, nil
+	}
+	return valid, nil
+}
+
+func ValidationReason(err error) string {
+	switch {
+	case errors.Is(err, ErrEmptySecret):
+		return "empty"
+	case errors.Is(err, ErrSecretTooShort):
+		return "too_short"
+	case errors.Is(err, ErrSecretTooLong):
+		return "too_long"
+	case errors.Is(err, ErrInvalidBase32):
+		return "invalid_base32"
+	case errors.Is(err, ErrInvalidPadding):
+		return "invalid_padding"
+	case errors.Is(err, ErrDecodeFailed):
+		return "decode_failed"
+	default:
+		return ""
+	}
+}
+
 func (t *Generator) normalizeSecret(secret string) string {
+	return NormalizeSecret(secret)
+}
+
+func NormalizeSecret(secret string) string {
 	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
 	secret = strings.ReplaceAll(secret, "-", "")
 	secret = strings.ReplaceAll(secret, "_", "")
@@ -0,0 +1,150 @@
+package totp
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidMigration = errors.New("invalid otpauth-migration URI")
+
+func IsMigrationURI(raw string) bool {
+	return strings.HasPrefix(strings.TrimSpace(raw), "otpauth-migration://")
+}
+
+func ParseMigrationURI(raw string) ([]*Key, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Scheme != "otpauth-migration" {
+		return nil, ErrInvalidMigration
+	}
+
+	data := strings.ReplaceAll(u.Query().Get("data"), " ", "+")
+	payload, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		if payload, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "=")); err != nil {
+			return nil, fmt.Errorf("%w: data is not base64", ErrInvalidMigration)
+		}
+	}
+
+	var keys []*Key
+	err = readProtoFields(payload, func(field int, value []byte, _ uint64) error {
+		if field != 1 || value == nil {
+			return nil
+		}
+		key, err := parseMigrationParameters(value)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no entries", ErrInvalidMigration)
+	}
+	return keys, nil
+}
+
+func parseMigrationParameters(data []byte) (*Key, error) {
+	key := NewKey("", "", "")
+	var secret []byte
+
+	err := readProtoFields(data, func(field int, value []byte, number uint64) error {
+		switch field {
+		case 1:
+			secret = value
+		case 2:
+			key.Account = string(value)
+		case 3:
+			key.Issuer = string(value)
+		case 4:
+			key.Algorithm = map[uint64]string{0: "SHA1", 1: "SHA1", 2: "SHA256", 3: "SHA512", 4: "MD5"}[number]
+		case 5:
+			key.Digits = map[uint64]int{0: 6, 1: 6, 2: 8}[number]
+		case 6:
+			key.Type = map[uint64]string{0: "totp", 1: "hotp", 2: "totp"}[number]
+		case 7:
+			key.Counter = number
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(secret) == 0 || key.Algorithm == "" || key.Digits == 0 || key.Type == "" {
+		return nil, fmt.Errorf("%w: unsupported entry %q", ErrInvalidMigration, key.Account)
+	}
+	key.Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+
+	if issuer, account, ok := strings.Cut(key.Account, ":"); ok && (key.Issuer == "" || key.Issuer == issuer) {
+		key.Issuer, key.Account = issuer, strings.TrimSpace(account)
+	}
+	return key, nil
+}
+
+func readProtoFields(data []byte, visit func(field int, value []byte, number uint64) error) error {
+	for len(data) > 0 {
+		tag, n := readVarint(data)
+		if n == 0 {
+			return fmt.Errorf("%w: truncated field tag", ErrInvalidMigration)
+		}
+		data = data[n:]
+
+		field, wireType := int(tag>>3), tag&7
+		switch wireType {
+		case 0:
+			number, n := readVarint(data)
+			if n == 0 {
+				return fmt.Errorf("%w: truncated varint", ErrInvalidMigration)
+			}
+			data = data[n:]
+			if err := visit(field, nil, number); err != nil {
+				return err
+			}
+		case 2:
+			length, n := readVarint(data)
+			if n == 0 || uint64(len(data)-n) < length {
+				return fmt.Errorf("%w: truncated field", ErrInvalidMigration)
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+			if err := visit(field, value, 0); err != nil {
+				return err
+			}
+		case 1:
+			if len(data) < 8 {
+				return fmt.Errorf("%w: truncated field", ErrInvalidMigration)
+			}
+			data = data[8:]
+		case 5:
+			if len(data) < 4 {
+				return fmt.Errorf("%w: truncated field", ErrInvalidMigration)
+			}
+			data = data[4:]
+		default:
+			return fmt.Errorf("%w: unsupported wire type %d", ErrInvalidMigration, wireType)
+		}
+	}
+	return nil
+}
+
+func readVarint(data []byte) (uint64, int) {
+	var value uint64
+	for idx := 0; idx < len(data) && idx < 10; idx++ {
+		// The tenth byte only has room for the top bit of a uint64.
+		if idx == 9 && data[idx] > 1 {
+			return 0, 0
+		}
+		value |= uint64(data[idx]&0x7f) << (7 * idx)
+		if data[idx] < 0x80 {
+			return value, idx + 1
+		}
+	}
+	return 0, 0
+}
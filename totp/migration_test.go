@@ -0,0 +1,168 @@
+package totp
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func protoVarint(value uint64) []byte {
+	var out []byte
+	for value >= 0x80 {
+		out = append(out, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(out, byte(value))
+}
+
+func protoBytes(field int, value []byte) []byte {
+	out := protoVarint(uint64(field<<3 | 2))
+	out = append(out, protoVarint(uint64(len(value)))...)
+	return append(out, value...)
+}
+
+func protoNumber(field int, value uint64) []byte {
+	return append(protoVarint(uint64(field<<3)), protoVarint(value)...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+// migrationURI wraps payload the way Google Authenticator exports do.
+func migrationURI(payload []byte) string {
+	return "otpauth-migration://offline?data=" + url.QueryEscape(base64.StdEncoding.EncodeToString(payload))
+}
+
+// helloSecret is "Hello!" followed by 0xDEADBEEF, JBSWY3DPEHPK3PXP in base32.
+var helloSecret = []byte("Hello!\xde\xad\xbe\xef")
+
+func TestParseMigrationURI(t *testing.T) {
+	totpEntry := protoBytes(1, concat(
+		protoBytes(1, helloSecret),
+		protoBytes(2, []byte("Acme:alice@example.com")),
+		protoBytes(3, []byte("Acme")),
+		protoNumber(4, 1),
+		protoNumber(5, 1),
+		protoNumber(6, 2),
+	))
+	hotpEntry := protoBytes(1, concat(
+		protoBytes(1, helloSecret),
+		protoBytes(2, []byte("bob")),
+		protoNumber(4, 2),
+		protoNumber(5, 2),
+		protoNumber(6, 1),
+		protoNumber(7, 5),
+	))
+	entryWith := func(fields ...[]byte) []byte {
+		return protoBytes(1, concat(fields...))
+	}
+
+	tests := []struct {
+		name    string
+		uri     string
+		want    []Key
+		wantErr bool
+	}{
+		{
+			name: "single entry",
+			uri:  migrationURI(totpEntry),
+			want: []Key{{Type: "totp", Issuer: "Acme", Account: "alice@example.com", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30}},
+		},
+		{
+			name: "batch with header fields",
+			uri:  migrationURI(concat(totpEntry, hotpEntry, protoNumber(2, 1), protoNumber(3, 2), protoNumber(4, 0), protoNumber(5, 123456))),
+			want: []Key{
+				{Type: "totp", Issuer: "Acme", Account: "alice@example.com", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30},
+				{Type: "hotp", Account: "bob", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA256", Digits: 8, Period: 30, Counter: 5},
+			},
+		},
+		{
+			name: "unspecified enums use defaults",
+			uri:  migrationURI(entryWith(protoBytes(1, helloSecret), protoBytes(2, []byte("carol")))),
+			want: []Key{{Type: "totp", Account: "carol", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30}},
+		},
+		{
+			name: "unpadded base64 with spaces for plus signs",
+			uri:  "otpauth-migration://offline?data=" + base64.RawStdEncoding.EncodeToString(totpEntry),
+			want: []Key{{Type: "totp", Issuer: "Acme", Account: "alice@example.com", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30}},
+		},
+		{
+			name: "fixed width fields are skipped",
+			uri:  migrationURI(concat(protoVarint(6<<3|1), make([]byte, 8), protoVarint(7<<3|5), make([]byte, 4), totpEntry)),
+			want: []Key{{Type: "totp", Issuer: "Acme", Account: "alice@example.com", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30}},
+		},
+		{name: "wrong scheme", uri: "otpauth://offline?data=" + base64.StdEncoding.EncodeToString(totpEntry), wantErr: true},
+		{name: "data not base64", uri: "otpauth-migration://offline?data=%21%21%21", wantErr: true},
+		{name: "empty batch", uri: migrationURI(protoNumber(2, 1)), wantErr: true},
+		{name: "unknown algorithm", uri: migrationURI(entryWith(protoBytes(1, helloSecret), protoNumber(4, 9))), wantErr: true},
+		{name: "unknown digits", uri: migrationURI(entryWith(protoBytes(1, helloSecret), protoNumber(5, 3))), wantErr: true},
+		{name: "unknown type", uri: migrationURI(entryWith(protoBytes(1, helloSecret), protoNumber(6, 7))), wantErr: true},
+		{name: "missing secret", uri: migrationURI(entryWith(protoBytes(2, []byte("alice")))), wantErr: true},
+		{name: "truncated tag", uri: migrationURI([]byte{0x80}), wantErr: true},
+		{name: "truncated varint", uri: migrationURI([]byte{2 << 3, 0xff}), wantErr: true},
+		{name: "overlong varint", uri: migrationURI(concat([]byte{2 << 3}, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01})), wantErr: true},
+		{name: "varint overflowing 64 bits", uri: migrationURI(concat([]byte{2 << 3}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02})), wantErr: true},
+		{name: "length past the end", uri: migrationURI(concat(protoVarint(1<<3|2), protoVarint(50), []byte("short"))), wantErr: true},
+		{name: "huge length", uri: migrationURI(concat(protoVarint(1<<3|2), protoVarint(1<<63), []byte("short"))), wantErr: true},
+		{name: "truncated fixed64", uri: migrationURI(concat(protoVarint(6<<3|1), make([]byte, 3))), wantErr: true},
+		{name: "truncated fixed32", uri: migrationURI(concat(protoVarint(6<<3|5), make([]byte, 3))), wantErr: true},
+		{name: "group wire type", uri: migrationURI(protoVarint(1<<3 | 3)), wantErr: true},
+		{name: "truncated nested entry", uri: migrationURI(entryWith(protoVarint(1<<3|2), protoVarint(20))), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMigrationURI(tt.uri)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMigration) {
+					t.Fatalf("ParseMigrationURI err = %v, want ErrInvalidMigration", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseMigrationURI returned %d keys, want %d", len(got), len(tt.want))
+			}
+			for idx := range got {
+				if *got[idx] != tt.want[idx] {
+					t.Errorf("key %d = %+v, want %+v", idx, *got[idx], tt.want[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestReadVarint(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		wantValue uint64
+		wantN     int
+	}{
+		{"zero", []byte{0}, 0, 1},
+		{"one byte", []byte{0x7f, 0xff}, 127, 1},
+		{"two bytes", []byte{0xac, 0x02}, 300, 2},
+		{"max uint64", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, 1<<64 - 1, 10},
+		{"empty", nil, 0, 0},
+		{"truncated", []byte{0x80, 0x80}, 0, 0},
+		{"eleven bytes", []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, 0, 0},
+		{"overflow", []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x7f}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, n := readVarint(tt.data)
+			if value != tt.wantValue || n != tt.wantN {
+				t.Errorf("readVarint(%x) = %d, %d; want %d, %d", tt.data, value, n, tt.wantValue, tt.wantN)
+			}
+		})
+	}
+}
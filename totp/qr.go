@@ -0,0 +1,253 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	MinQRSize       = 128
+	MaxQRSize       = 1024
+	MaxLogoBytes    = 2 << 20
+	maxLogoPixels   = 4096
+	logoScale       = 0.22
+	minContrastRate = 3.0
+)
+
+var (
+	ErrLogoTooLarge = errors.New("logo must be at most 2 MiB and 4096x4096 pixels")
+	ErrLowContrast  = errors.New("foreground and background colours do not contrast enough to scan reliably")
+)
+
+var recoveryLevels = map[string]qrcode.RecoveryLevel{
+	"low":     qrcode.Low,
+	"medium":  qrcode.Medium,
+	"high":    qrcode.High,
+	"highest": qrcode.Highest,
+}
+
+type QROptions struct {
+	Size       int
+	Recovery   string
+	Foreground color.RGBA
+	Background color.RGBA
+	Logo       image.Image
+	Format     string
+}
+
+func DefaultQROptions() QROptions {
+	return QROptions{
+		Size:       256,
+		Recovery:   "medium",
+		Foreground: color.RGBA{A: 0xFF},
+		Background: color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+		Format:     "png",
+	}
+}
+
+func (o QROptions) Validate() error {
+	if o.Size < MinQRSize || o.Size > MaxQRSize {
+		return fmt.Errorf("QR size must be between %d and %d pixels", MinQRSize, MaxQRSize)
+	}
+	if _, ok := recoveryLevels[o.Recovery]; !ok {
+		return fmt.Errorf("unknown recovery level %q (use low, medium, high or highest)", o.Recovery)
+	}
+	if o.Format != "png" && o.Format != "svg" {
+		return fmt.Errorf("unknown QR format %q (use png or svg)", o.Format)
+	}
+	if contrast(o.Foreground, o.Background) < minContrastRate {
+		return ErrLowContrast
+	}
+	return nil
+}
+
+func (o QROptions) Extension() string {
+	return "." + o.Format
+}
+
+func (o QROptions) ContentType() string {
+	if o.Format == "svg" {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+func (o QROptions) recoveryLevel() qrcode.RecoveryLevel {
+	level := recoveryLevels[o.Recovery]
+	if o.Logo != nil && level < qrcode.High {
+		level = qrcode.High
+	}
+	return level
+}
+
+func ParseColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q (use #RRGGBB)", value)
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q (use #RRGGBB)", value)
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xFF}, nil
+}
+
+func LoadLogo(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxLogoBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logo: %w", err)
+	}
+	if len(data) > MaxLogoBytes {
+		return nil, ErrLogoTooLarge
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("logo must be a PNG, JPEG or GIF image: %w", err)
+	}
+	if config.Width > maxLogoPixels || config.Height > maxLogoPixels {
+		return nil, ErrLogoTooLarge
+	}
+
+	logo, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo: %w", err)
+	}
+	return logo, nil
+}
+
+func RenderQR(content string, opts QROptions) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(content, opts.recoveryLevel())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate QR code: %w", err)
+	}
+	code.ForegroundColor = opts.Foreground
+	code.BackgroundColor = opts.Background
+
+	if opts.Format == "svg" {
+		return renderSVG(code.Bitmap(), opts)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Size, opts.Size))
+	draw.Draw(img, img.Bounds(), code.Image(opts.Size), image.Point{}, draw.Src)
+	if opts.Logo != nil {
+		drawLogo(img, opts.Logo, opts.Background)
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+func renderSVG(bitmap [][]bool, opts QROptions) ([]byte, error) {
+	modules := len(bitmap)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&out, `<rect width="%d" height="%d" fill="%s"/>`, modules, modules, hexColor(opts.Background))
+
+	out.WriteString(`<path fill="` + hexColor(opts.Foreground) + `" d="`)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&out, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	out.WriteString(`"/>`)
+
+	if opts.Logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, scaleImage(opts.Logo, 256)); err != nil {
+			return nil, fmt.Errorf("failed to encode logo: %w", err)
+		}
+		box := float64(modules) * logoScale
+		offset := (float64(modules) - box) / 2
+		pad := box * 0.08
+		fmt.Fprintf(&out, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%s"/>`,
+			offset-pad, offset-pad, box+2*pad, box+2*pad, hexColor(opts.Background))
+		fmt.Fprintf(&out, `<image x="%.2f" y="%.2f" width="%.2f" height="%.2f" preserveAspectRatio="xMidYMid meet" href="data:image/png;base64,%s"/>`,
+			offset, offset, box, box, base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+	out.WriteString("</svg>\n")
+	return out.Bytes(), nil
+}
+
+func drawLogo(img *image.RGBA, logo image.Image, background color.RGBA) {
+	size := img.Bounds().Dx()
+	box := int(float64(size) * logoScale)
+	pad := box / 12
+	origin := (size - box) / 2
+	draw.Draw(img, image.Rect(origin-pad, origin-pad, origin+box+pad, origin+box+pad), image.NewUniform(background), image.Point{}, draw.Src)
+
+	scaled := scaleImage(logo, box)
+	width, height := scaled.Bounds().Dx(), scaled.Bounds().Dy()
+	at := image.Pt(origin+(box-width)/2, origin+(box-height)/2)
+	draw.Draw(img, scaled.Bounds().Add(at), scaled, image.Point{}, draw.Over)
+}
+
+func scaleImage(src image.Image, box int) *image.RGBA {
+	bounds := src.Bounds()
+	scale := math.Min(float64(box)/float64(bounds.Dx()), float64(box)/float64(bounds.Dy()))
+	width, height := max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale))
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			dst.Set(x, y, src.At(bounds.Min.X+int(float64(x)/scale), bounds.Min.Y+int(float64(y)/scale)))
+		}
+	}
+	return dst
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func contrast(a, b color.RGBA) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+func luminance(c color.RGBA) float64 {
+	channel := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.R) + 0.7152*channel(c.G) + 0.0722*channel(c.B)
+}
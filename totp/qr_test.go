@@ -0,0 +1,258 @@
+package totp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const testQRContent = "otpauth://totp/Acme:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Acme"
+
+func testLogo(width, height int) image.Image {
+	logo := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			logo.Set(x, y, color.RGBA{R: 0xCC, A: 0xFF})
+		}
+	}
+	return logo
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{value: "#112233", want: color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xFF}},
+		{value: "aabbcc", want: color.RGBA{R: 0xAA, G: 0xBB, B: 0xCC, A: 0xFF}},
+		{value: " #FfF ", want: color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}},
+		{value: "#000", want: color.RGBA{A: 0xFF}},
+		{value: "", wantErr: true},
+		{value: "#12345", wantErr: true},
+		{value: "#1122334", wantErr: true},
+		{value: "#ggghhh", wantErr: true},
+		{value: "+12345", wantErr: true},
+		{value: "red", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseColor(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor(%q) err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseColor(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQROptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*QROptions)
+		wantErr bool
+	}{
+		{name: "defaults", change: func(o *QROptions) {}},
+		{name: "smallest size", change: func(o *QROptions) { o.Size = MinQRSize }},
+		{name: "largest size", change: func(o *QROptions) { o.Size = MaxQRSize }},
+		{name: "too small", change: func(o *QROptions) { o.Size = MinQRSize - 1 }, wantErr: true},
+		{name: "too large", change: func(o *QROptions) { o.Size = MaxQRSize + 1 }, wantErr: true},
+		{name: "highest recovery", change: func(o *QROptions) { o.Recovery = "highest" }},
+		{name: "unknown recovery", change: func(o *QROptions) { o.Recovery = "H" }, wantErr: true},
+		{name: "svg", change: func(o *QROptions) { o.Format = "svg" }},
+		{name: "unknown format", change: func(o *QROptions) { o.Format = "gif" }, wantErr: true},
+		{name: "inverted colours", change: func(o *QROptions) { o.Foreground, o.Background = o.Background, o.Foreground }},
+		{
+			name: "low contrast",
+			change: func(o *QROptions) {
+				o.Foreground = color.RGBA{R: 0x77, G: 0x77, B: 0x77, A: 0xFF}
+				o.Background = color.RGBA{R: 0x99, G: 0x99, B: 0x99, A: 0xFF}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultQROptions()
+			tt.change(&opts)
+			if err := opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecoveryLevel(t *testing.T) {
+	tests := []struct {
+		recovery string
+		logo     bool
+		want     qrcode.RecoveryLevel
+	}{
+		{"low", false, qrcode.Low},
+		{"medium", false, qrcode.Medium},
+		{"low", true, qrcode.High},
+		{"medium", true, qrcode.High},
+		{"high", true, qrcode.High},
+		{"highest", true, qrcode.Highest},
+	}
+
+	for _, tt := range tests {
+		opts := DefaultQROptions()
+		opts.Recovery = tt.recovery
+		if tt.logo {
+			opts.Logo = testLogo(8, 8)
+		}
+		if got := opts.recoveryLevel(); got != tt.want {
+			t.Errorf("recoveryLevel(%s, logo %v) = %v, want %v", tt.recovery, tt.logo, got, tt.want)
+		}
+	}
+}
+
+func TestRenderQRPNG(t *testing.T) {
+	foreground := color.RGBA{R: 0x11, G: 0x22, B: 0x66, A: 0xFF}
+	background := color.RGBA{R: 0xFF, G: 0xFF, B: 0xEE, A: 0xFF}
+
+	for _, size := range []int{MinQRSize, 300, MaxQRSize} {
+		for _, logo := range []bool{false, true} {
+			opts := DefaultQROptions()
+			opts.Size, opts.Foreground, opts.Background = size, foreground, background
+			if logo {
+				opts.Logo = testLogo(40, 20)
+			}
+
+			data, err := RenderQR(testQRContent, opts)
+			if err != nil {
+				t.Fatalf("RenderQR(size %d, logo %v) = %v", size, logo, err)
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("size %d: output is not a PNG: %v", size, err)
+			}
+			if bounds := img.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+				t.Errorf("PNG is %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), size, size)
+			}
+			if got := color.RGBAModel.Convert(img.At(0, 0)); got != background {
+				t.Errorf("size %d: quiet zone is %v, want the background %v", size, got, background)
+			}
+
+			seen := make(map[color.RGBA]bool)
+			for y := range size {
+				for x := range size {
+					seen[color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)] = true
+				}
+			}
+			if !seen[foreground] {
+				t.Errorf("size %d, logo %v: no module in the foreground colour", size, logo)
+			}
+			if logo != seen[color.RGBA{R: 0xCC, A: 0xFF}] {
+				t.Errorf("size %d: logo drawn = %v, want %v", size, !logo, logo)
+			}
+		}
+	}
+}
+
+func TestRenderQRSVG(t *testing.T) {
+	viewBox := regexp.MustCompile(`viewBox="0 0 (\d+) (\d+)"`)
+	render := func(t *testing.T, opts QROptions) string {
+		t.Helper()
+		data, err := RenderQR(testQRContent, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	modules := func(t *testing.T, svg string) string {
+		t.Helper()
+		match := viewBox.FindStringSubmatch(svg)
+		if match == nil {
+			t.Fatalf("SVG has no viewBox: %s", svg)
+		}
+		return match[1]
+	}
+
+	opts := DefaultQROptions()
+	opts.Format, opts.Size, opts.Recovery = "svg", 300, "low"
+	opts.Foreground = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xFF}
+	opts.Background = color.RGBA{R: 0xFF, G: 0xEE, B: 0xDD, A: 0xFF}
+	plain := render(t, opts)
+
+	for _, want := range []string{`<svg xmlns="http://www.w3.org/2000/svg" width="300" height="300"`, `fill="#ffeedd"`, `<path fill="#112233" d="M`} {
+		if !strings.Contains(plain, want) {
+			t.Errorf("SVG is missing %s", want)
+		}
+	}
+	if !strings.HasSuffix(plain, "</svg>\n") || strings.Contains(plain, "<image") {
+		t.Error("plain SVG is not closed or has a logo")
+	}
+
+	high := opts
+	high.Recovery = "high"
+	withLogo := opts
+	withLogo.Logo = testLogo(16, 16)
+	logoSVG := render(t, withLogo)
+
+	if modules(t, render(t, high)) == modules(t, plain) {
+		t.Fatal("test content fits the same symbol at low and high recovery")
+	}
+	if modules(t, logoSVG) != modules(t, render(t, high)) {
+		t.Errorf("SVG with a logo has %s modules, want the %s of high recovery", modules(t, logoSVG), modules(t, render(t, high)))
+	}
+	if !strings.Contains(logoSVG, `href="data:image/png;base64,`) {
+		t.Error("SVG with a logo does not embed it")
+	}
+}
+
+func TestRenderQRRejectsInvalidOptions(t *testing.T) {
+	opts := DefaultQROptions()
+	opts.Foreground = opts.Background
+	if _, err := RenderQR(testQRContent, opts); !errors.Is(err, ErrLowContrast) {
+		t.Errorf("RenderQR err = %v, want ErrLowContrast", err)
+	}
+}
+
+func TestLoadLogo(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+		wantIs  error
+	}{
+		{name: "png", data: encodePNG(t, testLogo(32, 16))},
+		{name: "too many pixels", data: encodePNG(t, testLogo(maxLogoPixels+1, 1)), wantErr: true, wantIs: ErrLogoTooLarge},
+		{name: "too many bytes", data: make([]byte, MaxLogoBytes+1), wantErr: true, wantIs: ErrLogoTooLarge},
+		{name: "not an image", data: []byte("not an image"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logo, err := LoadLogo(bytes.NewReader(tt.data))
+			if (err != nil) != tt.wantErr || (tt.wantIs != nil && !errors.Is(err, tt.wantIs)) {
+				t.Fatalf("LoadLogo err = %v, wantErr %v (%v)", err, tt.wantErr, tt.wantIs)
+			}
+			if !tt.wantErr && (logo.Bounds().Dx() != 32 || logo.Bounds().Dy() != 16) {
+				t.Errorf("logo is %v, want 32x16", logo.Bounds())
+			}
+		})
+	}
+}
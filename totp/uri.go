@@ -0,0 +1,204 @@
+package totp
+
+import (
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+var ErrInvalidURI = errors.New("invalid otpauth URI")
+
+type Key struct {
+	Type      string
+	Issuer    string
+	Account   string
+	Secret    string
+	Algorithm string
+	Digits    int
+	Period    int
+	Counter   uint64
+}
+
+func NewKey(issuer, account, secret string) *Key {
+	return &Key{
+		Type:      "totp",
+		Issuer:    issuer,
+		Account:   account,
+		Secret:    secret,
+		Algorithm: "SHA1",
+		Digits:    6,
+		Period:    30,
+	}
+}
+
+func KeyURI(issuer, account, secret string) string {
+	return NewKey(issuer, account, secret).URI()
+}
+
+func ParseURI(raw string) (*Key, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Scheme != "otpauth" {
+		return nil, ErrInvalidURI
+	}
+
+	key := NewKey("", "", "")
+	key.Type = strings.ToLower(u.Host)
+	if key.Type != "totp" && key.Type != "hotp" {
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidURI, u.Host)
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		key.Issuer, key.Account = strings.TrimSpace(issuer), strings.TrimSpace(account)
+	} else {
+		key.Account = strings.TrimSpace(label)
+	}
+
+	query := u.Query()
+	key.Secret = strings.ToUpper(query.Get("secret"))
+	if key.Secret == "" {
+		return nil, fmt.Errorf("%w: missing secret", ErrInvalidURI)
+	}
+	if _, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(key.Secret, "=")); err != nil {
+		return nil, fmt.Errorf("%w: secret is not base32", ErrInvalidURI)
+	}
+	if issuer := query.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		key.Algorithm = strings.ToUpper(algorithm)
+	}
+	if digits := query.Get("digits"); digits != "" {
+		if key.Digits, err = strconv.Atoi(digits); err != nil {
+			return nil, fmt.Errorf("%w: invalid digits %q", ErrInvalidURI, digits)
+		}
+	}
+	if period := query.Get("period"); period != "" {
+		if key.Period, err = strconv.Atoi(period); err != nil || key.Period <= 0 {
+			return nil, fmt.Errorf("%w: invalid period %q", ErrInvalidURI, period)
+		}
+	}
+	if counter := query.Get("counter"); counter != "" {
+		if key.Counter, err = strconv.ParseUint(counter, 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: invalid counter %q", ErrInvalidURI, counter)
+		}
+	}
+
+	if _, err := key.otpAlgorithm(); err != nil {
+		return nil, err
+	}
+	if key.Digits != 6 && key.Digits != 8 {
+		return nil, fmt.Errorf("%w: digits must be 6 or 8", ErrInvalidURI)
+	}
+	return key, nil
+}
+
+func (k *Key) Label() string {
+	if k.Issuer == "" {
+		return k.Account
+	}
+	return k.Issuer + ":" + k.Account
+}
+
+func (k *Key) URI() string {
+	query := url.Values{}
+	query.Set("secret", k.Secret)
+	if k.Issuer != "" {
+		query.Set("issuer", k.Issuer)
+	}
+	if k.Algorithm != "" && k.Algorithm != "SHA1" {
+		query.Set("algorithm", k.Algorithm)
+	}
+	if k.Digits != 0 && k.Digits != 6 {
+		query.Set("digits", strconv.Itoa(k.Digits))
+	}
+	if k.Type == "hotp" {
+		query.Set("counter", strconv.FormatUint(k.Counter, 10))
+	} else if k.Period != 0 && k.Period != 30 {
+		query.Set("period", strconv.Itoa(k.Period))
+	}
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     k.Type,
+		Path:     "/" + k.Label(),
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+func (k *Key) Code(now time.Time) (string, error) {
+	algorithm, err := k.otpAlgorithm()
+	if err != nil {
+		return "", err
+	}
+	digits := otp.DigitsSix
+	if k.Digits == 8 {
+		digits = otp.DigitsEight
+	}
+
+	if k.Type == "hotp" {
+		return hotp.GenerateCodeCustom(k.Secret, k.Counter, hotp.ValidateOpts{Digits: digits, Algorithm: algorithm})
+	}
+	return totp.GenerateCodeCustom(k.Secret, now, totp.ValidateOpts{
+		Period:    uint(k.Period),
+		Digits:    digits,
+		Algorithm: algorithm,
+	})
+}
+
+func (k *Key) Remaining(now time.Time) time.Duration {
+	period := int64(k.Period)
+	if period <= 0 {
+		period = 30
+	}
+	next := (now.Unix()/period + 1) * period
+	return time.Unix(next, 0).Sub(now)
+}
+
+func (k *Key) otpAlgorithm() (otp.Algorithm, error) {
+	switch k.Algorithm {
+	case "", "SHA1":
+		return otp.AlgorithmSHA1, nil
+	case "SHA256":
+		return otp.AlgorithmSHA256, nil
+	case "SHA512":
+		return otp.AlgorithmSHA512, nil
+	case "MD5":
+		return otp.AlgorithmMD5, nil
+	default:
+		return 0, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidURI, k.Algorithm)
+	}
+}
+
+func (k *Key) Verify(code string, now time.Time) (bool, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != k.Digits {
+		return false, nil
+	}
+	if k.Type == "hotp" {
+		expected, err := k.Code(now)
+		return err == nil && expected == code, err
+	}
+
+	period := time.Duration(k.Period) * time.Second
+	for _, offset := range []time.Duration{0, -period, period} {
+		expected, err := k.Code(now.Add(offset))
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
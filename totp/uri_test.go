@@ -0,0 +1,95 @@
+package totp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		want    Key
+		wantErr bool
+	}{
+		{
+			name: "issuer in label and query",
+			uri:  "otpauth://totp/Acme:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Acme",
+			want: Key{Type: "totp", Issuer: "Acme", Account: "alice@example.com", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name: "query issuer wins over label",
+			uri:  "otpauth://totp/Old:alice?secret=JBSWY3DPEHPK3PXP&issuer=New",
+			want: Key{Type: "totp", Issuer: "New", Account: "alice", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name: "account only with lower case secret",
+			uri:  " otpauth://TOTP/alice?secret=jbswy3dpehpk3pxp ",
+			want: Key{Type: "totp", Account: "alice", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name: "custom algorithm, digits and period",
+			uri:  "otpauth://totp/Acme:bob?secret=JBSWY3DPEHPK3PXP&algorithm=sha256&digits=8&period=60",
+			want: Key{Type: "totp", Issuer: "Acme", Account: "bob", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA256", Digits: 8, Period: 60},
+		},
+		{
+			name: "hotp with counter",
+			uri:  "otpauth://hotp/Acme:bob?secret=JBSWY3DPEHPK3PXP&counter=42&algorithm=SHA512",
+			want: Key{Type: "hotp", Issuer: "Acme", Account: "bob", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA512", Digits: 6, Period: 30, Counter: 42},
+		},
+		{
+			name: "padded secret",
+			uri:  "otpauth://totp/alice?secret=JBSWY3DPEE%3D%3D%3D%3D%3D%3D",
+			want: Key{Type: "totp", Account: "alice", Secret: "JBSWY3DPEE======", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{name: "wrong scheme", uri: "https://totp/alice?secret=JBSWY3DPEHPK3PXP", wantErr: true},
+		{name: "not a URL", uri: "otpauth://totp/%zz?secret=JBSWY3DPEHPK3PXP", wantErr: true},
+		{name: "unsupported type", uri: "otpauth://motp/alice?secret=JBSWY3DPEHPK3PXP", wantErr: true},
+		{name: "missing secret", uri: "otpauth://totp/alice?issuer=Acme", wantErr: true},
+		{name: "empty secret", uri: "otpauth://totp/alice?secret=", wantErr: true},
+		{name: "secret not base32", uri: "otpauth://totp/alice?secret=JBSW1890", wantErr: true},
+		{name: "unknown algorithm", uri: "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&algorithm=SHA3", wantErr: true},
+		{name: "unsupported digits", uri: "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=7", wantErr: true},
+		{name: "digits not a number", uri: "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=six", wantErr: true},
+		{name: "zero period", uri: "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&period=0", wantErr: true},
+		{name: "negative counter", uri: "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP&counter=-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseURI(tt.uri)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidURI) {
+					t.Fatalf("ParseURI err = %v, want ErrInvalidURI", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseURI = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+	keys := []*Key{
+		NewKey("Acme Corp", "alice@example.com", "JBSWY3DPEHPK3PXP"),
+		{Type: "totp", Issuer: "Acme", Account: "bob", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA512", Digits: 8, Period: 60},
+		{Type: "hotp", Account: "carol", Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30, Counter: 7},
+	}
+
+	for _, key := range keys {
+		t.Run(key.Label(), func(t *testing.T) {
+			got, err := ParseURI(key.URI())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *key {
+				t.Errorf("ParseURI(%s) = %+v, want %+v", key.URI(), *got, *key)
+			}
+		})
+	}
+}
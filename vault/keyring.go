@@ -0,0 +1,107 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const dataKeySize = 32
+
+// Keyring holds the key-encryption keys. Entries are encrypted with their own
+// data key, and only that data key is wrapped by a KEK, so rotating a KEK
+// re-wraps 32-byte keys instead of re-encrypting every secret.
+type Keyring struct {
+	active int
+	keys   map[int]cipher.AEAD
+}
+
+func NewKeyring(active int, keys map[int][]byte) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active key version %d is missing", active)
+	}
+
+	k := &Keyring{active: active, keys: make(map[int]cipher.AEAD, len(keys))}
+	for version, key := range keys {
+		if version < 1 {
+			return nil, fmt.Errorf("key version %d must be at least 1", version)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key version %d: %w", version, err)
+		}
+		k.keys[version] = aead
+	}
+	return k, nil
+}
+
+func (k *Keyring) Active() int {
+	return k.active
+}
+
+func (k *Keyring) Versions() []int {
+	versions := make([]int, 0, len(k.keys))
+	for version := range k.keys {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	return versions
+}
+
+func (k *Keyring) wrap(id string, dataKey []byte) ([]byte, error) {
+	return sealWith(k.keys[k.active], wrapAAD(id, k.active), dataKey)
+}
+
+func (k *Keyring) unwrap(id string, version int, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: key version %d is not configured", ErrDecrypt, version)
+	}
+	return openWith(aead, wrapAAD(id, version), wrapped)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newDataKey() ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func sealWith(aead cipher.AEAD, aad string, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, []byte(aad)), nil
+}
+
+func openWith(aead cipher.AEAD, aad string, sealed []byte) ([]byte, error) {
+	size := aead.NonceSize()
+	if len(sealed) < size {
+		return nil, ErrDecrypt
+	}
+	plain, err := aead.Open(nil, sealed[:size], sealed[size:], []byte(aad))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+func wrapAAD(id string, version int) string {
+	return id + "/data-key/" + strconv.Itoa(version)
+}
@@ -0,0 +1,251 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeLegacyVault writes entries the way vaults were stored before envelope
+// encryption: every field sealed directly with the vault key.
+func writeLegacyVault(t *testing.T, path string, key []byte, secrets map[string]string) {
+	t.Helper()
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []Entry
+	for id, secret := range secrets {
+		sealed, err := sealWith(aead, id, []byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes, _ := json.Marshal([]BackupCode{{Code: "code-" + id}})
+		sealedCodes, err := sealWith(aead, backupCodesAAD(id), codes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, Entry{
+			ID: id, Name: id, Owner: GuildOwner("g1"), Type: "totp", Algorithm: "SHA1", Digits: 6, Period: 30,
+			CreatedAt: time.Now().UTC(), Sealed: sealed, SealedBackupCodes: sealedCodes,
+		})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		active  int
+		keys    map[int][]byte
+		wantErr bool
+	}{
+		{"single key", 1, map[int][]byte{1: testKey(1)}, false},
+		{"active and old key", 2, map[int][]byte{1: testKey(1), 2: testKey(2)}, false},
+		{"active key missing", 2, map[int][]byte{1: testKey(1)}, true},
+		{"version zero", 1, map[int][]byte{0: testKey(0), 1: testKey(1)}, true},
+		{"short key", 1, map[int][]byte{1: []byte("short")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyring(tt.active, tt.keys); (err != nil) != tt.wantErr {
+				t.Errorf("NewKeyring err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWrappedKeyIsBoundToEntryAndVersion(t *testing.T) {
+	keyring := testKeyring(t, 2, 1)
+	dataKey := testKey(42)
+	wrapped, err := keyring.wrap("e1", dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := keyring.unwrap("e1", 2, wrapped); err != nil || string(got) != string(dataKey) {
+		t.Fatalf("unwrap = %v, %v", got, err)
+	}
+	if _, err := keyring.unwrap("e2", 2, wrapped); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("unwrap as another entry err = %v, want ErrDecrypt", err)
+	}
+	if _, err := keyring.unwrap("e1", 1, wrapped); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("unwrap under another version err = %v, want ErrDecrypt", err)
+	}
+	if _, err := keyring.unwrap("e1", 3, wrapped); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("unwrap with a missing version err = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestOpenMigratesLegacyVault(t *testing.T) {
+	tests := []struct {
+		name        string
+		legacyKey   []byte
+		keyring     func(t *testing.T) *Keyring
+		wantVersion int
+		wantErr     bool
+	}{
+		{"sealed with the active key", testKey(1), func(t *testing.T) *Keyring { return testKeyring(t, 1) }, 1, false},
+		{"sealed with an old key", testKey(1), func(t *testing.T) *Keyring { return testKeyring(t, 2, 1) }, 2, false},
+		{"sealed with an unknown key", testKey(9), func(t *testing.T) *Keyring { return testKeyring(t, 2, 1) }, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vault.json")
+			writeLegacyVault(t, path, tt.legacyKey, map[string]string{"e1": oldSecret, "e2": newSecret})
+			before, _ := os.ReadFile(path)
+
+			v, err := Open(path, tt.keyring(t))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Open accepted a vault sealed with an unknown key")
+				}
+				if after, _ := os.ReadFile(path); string(after) != string(before) {
+					t.Error("failed migration rewrote the vault")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := v.KeyVersions(); got[tt.wantVersion] != 2 || len(got) != 1 {
+				t.Errorf("KeyVersions = %v, want both entries under %d", got, tt.wantVersion)
+			}
+			for id, want := range map[string]string{"e1": oldSecret, "e2": newSecret} {
+				if got := secretOf(t, v, id); got != want {
+					t.Errorf("secret of %s = %s, want %s", id, got, want)
+				}
+				entry, _ := v.Get(id)
+				if codes, err := v.BackupCodes(entry); err != nil || len(codes) != 1 || codes[0].Code != "code-"+id {
+					t.Errorf("backup codes of %s = %v, %v", id, codes, err)
+				}
+			}
+
+			stored, err := ReadEntries(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range stored {
+				if len(entry.DataKey) == 0 || entry.KeyVersion != tt.wantVersion {
+					t.Errorf("stored entry %s has key version %d and %d byte data key, want it migrated", entry.ID, entry.KeyVersion, len(entry.DataKey))
+				}
+			}
+
+			reopened, err := Open(path, tt.keyring(t))
+			if err != nil {
+				t.Fatalf("reopen after migration = %v", err)
+			}
+			if got := secretOf(t, reopened, "e1"); got != oldSecret {
+				t.Errorf("secret after reopen = %s, want %s", got, oldSecret)
+			}
+		})
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	v, path := newTestVault(t)
+	first := addTestEntry(t, v, "registrar")
+	second := addTestEntry(t, v, "cloud")
+	if err := v.SetKeyring(testKeyring(t, 2, 1)); err != nil {
+		t.Fatal(err)
+	}
+	third := addTestEntry(t, v, "dns")
+
+	if got := v.KeyVersions(); got[1] != 2 || got[2] != 1 {
+		t.Fatalf("KeyVersions before rewrap = %v, want two under 1 and one under 2", got)
+	}
+	rewrapped, err := v.Rewrap()
+	if err != nil || rewrapped != 2 {
+		t.Fatalf("Rewrap = %d, %v; want 2", rewrapped, err)
+	}
+	if got := v.KeyVersions(); got[2] != 3 || len(got) != 1 {
+		t.Errorf("KeyVersions after rewrap = %v, want all three under 2", got)
+	}
+	if rewrapped, err := v.Rewrap(); err != nil || rewrapped != 0 {
+		t.Errorf("second Rewrap = %d, %v; want 0", rewrapped, err)
+	}
+
+	newOnly, err := NewKeyring(2, map[int][]byte{2: testKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(path, newOnly)
+	if err != nil {
+		t.Fatalf("reopen with only the new key = %v", err)
+	}
+	for _, entry := range []Entry{first, second, third} {
+		if got := secretOf(t, reopened, entry.ID); got != oldSecret {
+			t.Errorf("secret of %s after rewrap = %s, want %s", entry.Name, got, oldSecret)
+		}
+	}
+
+	if _, err := Open(path, testKeyring(t, 1)); err == nil {
+		t.Error("reopen with only the retired key succeeded")
+	}
+}
+
+func TestSetKeyring(t *testing.T) {
+	swapped := func(t *testing.T) *Keyring {
+		keyring, err := NewKeyring(1, map[int][]byte{1: testKey(9)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keyring
+	}
+
+	tests := []struct {
+		name       string
+		keyring    func(t *testing.T) *Keyring
+		wantErr    bool
+		wantActive int
+	}{
+		{"new active key keeps the old one", func(t *testing.T) *Keyring { return testKeyring(t, 2, 1) }, false, 2},
+		{"key in use is dropped", func(t *testing.T) *Keyring { return testKeyring(t, 2) }, true, 1},
+		{"key in use is swapped", swapped, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, path := newTestVault(t)
+			entry := addTestEntry(t, v, "registrar")
+
+			keyring := tt.keyring(t)
+			if err := v.CheckKeyring(keyring); (err != nil) != tt.wantErr {
+				t.Fatalf("CheckKeyring err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := v.ActiveKeyVersion(); got != 1 {
+				t.Fatalf("ActiveKeyVersion after CheckKeyring = %d, want it unchanged", got)
+			}
+			if err := v.SetKeyring(keyring); (err != nil) != tt.wantErr {
+				t.Fatalf("SetKeyring err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := v.ActiveKeyVersion(); got != tt.wantActive {
+				t.Errorf("ActiveKeyVersion = %d, want %d", got, tt.wantActive)
+			}
+			if got := secretOf(t, v, entry.ID); got != oldSecret {
+				t.Errorf("secret after SetKeyring = %s, want %s", got, oldSecret)
+			}
+
+			added := addTestEntry(t, v, "cloud")
+			if added.KeyVersion != tt.wantActive {
+				t.Errorf("new entry key version = %d, want %d", added.KeyVersion, tt.wantActive)
+			}
+			if _, err := Open(path, v.keyring.Load()); err != nil {
+				t.Errorf("reopen with the keyring in use = %v", err)
+			}
+		})
+	}
+}
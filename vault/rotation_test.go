@@ -0,0 +1,249 @@
+package vault
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/totp"
+)
+
+const (
+	oldSecret = "JBSWY3DPEHPK3PXP"
+	newSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+)
+
+func testKey(version byte) []byte {
+	key := make([]byte, 32)
+	for idx := range key {
+		key[idx] = version + byte(idx)
+	}
+	return key
+}
+
+func testKeyring(t *testing.T, active int, versions ...int) *Keyring {
+	t.Helper()
+
+	keys := make(map[int][]byte)
+	for _, version := range append(versions, active) {
+		keys[version] = testKey(byte(version))
+	}
+	keyring, err := NewKeyring(active, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func newTestVault(t *testing.T) (*Vault, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "vault.json")
+	v, err := Open(path, testKeyring(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, path
+}
+
+func addTestEntry(t *testing.T, v *Vault, name string) Entry {
+	t.Helper()
+
+	entry, err := v.Add(Entry{Name: name, Owner: GuildOwner("g1"), CreatedBy: "u1"}, totp.NewKey("Acme", "ops", oldSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func secretOf(t *testing.T, v *Vault, id string) string {
+	t.Helper()
+
+	entry, err := v.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := v.Key(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.Secret
+}
+
+func TestRotation(t *testing.T) {
+	accept := func(*totp.Key) bool { return true }
+	reject := func(*totp.Key) bool { return false }
+
+	tests := []struct {
+		name       string
+		run        func(v *Vault, id string) error
+		wantErr    error
+		wantSecret string
+		wantOpen   bool
+		wantEvents []string
+	}{
+		{
+			name: "confirmed rotation replaces the secret",
+			run: func(v *Vault, id string) error {
+				_, err := v.CompleteRotation(id, "u2", accept)
+				return err
+			},
+			wantSecret: newSecret,
+			wantEvents: []string{"completed"},
+		},
+		{
+			name: "wrong code keeps the old secret",
+			run: func(v *Vault, id string) error {
+				_, err := v.CompleteRotation(id, "u2", reject)
+				return err
+			},
+			wantErr:    ErrRotationNotConfirmed,
+			wantSecret: oldSecret,
+			wantOpen:   true,
+		},
+		{
+			name: "cancelled rotation keeps the old secret",
+			run: func(v *Vault, id string) error {
+				_, err := v.CancelRotation(id, "u2")
+				return err
+			},
+			wantSecret: oldSecret,
+			wantEvents: []string{"cancelled"},
+		},
+		{
+			name: "second start is refused",
+			run: func(v *Vault, id string) error {
+				_, err := v.StartRotation(id, "u3", totp.NewKey("Acme", "ops", "MFRGGZDFMZTWQ2LK"))
+				return err
+			},
+			wantErr:    ErrRotationPending,
+			wantSecret: oldSecret,
+			wantOpen:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := newTestVault(t)
+			entry := addTestEntry(t, v, "registrar")
+			if _, err := v.StartRotation(entry.ID, "u1", totp.NewKey("Acme", "ops", newSecret)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.run(v, entry.ID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := secretOf(t, v, entry.ID); got != tt.wantSecret {
+				t.Errorf("secret = %s, want %s", got, tt.wantSecret)
+			}
+
+			current, _ := v.Get(entry.ID)
+			if open := current.PendingSince != nil; open != tt.wantOpen {
+				t.Errorf("pending = %v, want %v", open, tt.wantOpen)
+			}
+			if tt.wantOpen {
+				pending, err := v.PendingKey(current)
+				if err != nil || pending.Secret != newSecret {
+					t.Errorf("pending key = %v, %v; want the first started secret", pending, err)
+				}
+			}
+			var events []string
+			for _, rotation := range current.History {
+				events = append(events, rotation.Outcome)
+			}
+			if len(events) != len(tt.wantEvents) || (len(events) > 0 && events[0] != tt.wantEvents[0]) {
+				t.Errorf("history = %v, want %v", events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestRotationWithoutPending(t *testing.T) {
+	v, _ := newTestVault(t)
+	entry := addTestEntry(t, v, "registrar")
+
+	if _, err := v.CompleteRotation(entry.ID, "u1", func(*totp.Key) bool { return true }); !errors.Is(err, ErrNoPendingRotation) {
+		t.Errorf("CompleteRotation err = %v, want ErrNoPendingRotation", err)
+	}
+	if _, err := v.CancelRotation(entry.ID, "u1"); !errors.Is(err, ErrNoPendingRotation) {
+		t.Errorf("CancelRotation err = %v, want ErrNoPendingRotation", err)
+	}
+	if _, err := v.StartRotation("missing", "u1", totp.NewKey("", "", newSecret)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("StartRotation err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestConcurrentStartRotation(t *testing.T) {
+	v, _ := newTestVault(t)
+	entry := addTestEntry(t, v, "registrar")
+
+	const starters = 8
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		started []string
+	)
+	secrets := []string{"MFRGGZDFMZTWQ2LK", "ONSWG4TFORXXEZLU", newSecret, "KRUGKIDROVUWG2ZA", "NBSWY3DPO5XXE3DE", "GEZDGNBVGY3TQOJQ", "MZXW6YTBOI2TMNZY", "OBQXG43XN5ZGIMJS"}
+	for idx := range starters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.StartRotation(entry.ID, "u1", totp.NewKey("Acme", "ops", secrets[idx]))
+			if err == nil {
+				mutex.Lock()
+				started = append(started, secrets[idx])
+				mutex.Unlock()
+			} else if !errors.Is(err, ErrRotationPending) {
+				t.Errorf("StartRotation err = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(started) != 1 {
+		t.Fatalf("%d rotations started, want exactly 1", len(started))
+	}
+	current, _ := v.Get(entry.ID)
+	pending, err := v.PendingKey(current)
+	if err != nil || pending.Secret != started[0] {
+		t.Fatalf("pending secret = %v, %v; want the one start that succeeded (%s)", pending, err, started[0])
+	}
+}
+
+func TestRotationSurvivesReopen(t *testing.T) {
+	v, path := newTestVault(t)
+	entry := addTestEntry(t, v, "registrar")
+	if _, err := v.StartRotation(entry.ID, "u1", totp.NewKey("Acme", "ops", newSecret)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.CompleteRotation(entry.ID, "u2", func(key *totp.Key) bool {
+		valid, err := key.Verify(mustCode(t, key), time.Now())
+		return err == nil && valid
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path, testKeyring(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := secretOf(t, reopened, entry.ID); got != newSecret {
+		t.Errorf("secret after reopen = %s, want %s", got, newSecret)
+	}
+	current, _ := reopened.Get(entry.ID)
+	if len(current.History) != 1 || current.History[0].StartedBy != "u1" || current.History[0].CompletedBy != "u2" {
+		t.Errorf("history after reopen = %+v", current.History)
+	}
+}
+
+func mustCode(t *testing.T, key *totp.Key) string {
+	t.Helper()
+
+	code, err := key.Code(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
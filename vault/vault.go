@@ -0,0 +1,773 @@
+package vault
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Discord-Bot-2FA-Key-Gen/totp"
+)
+
+var (
+	ErrNotFound   = errors.New("entry not found")
+	ErrDuplicate  = errors.New("an entry with this name already exists")
+	ErrInvalidKey = errors.New("vault key must be 32 bytes")
+	ErrDecrypt    = errors.New("failed to decrypt entry secret")
+
+	ErrNoBackupCodes      = errors.New("entry has no backup codes")
+	ErrBackupCodeNotFound = errors.New("backup code not found")
+	ErrBackupCodeUsed     = errors.New("backup code was already used")
+
+	ErrNoPendingRotation    = errors.New("entry has no pending rotation")
+	ErrRotationPending      = errors.New("entry already has a pending rotation")
+	ErrRotationNotConfirmed = errors.New("code does not match the pending secret")
+)
+
+type Entry struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	Type      string    `json:"type"`
+	Algorithm string    `json:"algorithm"`
+	Digits    int       `json:"digits"`
+	Period    int       `json:"period,omitempty"`
+	Counter   uint64    `json:"counter,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Sealed    []byte    `json:"secret"`
+
+	DataKey    []byte `json:"data_key,omitempty"`
+	KeyVersion int    `json:"key_version,omitempty"`
+
+	AccessRoles       []string `json:"access_roles,omitempty"`
+	ManagerRoles      []string `json:"manager_roles,omitempty"`
+	AnnounceChannelID string   `json:"announce_channel_id,omitempty"`
+
+	RequiresApproval  bool     `json:"requires_approval,omitempty"`
+	ApproverRoles     []string `json:"approver_roles,omitempty"`
+	ApprovalChannelID string   `json:"approval_channel_id,omitempty"`
+
+	SealedBackupCodes []byte `json:"backup_codes,omitempty"`
+
+	// The otpauth:// URI of a new secret waiting for a confirmed code; the old
+	// secret stays in Sealed until then.
+	SealedPending []byte     `json:"pending_secret,omitempty"`
+	PendingBy     string     `json:"pending_by,omitempty"`
+	PendingSince  *time.Time `json:"pending_since,omitempty"`
+	History       []Rotation `json:"history,omitempty"`
+}
+
+type Rotation struct {
+	Outcome     string    `json:"outcome"`
+	StartedBy   string    `json:"started_by,omitempty"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	CompletedBy string    `json:"completed_by"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+type BackupCode struct {
+	Code   string     `json:"code"`
+	UsedAt *time.Time `json:"used_at,omitempty"`
+	UsedBy string     `json:"used_by,omitempty"`
+}
+
+func RemainingBackupCodes(codes []BackupCode) int {
+	remaining := 0
+	for _, code := range codes {
+		if code.UsedAt == nil {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+func (e Entry) clone() Entry {
+	e.AccessRoles = slices.Clone(e.AccessRoles)
+	e.ManagerRoles = slices.Clone(e.ManagerRoles)
+	e.ApproverRoles = slices.Clone(e.ApproverRoles)
+	e.History = slices.Clone(e.History)
+	return e
+}
+
+func UserOwner(userID string) string {
+	return "user:" + userID
+}
+
+func GuildOwner(guildID string) string {
+	return "guild:" + guildID
+}
+
+func APIOwner(keyName string) string {
+	return "api:" + keyName
+}
+
+func IsAPIOwner(owner string) bool {
+	return strings.HasPrefix(owner, APIOwner(""))
+}
+
+// ReadEntries returns the entries stored at path without decrypting anything,
+// for tools that only need names and owners.
+func ReadEntries(path string) ([]Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse vault %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+type Vault struct {
+	path    string
+	keyring atomic.Pointer[Keyring]
+	entries map[string]Entry
+	mutex   sync.RWMutex
+}
+
+func Open(path string, keyring *Keyring) (*Vault, error) {
+	v := &Vault{
+		path:    path,
+		entries: make(map[string]Entry),
+	}
+	v.keyring.Store(keyring)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse vault %s: %w", path, err)
+	}
+
+	migrated := false
+	for _, entry := range entries {
+		if len(entry.DataKey) == 0 {
+			if entry, err = v.migrate(entry); err != nil {
+				return nil, fmt.Errorf("vault key does not match %s: %w", path, err)
+			}
+			migrated = true
+		}
+		v.entries[entry.ID] = entry
+	}
+
+	if err := v.checkKeyring(keyring); err != nil {
+		return nil, fmt.Errorf("vault keys do not match %s: %w", path, err)
+	}
+	if migrated {
+		if err := v.save(); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Entries written before envelope encryption were sealed directly with the
+// vault key. They get a data key of their own the first time they are loaded.
+func (v *Vault) migrate(entry Entry) (Entry, error) {
+	keyring := v.keyring.Load()
+	var legacy cipher.AEAD
+	for _, version := range keyring.Versions() {
+		if _, err := openWith(keyring.keys[version], entry.ID, entry.Sealed); err == nil {
+			legacy = keyring.keys[version]
+			break
+		}
+	}
+	if legacy == nil {
+		return Entry{}, ErrDecrypt
+	}
+
+	if err := v.newDataKey(&entry); err != nil {
+		return Entry{}, err
+	}
+	fields := []struct {
+		aad    string
+		sealed *[]byte
+	}{
+		{entry.ID, &entry.Sealed},
+		{backupCodesAAD(entry.ID), &entry.SealedBackupCodes},
+		{pendingAAD(entry.ID), &entry.SealedPending},
+	}
+	for _, field := range fields {
+		if len(*field.sealed) == 0 {
+			continue
+		}
+		plain, err := openWith(legacy, field.aad, *field.sealed)
+		if err != nil {
+			return Entry{}, err
+		}
+		if *field.sealed, err = v.seal(entry, field.aad, string(plain)); err != nil {
+			return Entry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// CheckKeyring reports whether SetKeyring would accept keyring, without
+// applying it.
+func (v *Vault) CheckKeyring(keyring *Keyring) error {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	return v.checkKeyring(keyring)
+}
+
+func (v *Vault) SetKeyring(keyring *Keyring) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if err := v.checkKeyring(keyring); err != nil {
+		return err
+	}
+	v.keyring.Store(keyring)
+	return nil
+}
+
+// checkKeyring unwraps one entry per key version in use. A missing or swapped
+// key fails on any entry it wrapped, so a reload can't drop or swap a key that
+// is still needed; an entry whose own wrapped key is corrupt is not caught.
+func (v *Vault) checkKeyring(keyring *Keyring) error {
+	checked := make(map[int]bool)
+	for _, entry := range v.entries {
+		if checked[entry.KeyVersion] {
+			continue
+		}
+		if _, err := keyring.unwrap(entry.ID, entry.KeyVersion, entry.DataKey); err != nil {
+			return fmt.Errorf("key version %d can't unwrap entry %s: %w", entry.KeyVersion, entry.ID, err)
+		}
+		checked[entry.KeyVersion] = true
+	}
+	return nil
+}
+
+// Check reports whether the vault can still serve codes: the active key must
+// wrap and unwrap a data key, and each key version in use must unwrap one of
+// its entries.
+func (v *Vault) Check() error {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	keyring := v.keyring.Load()
+	probe := make([]byte, 32)
+	wrapped, err := keyring.wrap("readiness", probe)
+	if err == nil {
+		_, err = keyring.unwrap("readiness", keyring.Active(), wrapped)
+	}
+	if err != nil {
+		return fmt.Errorf("active key version %d is unusable: %w", keyring.Active(), err)
+	}
+	return v.checkKeyring(keyring)
+}
+
+func (v *Vault) KeyVersions() map[int]int {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	versions := make(map[int]int)
+	for _, entry := range v.entries {
+		versions[entry.KeyVersion]++
+	}
+	return versions
+}
+
+func (v *Vault) ActiveKeyVersion() int {
+	return v.keyring.Load().Active()
+}
+
+func (v *Vault) Rewrap() (int, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	keyring := v.keyring.Load()
+	previous := maps.Clone(v.entries)
+	rewrapped := 0
+	for id, entry := range v.entries {
+		if entry.KeyVersion == keyring.Active() {
+			continue
+		}
+		dataKey, err := keyring.unwrap(id, entry.KeyVersion, entry.DataKey)
+		if err != nil {
+			v.entries = previous
+			return 0, fmt.Errorf("failed to unwrap data key of entry %s: %w", id, err)
+		}
+		wrapped, err := keyring.wrap(id, dataKey)
+		clear(dataKey)
+		if err != nil {
+			v.entries = previous
+			return 0, err
+		}
+		entry.DataKey, entry.KeyVersion = wrapped, keyring.Active()
+		v.entries[id] = entry
+		rewrapped++
+	}
+
+	if rewrapped == 0 {
+		return 0, nil
+	}
+	if err := v.save(); err != nil {
+		v.entries = previous
+		return 0, err
+	}
+	return rewrapped, nil
+}
+
+func (v *Vault) Add(entry Entry, key *totp.Key) (Entry, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	entry.Name = strings.TrimSpace(entry.Name)
+	if entry.Name == "" {
+		return Entry{}, errors.New("entry name is required")
+	}
+	if v.findLocked(entry.Owner, entry.Name) != nil {
+		return Entry{}, ErrDuplicate
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Entry{}, err
+	}
+	entry.ID = hex.EncodeToString(id)
+	entry.Issuer = key.Issuer
+	entry.Account = key.Account
+	entry.Type = key.Type
+	entry.Algorithm = key.Algorithm
+	entry.Digits = key.Digits
+	entry.Period = key.Period
+	entry.Counter = key.Counter
+	entry.CreatedAt = time.Now().UTC()
+	entry.UpdatedAt = entry.CreatedAt
+
+	if err := v.newDataKey(&entry); err != nil {
+		return Entry{}, err
+	}
+	sealed, err := v.seal(entry, entry.ID, key.Secret)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.Sealed = sealed
+
+	entry = entry.clone()
+	v.entries[entry.ID] = entry
+	if err := v.save(); err != nil {
+		delete(v.entries, entry.ID)
+		return Entry{}, err
+	}
+	return entry.clone(), nil
+}
+
+func (v *Vault) Get(id string) (Entry, error) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	entry, ok := v.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return entry.clone(), nil
+}
+
+func (v *Vault) Find(owner, name string) (Entry, error) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	entry := v.findLocked(owner, name)
+	if entry == nil {
+		return Entry{}, ErrNotFound
+	}
+	return entry.clone(), nil
+}
+
+func (v *Vault) List(filter func(Entry) bool) []Entry {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	var entries []Entry
+	for _, entry := range v.entries {
+		if filter == nil || filter(entry) {
+			entries = append(entries, entry.clone())
+		}
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].Owner != entries[b].Owner {
+			return entries[a].Owner < entries[b].Owner
+		}
+		return entries[a].Name < entries[b].Name
+	})
+	return entries
+}
+
+func (v *Vault) Update(id, actor string, change func(*Entry) error) (Entry, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	previous, ok := v.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+
+	entry := previous.clone()
+	if err := change(&entry); err != nil {
+		return Entry{}, err
+	}
+	entry.ID, entry.Owner, entry.Sealed = previous.ID, previous.Owner, previous.Sealed
+	entry.DataKey, entry.KeyVersion = previous.DataKey, previous.KeyVersion
+	entry.SealedBackupCodes = previous.SealedBackupCodes
+	entry.SealedPending, entry.PendingBy, entry.PendingSince = previous.SealedPending, previous.PendingBy, previous.PendingSince
+	entry.History = slices.Clone(previous.History)
+	entry.UpdatedBy = actor
+	entry.UpdatedAt = time.Now().UTC()
+
+	v.entries[id] = entry
+	if err := v.save(); err != nil {
+		v.entries[id] = previous
+		return Entry{}, err
+	}
+	return entry.clone(), nil
+}
+
+func (v *Vault) StartRotation(id, actor string, key *totp.Key) (Entry, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	previous, ok := v.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	if previous.PendingSince != nil {
+		return previous.clone(), ErrRotationPending
+	}
+
+	sealed, err := v.seal(previous, pendingAAD(id), key.URI())
+	if err != nil {
+		return Entry{}, err
+	}
+	now := time.Now().UTC()
+	entry := previous.clone()
+	entry.SealedPending = sealed
+	entry.PendingBy = actor
+	entry.PendingSince = &now
+	entry.UpdatedBy = actor
+	entry.UpdatedAt = now
+
+	v.entries[id] = entry
+	if err := v.save(); err != nil {
+		v.entries[id] = previous
+		return Entry{}, err
+	}
+	return entry.clone(), nil
+}
+
+func (v *Vault) PendingKey(entry Entry) (*totp.Key, error) {
+	if len(entry.SealedPending) == 0 {
+		return nil, ErrNoPendingRotation
+	}
+	uri, err := v.open(entry, pendingAAD(entry.ID), entry.SealedPending)
+	if err != nil {
+		return nil, err
+	}
+	return totp.ParseURI(uri)
+}
+
+func (v *Vault) CompleteRotation(id, actor string, confirm func(*totp.Key) bool) (Entry, error) {
+	return v.finishRotation(id, actor, confirm)
+}
+
+func (v *Vault) CancelRotation(id, actor string) (Entry, error) {
+	return v.finishRotation(id, actor, nil)
+}
+
+func (v *Vault) finishRotation(id, actor string, confirm func(*totp.Key) bool) (Entry, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	previous, ok := v.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	if len(previous.SealedPending) == 0 {
+		return Entry{}, ErrNoPendingRotation
+	}
+
+	entry := previous.clone()
+	rotation := Rotation{Outcome: "cancelled", StartedBy: entry.PendingBy, CompletedBy: actor, CompletedAt: time.Now().UTC()}
+	if entry.PendingSince != nil {
+		rotation.StartedAt = *entry.PendingSince
+	}
+
+	if confirm != nil {
+		key, err := v.PendingKey(entry)
+		if err != nil {
+			return Entry{}, err
+		}
+		if !confirm(key) {
+			return Entry{}, ErrRotationNotConfirmed
+		}
+		sealed, err := v.seal(entry, id, key.Secret)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.Sealed = sealed
+		entry.Type = key.Type
+		entry.Algorithm = key.Algorithm
+		entry.Digits = key.Digits
+		entry.Period = key.Period
+		entry.Counter = key.Counter
+		rotation.Outcome = "completed"
+	}
+	clearPending(&entry)
+	entry.History = append(entry.History, rotation)
+	entry.UpdatedBy = actor
+	entry.UpdatedAt = rotation.CompletedAt
+
+	v.entries[id] = entry
+	if err := v.save(); err != nil {
+		v.entries[id] = previous
+		return Entry{}, err
+	}
+	return entry.clone(), nil
+}
+
+func clearPending(entry *Entry) {
+	entry.SealedPending = nil
+	entry.PendingBy = ""
+	entry.PendingSince = nil
+}
+
+func pendingAAD(id string) string {
+	return id + "/pending"
+}
+
+func (v *Vault) Delete(id string) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	entry, ok := v.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(v.entries, id)
+	if err := v.save(); err != nil {
+		v.entries[id] = entry
+		return err
+	}
+	return nil
+}
+
+func (v *Vault) SetBackupCodes(id, actor string, codes []string) (Entry, error) {
+	stored := make([]BackupCode, len(codes))
+	for idx, code := range codes {
+		stored[idx] = BackupCode{Code: code}
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return v.saveBackupCodesLocked(id, actor, stored)
+}
+
+func (v *Vault) BackupCodes(entry Entry) ([]BackupCode, error) {
+	if len(entry.SealedBackupCodes) == 0 {
+		return nil, ErrNoBackupCodes
+	}
+	plain, err := v.open(entry, backupCodesAAD(entry.ID), entry.SealedBackupCodes)
+	if err != nil {
+		return nil, err
+	}
+	var codes []BackupCode
+	if err := json.Unmarshal([]byte(plain), &codes); err != nil {
+		return nil, fmt.Errorf("failed to parse backup codes: %w", err)
+	}
+	return codes, nil
+}
+
+func (v *Vault) UseBackupCode(id, actor, code string) (int, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	entry, ok := v.entries[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	codes, err := v.BackupCodes(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	code = totp.NormalizeBackupCode(code)
+	idx := slices.IndexFunc(codes, func(stored BackupCode) bool {
+		return subtle.ConstantTimeCompare([]byte(totp.NormalizeBackupCode(stored.Code)), []byte(code)) == 1
+	})
+	if idx < 0 {
+		return RemainingBackupCodes(codes), ErrBackupCodeNotFound
+	}
+	if codes[idx].UsedAt != nil {
+		return RemainingBackupCodes(codes), ErrBackupCodeUsed
+	}
+
+	now := time.Now().UTC()
+	codes[idx].UsedAt = &now
+	codes[idx].UsedBy = actor
+	if _, err := v.saveBackupCodesLocked(id, actor, codes); err != nil {
+		return 0, err
+	}
+	return RemainingBackupCodes(codes), nil
+}
+
+func (v *Vault) saveBackupCodesLocked(id, actor string, codes []BackupCode) (Entry, error) {
+	previous, ok := v.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+
+	entry := previous.clone()
+	entry.SealedBackupCodes = nil
+	if len(codes) > 0 {
+		data, err := json.Marshal(codes)
+		if err != nil {
+			return Entry{}, err
+		}
+		sealed, err := v.seal(previous, backupCodesAAD(id), string(data))
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.SealedBackupCodes = sealed
+	}
+	entry.UpdatedBy = actor
+	entry.UpdatedAt = time.Now().UTC()
+
+	v.entries[id] = entry
+	if err := v.save(); err != nil {
+		v.entries[id] = previous
+		return Entry{}, err
+	}
+	return entry.clone(), nil
+}
+
+func backupCodesAAD(id string) string {
+	return id + "/backup-codes"
+}
+
+func (v *Vault) Key(entry Entry) (*totp.Key, error) {
+	secret, err := v.open(entry, entry.ID, entry.Sealed)
+	if err != nil {
+		return nil, err
+	}
+	return &totp.Key{
+		Type:      entry.Type,
+		Issuer:    entry.Issuer,
+		Account:   entry.Account,
+		Secret:    secret,
+		Algorithm: entry.Algorithm,
+		Digits:    entry.Digits,
+		Period:    entry.Period,
+		Counter:   entry.Counter,
+	}, nil
+}
+
+func (v *Vault) Size() int {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	return len(v.entries)
+}
+
+func (v *Vault) findLocked(owner, name string) *Entry {
+	for _, entry := range v.entries {
+		if entry.Owner == owner && strings.EqualFold(entry.Name, name) {
+			return &entry
+		}
+	}
+	return nil
+}
+
+func (v *Vault) newDataKey(entry *Entry) error {
+	dataKey, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	defer clear(dataKey)
+
+	keyring := v.keyring.Load()
+	wrapped, err := keyring.wrap(entry.ID, dataKey)
+	if err != nil {
+		return err
+	}
+	entry.DataKey, entry.KeyVersion = wrapped, keyring.Active()
+	return nil
+}
+
+func (v *Vault) dataAEAD(entry Entry) (cipher.AEAD, error) {
+	dataKey, err := v.keyring.Load().unwrap(entry.ID, entry.KeyVersion, entry.DataKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+	return newAEAD(dataKey)
+}
+
+func (v *Vault) seal(entry Entry, aad, secret string) ([]byte, error) {
+	aead, err := v.dataAEAD(entry)
+	if err != nil {
+		return nil, err
+	}
+	return sealWith(aead, aad, []byte(secret))
+}
+
+func (v *Vault) open(entry Entry, aad string, sealed []byte) (string, error) {
+	aead, err := v.dataAEAD(entry)
+	if err != nil {
+		return "", err
+	}
+	plain, err := openWith(aead, aad, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (v *Vault) save() error {
+	entries := make([]Entry, 0, len(v.entries))
+	for _, entry := range v.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].ID < entries[b].ID
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		return fmt.Errorf("failed to replace vault: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package vault
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyring func(t *testing.T) *Keyring
+		entries bool
+		wantErr bool
+	}{
+		{"empty vault", func(t *testing.T) *Keyring { return testKeyring(t, 1) }, false, false},
+		{"entries unwrap", func(t *testing.T) *Keyring { return testKeyring(t, 1) }, true, false},
+		{"new active key keeps the old one", func(t *testing.T) *Keyring { return testKeyring(t, 2, 1) }, true, false},
+		{"key in use is missing", func(t *testing.T) *Keyring { return testKeyring(t, 2) }, true, true},
+		{"key in use was swapped", func(t *testing.T) *Keyring {
+			keyring, err := NewKeyring(1, map[int][]byte{1: testKey(9)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return keyring
+		}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := newTestVault(t)
+			if tt.entries {
+				addTestEntry(t, v, "registrar")
+			}
+			// Bypass SetKeyring, which would refuse the bad keyrings, to
+			// simulate a vault whose keys went bad after it was opened.
+			v.keyring.Store(tt.keyring(t))
+
+			if err := v.Check(); (err != nil) != tt.wantErr {
+				t.Errorf("Check() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}